@@ -6,6 +6,7 @@ package docker
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -159,11 +160,17 @@ type AuthStatus struct {
 //
 // See https://goo.gl/6nsZkH for more details.
 func (c *Client) AuthCheck(conf *AuthConfiguration) (AuthStatus, error) {
+	return c.AuthCheckWithContext(context.Background(), conf)
+}
+
+// AuthCheckWithContext validates the given credentials, like AuthCheck. The
+// context can be used to cancel the check.
+func (c *Client) AuthCheckWithContext(ctx context.Context, conf *AuthConfiguration) (AuthStatus, error) {
 	var authStatus AuthStatus
 	if conf == nil {
 		return authStatus, fmt.Errorf("conf is nil")
 	}
-	resp, err := c.do("POST", "/auth", doOptions{data: conf})
+	resp, err := c.do("POST", "/auth", doOptions{data: conf, context: ctx})
 	if err != nil {
 		return authStatus, err
 	}
@@ -0,0 +1,527 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultMaxCassetteBodySize is the size of the largest request body recorded
+// in a cassette, unless RecordingTransport sets another one.
+const DefaultMaxCassetteBodySize = 1 << 20
+
+// Cassette is a recording of the exchanges between a client and the Docker
+// daemon, for replaying them in tests that don't have access to a daemon.
+//
+// Cassettes are recorded with RecordingTransport and replayed with
+// ReplayTransport. Attach and exec sessions take over the connection to the
+// daemon, so they can't be recorded.
+type Cassette struct {
+	// MaxBodySize is the size of the largest request body recorded in
+	// full, larger bodies being recorded as a digest. Defaults to
+	// DefaultMaxCassetteBodySize.
+	MaxBodySize int64 `json:"max_body_size,omitempty"`
+
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request sent to the daemon, along with its response.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteRequest is a request recorded in a cassette.
+type CassetteRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+
+	// Query is the normalized query string of the request, with its
+	// parameters sorted by name.
+	Query string `json:"query,omitempty"`
+
+	// Header is the header of the request, with the headers that may
+	// carry credentials redacted (see RedactHeaders). It's not used for
+	// matching requests.
+	Header http.Header `json:"header,omitempty"`
+
+	Body CassetteBody `json:"body,omitempty"`
+
+	// BodyDigest is the digest of the body, in the form sha256:<hex>,
+	// when the body was too large to be recorded. Requests are then
+	// matched by the digest of their body.
+	BodyDigest string `json:"body_digest,omitempty"`
+}
+
+// CassetteResponse is a response recorded in a cassette.
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+
+	// Chunks are the pieces of the body, as read from the daemon, so
+	// streams like the output of PullImage or Logs are replayed piece by
+	// piece.
+	Chunks []CassetteBody `json:"chunks,omitempty"`
+}
+
+// CassetteBody is a body, or a piece of a body, recorded in a cassette. It's
+// saved as a string when it's text, and encoded in base64 when it's binary,
+// like the multiplexed output of containers or tar archives.
+type CassetteBody []byte
+
+type encodedCassetteBody struct {
+	Base64 string `json:"base64"`
+}
+
+// MarshalJSON encodes the body as a string, or as an object holding its
+// base64 encoding.
+func (b CassetteBody) MarshalJSON() ([]byte, error) {
+	if isText(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(encodedCassetteBody{Base64: base64.StdEncoding.EncodeToString(b)})
+}
+
+// isText indicates whether the given data is UTF-8 text, without control
+// characters other than whitespace.
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, c := range data {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// UnmarshalJSON decodes a body encoded by MarshalJSON.
+func (b *CassetteBody) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = CassetteBody(text)
+		return nil
+	}
+	var encoded encodedCassetteBody
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// LoadCassette loads the cassette saved in the given file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %s", path, err)
+	}
+	return &cassette, nil
+}
+
+// Save saves the cassette to the given file, in JSON.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// RecordingTransport is an http.RoundTripper recording the requests sent
+// through it, along with their responses, in a cassette.
+//
+// Responses are recorded as their body is read, so the cassette is complete
+// once all the calls of the client are over.
+type RecordingTransport struct {
+	// Transport sends the requests. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// MaxBodySize is the size of the largest request body recorded. The
+	// bodies of requests like UploadToContainer or BuildImage may be
+	// large archives; only the digest of bodies above this size is
+	// recorded. Defaults to DefaultMaxCassetteBodySize.
+	MaxBodySize int64
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecordingTransport returns a transport recording the requests sent
+// through the given transport.
+func NewRecordingTransport(transport http.RoundTripper) *RecordingTransport {
+	return &RecordingTransport{Transport: transport}
+}
+
+// RoundTrip sends the request, recording it along with its response.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return t.record(req, transport.RoundTrip)
+}
+
+// Interceptor returns an interceptor recording the requests of the client it's
+// added to, which is the way to record the calls to socket endpoints, as they
+// don't use the HTTPClient of the client.
+func (t *RecordingTransport) Interceptor() Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		if req.Header.Get("Upgrade") != "" {
+			// the connection of attach and exec sessions is taken
+			// over, there's no body to record
+			return next(req)
+		}
+		return t.record(req, next)
+	}
+}
+
+func (t *RecordingTransport) maxBodySize() int64 {
+	if t.MaxBodySize <= 0 {
+		return DefaultMaxCassetteBodySize
+	}
+	return t.MaxBodySize
+}
+
+func (t *RecordingTransport) record(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+	body := &recordingRequestBody{transport: t, capture: newBodyCapture(t.maxBodySize()), index: -1}
+	if req.Body != nil {
+		body.ReadCloser = req.Body
+		req.Body = body
+	} else {
+		body.finished = true
+	}
+	resp, err := next(req)
+	if err != nil {
+		return resp, err
+	}
+	t.mu.Lock()
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+		Request: CassetteRequest{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Query:  normalizeQuery(req.URL.RawQuery),
+			Header: RedactHeaders(req.Header),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+		},
+	})
+	index := len(t.cassette.Interactions) - 1
+	body.index = index
+	if body.finished {
+		body.capture.record(&t.cassette.Interactions[index].Request)
+	}
+	t.mu.Unlock()
+	resp.Body = &recordingBody{ReadCloser: resp.Body, transport: t, index: index}
+	return resp, nil
+}
+
+// Cassette returns a copy of the cassette recorded so far.
+func (t *RecordingTransport) Cassette() *Cassette {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cassette := Cassette{
+		MaxBodySize:  t.maxBodySize(),
+		Interactions: make([]Interaction, len(t.cassette.Interactions)),
+	}
+	copy(cassette.Interactions, t.cassette.Interactions)
+	for i := range cassette.Interactions {
+		chunks := cassette.Interactions[i].Response.Chunks
+		cassette.Interactions[i].Response.Chunks = append([]CassetteBody(nil), chunks...)
+	}
+	return &cassette
+}
+
+// bodyCapture keeps the digest of a body written to it, along with the body
+// itself as long as it doesn't exceed the limit.
+type bodyCapture struct {
+	limit int64
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	hash     hash.Hash
+	size     int64
+	overflow bool
+}
+
+func newBodyCapture(limit int64) *bodyCapture {
+	return &bodyCapture{limit: limit, hash: sha256.New()}
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hash.Write(p)
+	c.size += int64(len(p))
+	if c.size > c.limit {
+		if !c.overflow {
+			c.overflow = true
+			c.buf = bytes.Buffer{}
+		}
+	} else {
+		c.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// body returns the body written so far, and whether it's complete, which it
+// isn't when it exceeds the limit.
+func (c *bodyCapture) body() ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.overflow {
+		return nil, false
+	}
+	return append([]byte(nil), c.buf.Bytes()...), true
+}
+
+// digest returns the digest of the body written so far, in the form
+// sha256:<hex>.
+func (c *bodyCapture) digest() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return "sha256:" + hex.EncodeToString(c.hash.Sum(nil))
+}
+
+// record sets the body of the given request, or its digest when the body
+// exceeds the limit.
+func (c *bodyCapture) record(request *CassetteRequest) {
+	if body, complete := c.body(); complete {
+		request.Body = body
+	} else {
+		request.BodyDigest = c.digest()
+	}
+}
+
+// recordingRequestBody captures a request body as the transport reads it. The
+// body is recorded once it's read until EOF or closed: the transport may
+// still be sending it after the response is received.
+type recordingRequestBody struct {
+	io.ReadCloser
+	transport *RecordingTransport
+	capture   *bodyCapture
+
+	// index is the index of the interaction of the request, or -1 until
+	// its response is received. Both fields are guarded by the lock of
+	// the transport.
+	index    int
+	finished bool
+}
+
+func (b *recordingRequestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.capture.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingRequestBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+// finish records the body in the interaction of the request, if its
+// response has been received already. Otherwise it's recorded along with
+// the response.
+func (b *recordingRequestBody) finish() {
+	b.transport.mu.Lock()
+	defer b.transport.mu.Unlock()
+	if b.finished {
+		return
+	}
+	b.finished = true
+	if b.index >= 0 {
+		b.capture.record(&b.transport.cassette.Interactions[b.index].Request)
+	}
+}
+
+// recordingBody records the pieces of a body in a cassette as they're read.
+type recordingBody struct {
+	io.ReadCloser
+	transport *RecordingTransport
+	index     int
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		chunk := append(CassetteBody(nil), p[:n]...)
+		b.transport.mu.Lock()
+		response := &b.transport.cassette.Interactions[b.index].Response
+		response.Chunks = append(response.Chunks, chunk)
+		b.transport.mu.Unlock()
+	}
+	return n, err
+}
+
+// ReplayTransport is an http.RoundTripper replaying the responses recorded in
+// a cassette, without sending the requests anywhere.
+//
+// Requests are matched with the recorded ones by method, path, normalized
+// query string and body, JSON bodies being compared regardless of their
+// formatting, and bodies recorded as a digest by their digest. Every
+// recorded interaction is replayed once, in order, so repeated calls get the
+// successive responses recorded for them. Requests matching no interaction
+// left fail.
+type ReplayTransport struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// NewReplayTransport returns a transport replaying the given cassette.
+func NewReplayTransport(cassette *Cassette) *ReplayTransport {
+	return &ReplayTransport{
+		cassette: cassette,
+		used:     make([]bool, len(cassette.Interactions)),
+	}
+}
+
+// RoundTrip returns the response recorded for the request.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limit := t.cassette.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxCassetteBodySize
+	}
+	capture := newBodyCapture(limit)
+	if req.Body != nil {
+		_, err := io.Copy(capture, req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	body, complete := capture.body()
+	digest := capture.digest()
+	query := normalizeQuery(req.URL.RawQuery)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, interaction := range t.cassette.Interactions {
+		recorded := interaction.Request
+		if t.used[i] || recorded.Method != req.Method || recorded.Path != req.URL.Path ||
+			normalizeQuery(recorded.Query) != query {
+			continue
+		}
+		if recorded.BodyDigest != "" {
+			if recorded.BodyDigest != digest {
+				continue
+			}
+		} else if !complete || !equalBodies(recorded.Body, body) {
+			continue
+		}
+		t.used[i] = true
+		return replayResponse(req, interaction.Response), nil
+	}
+	return nil, fmt.Errorf("no interaction left in the cassette for %s %s", req.Method, req.URL.RequestURI())
+}
+
+// Unused returns the interactions that haven't been replayed yet.
+func (t *ReplayTransport) Unused() []Interaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var unused []Interaction
+	for i, interaction := range t.cassette.Interactions {
+		if !t.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+func replayResponse(req *http.Request, recorded CassetteResponse) *http.Response {
+	header := make(http.Header, len(recorded.Header))
+	for k, v := range recorded.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	chunks := make([][]byte, len(recorded.Chunks))
+	for i, chunk := range recorded.Chunks {
+		chunks[i] = chunk
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          &chunkedBody{chunks: chunks},
+		ContentLength: -1,
+		Request:       req,
+	}
+}
+
+// chunkedBody returns at most one recorded chunk per read.
+type chunkedBody struct {
+	chunks [][]byte
+}
+
+func (b *chunkedBody) Read(p []byte) (int, error) {
+	if len(b.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.chunks[0])
+	if n == len(b.chunks[0]) {
+		b.chunks = b.chunks[1:]
+	} else {
+		b.chunks[0] = b.chunks[0][n:]
+	}
+	return n, nil
+}
+
+func (b *chunkedBody) Close() error {
+	return nil
+}
+
+// normalizeQuery sorts the parameters of the given query string by name.
+func normalizeQuery(rawQuery string) string {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	return query.Encode()
+}
+
+// equalBodies compares two request bodies, regardless of their formatting
+// when they're both JSON.
+func equalBodies(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var jsonA, jsonB interface{}
+	if json.Unmarshal(a, &jsonA) != nil || json.Unmarshal(b, &jsonB) != nil {
+		return false
+	}
+	normalizedA, _ := json.Marshal(jsonA)
+	normalizedB, _ := json.Marshal(jsonB)
+	return bytes.Equal(normalizedA, normalizedB)
+}
@@ -0,0 +1,311 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	dtesting "github.com/fsouza/go-dockerclient/testing"
+)
+
+func saveAndLoadCassette(t *testing.T, cassette *docker.Cassette) *docker.Cassette {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+	if err := cassette.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := docker.LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	run := func(client *docker.Client) (*docker.Container, []docker.APIContainers, string) {
+		var pullOutput bytes.Buffer
+		err := client.PullImage(docker.PullImageOptions{Repository: "busybox", OutputStream: &pullOutput}, docker.AuthConfiguration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created, err := client.CreateContainer(docker.CreateContainerOptions{
+			Name:   "recorded",
+			Config: &docker.Config{Image: "busybox", Cmd: []string{"echo", "hello"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		container, err := client.InspectContainer(created.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		containers, err := client.ListContainers(docker.ListContainersOptions{All: true, Filters: map[string][]string{"name": {"recorded"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return container, containers, pullOutput.String()
+	}
+	client, err := docker.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := docker.NewRecordingTransport(client.HTTPClient.Transport)
+	client.HTTPClient.Transport = recorder
+	recordedContainer, recordedList, recordedOutput := run(client)
+	server.Stop()
+
+	cassette := saveAndLoadCassette(t, recorder.Cassette())
+	replay := docker.NewReplayTransport(cassette)
+	client.HTTPClient.Transport = replay
+	container, list, output := run(client)
+	if container.ID != recordedContainer.ID || container.Name != recordedContainer.Name {
+		t.Errorf("InspectContainer: wrong replayed container. Want %#v. Got %#v.", recordedContainer, container)
+	}
+	if !reflect.DeepEqual(list, recordedList) {
+		t.Errorf("ListContainers: wrong replayed list. Want %#v. Got %#v.", recordedList, list)
+	}
+	if output != recordedOutput {
+		t.Errorf("PullImage: wrong replayed output. Want %q. Got %q.", recordedOutput, output)
+	}
+	if unused := replay.Unused(); len(unused) != 0 {
+		t.Errorf("Unused: expected all the interactions to be replayed, got %#v.", unused)
+	}
+	if _, err := client.InspectContainer(recordedContainer.ID); err == nil {
+		t.Error("InspectContainer: expected non-nil error once the cassette is over, got <nil>")
+	}
+}
+
+func TestCassetteRequestMatching(t *testing.T) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	client, err := docker.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PullImage(docker.PullImageOptions{Repository: "nginx"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := docker.NewRecordingTransport(nil)
+	client.AddInterceptor(recorder.Interceptor())
+	createOpts := docker.CreateContainerOptions{Name: "web", Config: &docker.Config{Image: "nginx"}}
+	created, err := client.CreateContainer(createOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listOpts := docker.ListContainersOptions{All: true, Limit: 10}
+	if _, err := client.ListContainers(listOpts); err != nil {
+		t.Fatal(err)
+	}
+	cassette := recorder.Cassette()
+	// the formatting of the JSON body and the order of the parameters of
+	// the query string don't matter
+	var body interface{}
+	if err := json.Unmarshal(cassette.Interactions[0].Request.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	indented, _ := json.MarshalIndent(body, "", "    ")
+	cassette.Interactions[0].Request.Body = indented
+	if query := cassette.Interactions[1].Request.Query; query != "all=1&limit=10" {
+		t.Fatalf("Cassette: wrong normalized query. Want %q. Got %q.", "all=1&limit=10", query)
+	}
+	cassette.Interactions[1].Request.Query = "limit=10&all=1"
+	cassette = saveAndLoadCassette(t, cassette)
+
+	client, err = docker.NewClient("http://docker.invalid:2375")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.HTTPClient.Transport = docker.NewReplayTransport(cassette)
+	if _, err := client.CreateContainer(docker.CreateContainerOptions{Name: "web", Config: &docker.Config{Image: "redis"}}); err == nil {
+		t.Error("CreateContainer: expected non-nil error for a body that wasn't recorded, got <nil>")
+	}
+	if _, err := client.ListContainers(docker.ListContainersOptions{All: true}); err == nil {
+		t.Error("ListContainers: expected non-nil error for a query that wasn't recorded, got <nil>")
+	}
+	container, err := client.CreateContainer(createOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.ID != created.ID {
+		t.Errorf("CreateContainer: wrong replayed container. Want %q. Got %q.", created.ID, container.ID)
+	}
+	containers, err := client.ListContainers(listOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].ID != created.ID {
+		t.Errorf("ListContainers: wrong replayed containers. Got %#v.", containers)
+	}
+}
+
+func TestCassetteLargeRequestBody(t *testing.T) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	server.CustomHandler("/containers/abc/archive", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	client, err := docker.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := docker.NewRecordingTransport(client.HTTPClient.Transport)
+	recorder.MaxBodySize = 16
+	client.HTTPClient.Transport = recorder
+	archive := bytes.Repeat([]byte("archive"), 100)
+	small := []byte("small archive")
+	upload := func(data []byte) error {
+		return client.UploadToContainer("abc", docker.UploadToContainerOptions{InputStream: bytes.NewReader(data), Path: "/tmp"})
+	}
+	if err := upload(archive); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload(small); err != nil {
+		t.Fatal(err)
+	}
+	cassette := saveAndLoadCassette(t, recorder.Cassette())
+	if cassette.MaxBodySize != 16 {
+		t.Errorf("RecordingTransport: wrong max body size. Want 16. Got %d.", cassette.MaxBodySize)
+	}
+	if len(cassette.Interactions) != 2 {
+		t.Fatalf("RecordingTransport: wrong number of interactions. Want 2. Got %d.", len(cassette.Interactions))
+	}
+	request := cassette.Interactions[0].Request
+	sum := sha256.Sum256(archive)
+	expectedDigest := "sha256:" + hex.EncodeToString(sum[:])
+	if request.Body != nil || request.BodyDigest != expectedDigest {
+		t.Errorf("RecordingTransport: wrong body. Want digest %q. Got %q and body %q.", expectedDigest, request.BodyDigest, request.Body)
+	}
+	if request := cassette.Interactions[1].Request; string(request.Body) != string(small) || request.BodyDigest != "" {
+		t.Errorf("RecordingTransport: wrong body. Want %q. Got %q and digest %q.", small, request.Body, request.BodyDigest)
+	}
+	replay := docker.NewReplayTransport(cassette)
+	client.HTTPClient.Transport = replay
+	if err := upload(append([]byte("other"), archive...)); err == nil {
+		t.Error("UploadToContainer: unexpected <nil> error replaying a different body")
+	}
+	if err := upload(archive); err != nil {
+		t.Errorf("UploadToContainer: %s", err)
+	}
+	if err := upload(small); err != nil {
+		t.Errorf("UploadToContainer: %s", err)
+	}
+	if unused := replay.Unused(); len(unused) != 0 {
+		t.Errorf("ReplayTransport: wrong number of unused interactions. Want 0. Got %d.", len(unused))
+	}
+}
+
+func TestCassetteRequestBodySentAfterResponse(t *testing.T) {
+	client, err := docker.NewClient("http://docker.invalid:2375")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := docker.NewRecordingTransport(nil)
+	client.AddInterceptor(recorder.Interceptor())
+	// the daemon may answer before the body of the request is sent
+	var pending io.ReadCloser
+	client.AddInterceptor(func(req *http.Request, next docker.RoundTripFunc) (*http.Response, error) {
+		pending = req.Body
+		return &http.Response{
+			StatusCode: http.StatusCreated,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"Id":"web1"}`)),
+		}, nil
+	})
+	if _, err := client.CreateContainer(docker.CreateContainerOptions{Name: "web", Config: &docker.Config{Image: "nginx"}}); err != nil {
+		t.Fatal(err)
+	}
+	if body := recorder.Cassette().Interactions[0].Request.Body; body != nil {
+		t.Errorf("RecordingTransport: expected no body before it's sent, got %q.", body)
+	}
+	data, err := ioutil.ReadAll(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending.Close()
+	if body := recorder.Cassette().Interactions[0].Request.Body; !bytes.Equal(body, data) {
+		t.Errorf("RecordingTransport: wrong body. Want %q. Got %q.", data, body)
+	}
+}
+
+func TestCassetteMultiplexedStream(t *testing.T) {
+	frame := func(stream byte, payload string) []byte {
+		header := make([]byte, 8)
+		header[0] = stream
+		binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+		return append(header, payload...)
+	}
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	server.CustomHandler("/containers/abc/logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+		for _, f := range [][]byte{frame(1, "line 1\n"), frame(2, "warning\n"), frame(1, "line 2\n")} {
+			w.Write(f)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	client, err := docker.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := docker.NewRecordingTransport(client.HTTPClient.Transport)
+	client.HTTPClient.Transport = recorder
+	logs := func() (string, string) {
+		var stdout, stderr bytes.Buffer
+		err := client.Logs(docker.LogsOptions{Container: "abc", OutputStream: &stdout, ErrorStream: &stderr, Stdout: true, Stderr: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stdout.String(), stderr.String()
+	}
+	recordedStdout, recordedStderr := logs()
+	if recordedStdout != "line 1\nline 2\n" || recordedStderr != "warning\n" {
+		t.Fatalf("Logs: wrong recorded output %q and %q.", recordedStdout, recordedStderr)
+	}
+	data, err := json.Marshal(recorder.Cassette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"base64"`)) {
+		t.Errorf("Save: expected the multiplexed stream to be saved in base64, got:\n%s", data)
+	}
+	cassette := saveAndLoadCassette(t, recorder.Cassette())
+	client.HTTPClient.Transport = docker.NewReplayTransport(cassette)
+	stdout, stderr := logs()
+	if stdout != recordedStdout || stderr != recordedStderr {
+		t.Errorf("Logs: wrong replayed output. Want %q and %q. Got %q and %q.", recordedStdout, recordedStderr, stdout, stderr)
+	}
+}
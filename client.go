@@ -8,10 +8,9 @@
 package docker
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,7 +18,6 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -27,6 +25,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -34,8 +33,6 @@ import (
 	"github.com/docker/docker/pkg/homedir"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/hashicorp/go-cleanhttp"
-	"golang.org/x/net/context"
-	"golang.org/x/net/context/ctxhttp"
 )
 
 const userAgent = "go-dockerclient"
@@ -52,7 +49,13 @@ var (
 
 	apiVersion112, _ = NewAPIVersion("1.12")
 	apiVersion119, _ = NewAPIVersion("1.19")
+	apiVersion121, _ = NewAPIVersion("1.21")
 	apiVersion124, _ = NewAPIVersion("1.24")
+	apiVersion125, _ = NewAPIVersion("1.25")
+	apiVersion130, _ = NewAPIVersion("1.30")
+
+	// maxAPIVersion is the most recent API version supported by the client.
+	maxAPIVersion = apiVersion130
 )
 
 // APIVersion is an internal representation of a version of the Remote API.
@@ -139,75 +142,73 @@ type Client struct {
 	TLSConfig              *tls.Config
 	Dialer                 *net.Dialer
 
-	endpoint            string
-	endpointURL         *url.URL
-	eventMonitor        *eventMonitoringState
+	// RetryPolicy controls the retry of API calls failing with transient
+	// errors, and the reconnection of the event monitor (see
+	// AddEventListener). When nil, calls are never retried, and the event
+	// monitor makes up to 6 attempts to connect, starting with a 10ms
+	// backoff.
+	RetryPolicy *RetryPolicy
+
+	// GuardPolicy protects resources from the destructive calls of the
+	// client. When nil, all the calls are allowed.
+	GuardPolicy *GuardPolicy
+
+	endpoint     string
+	endpointURL  *url.URL
+	eventMonitor *eventMonitoringState
+
+	// apiVersionMu guards the API versions and the ongoing version check.
+	apiVersionMu        sync.RWMutex
+	apiVersionCheck     *apiVersionCheck
 	requestedAPIVersion APIVersion
 	serverAPIVersion    APIVersion
 	expectedAPIVersion  APIVersion
-	unixHTTPClient      *http.Client
+	negotiateAPIVersion bool
+	apiVersionCeiling   APIVersion
+
+	unixHTTPClient *http.Client
+	sshDialer      *sshDialer
+
+	// configMu guards the settings of the client that can be changed while
+	// calls are made: the interceptors, the limits, the metrics recorder,
+	// the dry-run mode and the inspect cache.
+	configMu     sync.RWMutex
+	interceptors []Interceptor
+	limiter      *limiter
+	metrics      MetricsRecorder
+	dryRun       *dryRunPlan
+	inspectCache *inspectCache
 }
 
 // NewClient returns a Client instance ready for communication with the given
 // server endpoint. It will use the latest remote API version available in the
 // server.
 func NewClient(endpoint string) (*Client, error) {
-	client, err := NewVersionedClient(endpoint, "")
-	if err != nil {
-		return nil, err
-	}
-	client.SkipServerVersionCheck = true
-	return client, nil
+	return NewClientWithOptions(WithHost(endpoint))
 }
 
 // NewTLSClient returns a Client instance ready for TLS communications with the givens
 // server endpoint, key and certificates . It will use the latest remote API version
 // available in the server.
 func NewTLSClient(endpoint string, cert, key, ca string) (*Client, error) {
-	client, err := NewVersionedTLSClient(endpoint, cert, key, ca, "")
-	if err != nil {
-		return nil, err
-	}
-	client.SkipServerVersionCheck = true
-	return client, nil
+	return NewClientWithOptions(WithHost(endpoint), WithTLSFiles(cert, key, ca))
 }
 
 // NewTLSClientFromBytes returns a Client instance ready for TLS communications with the givens
 // server endpoint, key and certificates (passed inline to the function as opposed to being
 // read from a local file). It will use the latest remote API version available in the server.
 func NewTLSClientFromBytes(endpoint string, certPEMBlock, keyPEMBlock, caPEMCert []byte) (*Client, error) {
-	client, err := NewVersionedTLSClientFromBytes(endpoint, certPEMBlock, keyPEMBlock, caPEMCert, "")
+	tlsConfig, err := tlsConfigFromBytes(certPEMBlock, keyPEMBlock, caPEMCert)
 	if err != nil {
 		return nil, err
 	}
-	client.SkipServerVersionCheck = true
-	return client, nil
+	return NewClientWithOptions(WithHost(endpoint), WithTLSConfig(tlsConfig))
 }
 
 // NewVersionedClient returns a Client instance ready for communication with
 // the given server endpoint, using a specific remote API version.
 func NewVersionedClient(endpoint string, apiVersionString string) (*Client, error) {
-	u, err := parseEndpoint(endpoint, false)
-	if err != nil {
-		return nil, err
-	}
-	var requestedAPIVersion APIVersion
-	if strings.Contains(apiVersionString, ".") {
-		requestedAPIVersion, err = NewAPIVersion(apiVersionString)
-		if err != nil {
-			return nil, err
-		}
-	}
-	c := &Client{
-		HTTPClient:          cleanhttp.DefaultClient(),
-		Dialer:              &net.Dialer{},
-		endpoint:            endpoint,
-		endpointURL:         u,
-		eventMonitor:        new(eventMonitoringState),
-		requestedAPIVersion: requestedAPIVersion,
-	}
-	c.initializeUnixClient()
-	return c, nil
+	return newClientWithOptions(WithHost(endpoint), WithAPIVersion(apiVersionString))
 }
 
 // NewVersionnedTLSClient has been DEPRECATED, please use NewVersionedTLSClient.
@@ -218,108 +219,43 @@ func NewVersionnedTLSClient(endpoint string, cert, key, ca, apiVersionString str
 // NewVersionedTLSClient returns a Client instance ready for TLS communications with the givens
 // server endpoint, key and certificates, using a specific remote API version.
 func NewVersionedTLSClient(endpoint string, cert, key, ca, apiVersionString string) (*Client, error) {
-	certPEMBlock, err := ioutil.ReadFile(cert)
-	if err != nil {
-		return nil, err
-	}
-	keyPEMBlock, err := ioutil.ReadFile(key)
-	if err != nil {
-		return nil, err
-	}
-	caPEMCert, err := ioutil.ReadFile(ca)
-	if err != nil {
-		return nil, err
-	}
-	return NewVersionedTLSClientFromBytes(endpoint, certPEMBlock, keyPEMBlock, caPEMCert, apiVersionString)
+	return newClientWithOptions(WithHost(endpoint), WithTLSFiles(cert, key, ca), WithAPIVersion(apiVersionString))
 }
 
 // NewClientFromEnv returns a Client instance ready for communication created from
-// Docker's default logic for the environment variables DOCKER_HOST, DOCKER_TLS_VERIFY, and DOCKER_CERT_PATH.
+// Docker's default logic for the environment variables DOCKER_HOST, DOCKER_TLS_VERIFY,
+// DOCKER_CERT_PATH and DOCKER_API_VERSION.
 //
 // See https://github.com/docker/docker/blob/1f963af697e8df3a78217f6fdbf67b8123a7db94/docker/docker.go#L68.
 // See https://github.com/docker/compose/blob/81707ef1ad94403789166d2fe042c8a718a4c748/compose/cli/docker_client.py#L7.
 func NewClientFromEnv() (*Client, error) {
-	client, err := NewVersionedClientFromEnv("")
-	if err != nil {
-		return nil, err
-	}
-	client.SkipServerVersionCheck = true
-	return client, nil
+	return NewClientWithOptions(FromEnv())
 }
 
 // NewVersionedClientFromEnv returns a Client instance ready for TLS communications created from
 // Docker's default logic for the environment variables DOCKER_HOST, DOCKER_TLS_VERIFY, and DOCKER_CERT_PATH,
-// and using a specific remote API version.
+// and using a specific remote API version. When apiVersionString is empty,
+// the version in DOCKER_API_VERSION is used, if any.
 //
 // See https://github.com/docker/docker/blob/1f963af697e8df3a78217f6fdbf67b8123a7db94/docker/docker.go#L68.
 // See https://github.com/docker/compose/blob/81707ef1ad94403789166d2fe042c8a718a4c748/compose/cli/docker_client.py#L7.
 func NewVersionedClientFromEnv(apiVersionString string) (*Client, error) {
-	dockerEnv, err := getDockerEnv()
-	if err != nil {
-		return nil, err
-	}
-	dockerHost := dockerEnv.dockerHost
-	if dockerEnv.dockerTLSVerify {
-		parts := strings.SplitN(dockerEnv.dockerHost, "://", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("could not split %s into two parts by ://", dockerHost)
-		}
-		cert := filepath.Join(dockerEnv.dockerCertPath, "cert.pem")
-		key := filepath.Join(dockerEnv.dockerCertPath, "key.pem")
-		ca := filepath.Join(dockerEnv.dockerCertPath, "ca.pem")
-		return NewVersionedTLSClient(dockerEnv.dockerHost, cert, key, ca, apiVersionString)
+	opts := []ClientOption{FromEnv()}
+	if apiVersionString != "" {
+		opts = append(opts, WithAPIVersion(apiVersionString))
 	}
-	return NewVersionedClient(dockerEnv.dockerHost, apiVersionString)
+	return newClientWithOptions(opts...)
 }
 
 // NewVersionedTLSClientFromBytes returns a Client instance ready for TLS communications with the givens
 // server endpoint, key and certificates (passed inline to the function as opposed to being
 // read from a local file), using a specific remote API version.
 func NewVersionedTLSClientFromBytes(endpoint string, certPEMBlock, keyPEMBlock, caPEMCert []byte, apiVersionString string) (*Client, error) {
-	u, err := parseEndpoint(endpoint, true)
-	if err != nil {
-		return nil, err
-	}
-	var requestedAPIVersion APIVersion
-	if strings.Contains(apiVersionString, ".") {
-		requestedAPIVersion, err = NewAPIVersion(apiVersionString)
-		if err != nil {
-			return nil, err
-		}
-	}
-	if certPEMBlock == nil || keyPEMBlock == nil {
-		return nil, errors.New("Both cert and key are required")
-	}
-	tlsCert, err := tls.X509KeyPair(certPEMBlock, keyPEMBlock)
+	tlsConfig, err := tlsConfigFromBytes(certPEMBlock, keyPEMBlock, caPEMCert)
 	if err != nil {
 		return nil, err
 	}
-	tlsConfig := &tls.Config{Certificates: []tls.Certificate{tlsCert}}
-	if caPEMCert == nil {
-		tlsConfig.InsecureSkipVerify = true
-	} else {
-		caPool := x509.NewCertPool()
-		if !caPool.AppendCertsFromPEM(caPEMCert) {
-			return nil, errors.New("Could not add RootCA pem")
-		}
-		tlsConfig.RootCAs = caPool
-	}
-	tr := cleanhttp.DefaultTransport()
-	tr.TLSClientConfig = tlsConfig
-	if err != nil {
-		return nil, err
-	}
-	c := &Client{
-		HTTPClient:          &http.Client{Transport: tr},
-		TLSConfig:           tlsConfig,
-		Dialer:              &net.Dialer{},
-		endpoint:            endpoint,
-		endpointURL:         u,
-		eventMonitor:        new(eventMonitoringState),
-		requestedAPIVersion: requestedAPIVersion,
-	}
-	c.initializeUnixClient()
-	return c, nil
+	return newClientWithOptions(WithHost(endpoint), WithTLSConfig(tlsConfig), WithAPIVersion(apiVersionString))
 }
 
 // SetTimeout takes a timeout and applies it to both the HTTPClient and
@@ -334,16 +270,109 @@ func (c *Client) SetTimeout(t time.Duration) {
 	}
 }
 
-func (c *Client) checkAPIVersion() error {
-	serverAPIVersionString, err := c.getServerAPIVersionString()
+// EnableAPIVersionNegotiation makes the client negotiate the API version
+// with the server before the first call: the client uses the lowest version
+// between the one supported by the server and the one requested when creating
+// the client (or the most recent version supported by the client, if none was
+// requested).
+//
+// It's safe to call EnableAPIVersionNegotiation concurrently with other Client
+// methods: the version is negotiated by the next call that needs it.
+func (c *Client) EnableAPIVersionNegotiation() {
+	c.apiVersionMu.Lock()
+	defer c.apiVersionMu.Unlock()
+	if !c.negotiateAPIVersion {
+		c.apiVersionCeiling = c.requestedAPIVersion
+		if c.apiVersionCeiling == nil {
+			c.apiVersionCeiling = maxAPIVersion
+		}
+	}
+	c.negotiateAPIVersion = true
+	c.requestedAPIVersion = nil
+	c.expectedAPIVersion = nil
+}
+
+// RefreshAPIVersion detects the API version of the server again, which is
+// useful after the daemon is upgraded or downgraded. When the client
+// negotiates the API version, the version used by the client is negotiated
+// again too.
+//
+// It's safe to call RefreshAPIVersion concurrently with other Client
+// methods, which keep using the previous version until the detection is
+// over.
+func (c *Client) RefreshAPIVersion() error {
+	return c.checkAPIVersion(context.Background())
+}
+
+// apiVersionCheck is a request for the version of the server, shared by all
+// the calls waiting for it.
+type apiVersionCheck struct {
+	done chan struct{}
+	err  error
+}
+
+// ensureAPIVersion detects the API version of the server, unless it has
+// already been detected or the client is configured to skip the detection.
+// The detection gives up when the context is done.
+func (c *Client) ensureAPIVersion(ctx context.Context) error {
+	c.apiVersionMu.RLock()
+	detected := c.expectedAPIVersion != nil || (c.SkipServerVersionCheck && !c.negotiateAPIVersion)
+	c.apiVersionMu.RUnlock()
+	if detected {
+		return nil
+	}
+	return c.checkAPIVersion(ctx)
+}
+
+// checkAPIVersion detects the API version of the server. Concurrent calls
+// share a single request to the server, made with the context of the first
+// one. A call whose context is done stops waiting for the shared request, and
+// the others start a new request if the context of the first call is done.
+func (c *Client) checkAPIVersion(ctx context.Context) error {
+	c.apiVersionMu.Lock()
+	for c.apiVersionCheck != nil {
+		check := c.apiVersionCheck
+		c.apiVersionMu.Unlock()
+		select {
+		case <-check.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if check.err != context.Canceled && check.err != context.DeadlineExceeded {
+			return check.err
+		}
+		c.apiVersionMu.Lock()
+	}
+	check := &apiVersionCheck{done: make(chan struct{})}
+	c.apiVersionCheck = check
+	c.apiVersionMu.Unlock()
+	check.err = c.detectAPIVersion(ctx)
+	c.apiVersionMu.Lock()
+	c.apiVersionCheck = nil
+	c.apiVersionMu.Unlock()
+	close(check.done)
+	return check.err
+}
+
+func (c *Client) detectAPIVersion(ctx context.Context) error {
+	serverAPIVersionString, err := c.getServerAPIVersionString(ctx)
 	if err != nil {
 		return err
 	}
-	c.serverAPIVersion, err = NewAPIVersion(serverAPIVersionString)
+	serverAPIVersion, err := NewAPIVersion(serverAPIVersionString)
 	if err != nil {
 		return err
 	}
-	if c.requestedAPIVersion == nil {
+	c.apiVersionMu.Lock()
+	defer c.apiVersionMu.Unlock()
+	c.serverAPIVersion = serverAPIVersion
+	if c.negotiateAPIVersion {
+		c.requestedAPIVersion = c.apiVersionCeiling
+		if c.serverAPIVersion.LessThan(c.apiVersionCeiling) {
+			c.requestedAPIVersion = c.serverAPIVersion
+		}
+		c.expectedAPIVersion = c.requestedAPIVersion
+	} else if c.requestedAPIVersion == nil {
 		c.expectedAPIVersion = c.serverAPIVersion
 	} else {
 		c.expectedAPIVersion = c.requestedAPIVersion
@@ -351,6 +380,39 @@ func (c *Client) checkAPIVersion() error {
 	return nil
 }
 
+// getServerAPIVersion returns the API version of the server, detecting it if
+// it's not known yet. It returns nil if the detection fails.
+func (c *Client) getServerAPIVersion() APIVersion {
+	c.apiVersionMu.RLock()
+	version := c.serverAPIVersion
+	c.apiVersionMu.RUnlock()
+	if version != nil {
+		return version
+	}
+	if err := c.checkAPIVersion(context.Background()); err != nil {
+		return nil
+	}
+	c.apiVersionMu.RLock()
+	defer c.apiVersionMu.RUnlock()
+	return c.serverAPIVersion
+}
+
+// getExpectedAPIVersion returns the API version expected by the client, or
+// nil if it's not known yet.
+func (c *Client) getExpectedAPIVersion() APIVersion {
+	c.apiVersionMu.RLock()
+	defer c.apiVersionMu.RUnlock()
+	return c.expectedAPIVersion
+}
+
+// getRequestedAPIVersion returns the API version used in the path of the
+// requests, or nil if requests are unversioned.
+func (c *Client) getRequestedAPIVersion() APIVersion {
+	c.apiVersionMu.RLock()
+	defer c.apiVersionMu.RUnlock()
+	return c.requestedAPIVersion
+}
+
 // Endpoint returns the current endpoint. It's useful for getting the endpoint
 // when using functions that get this data from the environment (like
 // NewClientFromEnv.
@@ -362,8 +424,13 @@ func (c *Client) Endpoint() string {
 //
 // See https://goo.gl/kQCfJj for more details.
 func (c *Client) Ping() error {
+	return c.PingWithContext(context.Background())
+}
+
+// PingWithContext pings the docker server, giving up when the context is done.
+func (c *Client) PingWithContext(ctx context.Context) error {
 	path := "/_ping"
-	resp, err := c.do("GET", path, doOptions{})
+	resp, err := c.do("GET", path, doOptions{context: ctx})
 	if err != nil {
 		return err
 	}
@@ -374,8 +441,8 @@ func (c *Client) Ping() error {
 	return nil
 }
 
-func (c *Client) getServerAPIVersionString() (version string, err error) {
-	resp, err := c.do("GET", "/version", doOptions{})
+func (c *Client) getServerAPIVersionString(ctx context.Context) (version string, err error) {
+	resp, err := c.do("GET", "/version", doOptions{context: ctx})
 	if err != nil {
 		return "", err
 	}
@@ -398,33 +465,56 @@ type doOptions struct {
 	forceJSON bool
 	headers   map[string]string
 	context   context.Context
+	// idempotent marks requests that may be safely retried, even though
+	// their method is not GET or HEAD
+	idempotent bool
+	// callOptions are the options of the client method making the call,
+	// reported in the plan of dry runs
+	callOptions interface{}
+	// stream marks long-lived requests, like waits, that count against the
+	// MaxStreams limit instead of MaxInFlight
+	stream bool
 }
 
 func (c *Client) do(method, path string, doOptions doOptions) (*http.Response, error) {
-	var params io.Reader
+	var body []byte
 	if doOptions.data != nil || doOptions.forceJSON {
 		buf, err := json.Marshal(doOptions.data)
 		if err != nil {
 			return nil, err
 		}
-		params = bytes.NewBuffer(buf)
+		body = buf
 	}
-	if path != "/version" && !c.SkipServerVersionCheck && c.expectedAPIVersion == nil {
-		err := c.checkAPIVersion()
-		if err != nil {
+	if plan := c.planOf(method, path); plan != nil {
+		return plan.add(method, path, doOptions.callOptions, body).httpResponse(), nil
+	}
+	if cache := c.currentInspectCache(); cache != nil && method != "GET" && method != "HEAD" {
+		defer cache.invalidatePath(method, path)
+	}
+	ctx := doOptions.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if path != "/version" {
+		if err := c.ensureAPIVersion(ctx); err != nil {
 			return nil, err
 		}
 	}
-	httpClient := c.HTTPClient
-	protocol := c.endpointURL.Scheme
-	var u string
-	if protocol == "unix" {
-		httpClient = c.unixHTTPClient
-		u = c.getFakeUnixURL(path)
-	} else {
-		u = c.getURL(path)
+	retryable := isIdempotent(method, doOptions)
+	for attempt := 0; ; attempt++ {
+		resp, err := c.doOnce(ctx, method, path, body, doOptions)
+		if err == nil || !retryable || !c.RetryPolicy.shouldRetry(attempt, err) || !c.RetryPolicy.wait(ctx, attempt) {
+			return resp, err
+		}
 	}
+}
 
+func (c *Client) doOnce(ctx context.Context, method, path string, body []byte, doOptions doOptions) (*http.Response, error) {
+	var params io.Reader
+	if body != nil {
+		params = bytes.NewReader(body)
+	}
+	httpClient, u := c.requestClient(path)
 	req, err := http.NewRequest(method, u, params)
 	if err != nil {
 		return nil, err
@@ -440,25 +530,49 @@ func (c *Client) do(method, path string, doOptions doOptions) (*http.Response, e
 		req.Header.Set(k, v)
 	}
 
-	ctx := doOptions.context
-	if ctx == nil {
-		ctx = context.Background()
+	release, err := c.currentLimiter().acquire(ctx, doOptions.stream)
+	if err != nil {
+		return nil, err
 	}
-
-	resp, err := ctxhttp.Do(ctx, httpClient, req)
+	call := c.startCall(method, path, doOptions.stream)
+	resp, err := c.roundTrip(req, func(req *http.Request) (*http.Response, error) {
+		return httpClient.Do(req.WithContext(ctx))
+	})
 	if err != nil {
+		release()
 		if strings.Contains(err.Error(), "connection refused") {
-			return nil, ErrConnectionRefused
+			err = ErrConnectionRefused
+		} else {
+			err = chooseError(ctx, err)
 		}
-
-		return nil, chooseError(ctx, err)
+		call.done(0, err)
+		return nil, err
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
-		return nil, newError(resp)
+		defer release()
+		err := newError(resp)
+		call.done(resp.StatusCode, err)
+		return nil, err
 	}
+	call.done(resp.StatusCode, nil)
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
 	return resp, nil
 }
 
+// requestClient returns the HTTP client for sending requests to the daemon,
+// along with the URL of the given path. Socket endpoints share a single
+// client, so their connections are reused just like TCP ones.
+func (c *Client) requestClient(path string) (*http.Client, string) {
+	if c.socketEndpoint() {
+		if c.unixHTTPClient == nil {
+			// the client wasn't created with one of the constructors
+			return c.newUnixHTTPClient(), c.getFakeUnixURL(path)
+		}
+		return c.unixHTTPClient, c.getFakeUnixURL(path)
+	}
+	return c.HTTPClient, c.getURL(path)
+}
+
 type streamOptions struct {
 	setRawTerminal bool
 	rawJSONStream  bool
@@ -473,6 +587,9 @@ type streamOptions struct {
 	// arrives
 	inactivityTimeout time.Duration
 	context           context.Context
+	// callOptions are the options of the client method making the call,
+	// reported in the plan of dry runs
+	callOptions interface{}
 }
 
 // if error in context, return that instead of generic http error
@@ -485,17 +602,25 @@ func chooseError(ctx context.Context, err error) error {
 	}
 }
 
-func (c *Client) stream(method, path string, streamOptions streamOptions) error {
+func (c *Client) stream(method, path string, streamOptions streamOptions) (err error) {
+	if plan := c.planOf(method, path); plan != nil {
+		plan.add(method, path, streamOptions.callOptions, nil)
+		return nil
+	}
 	if (method == "POST" || method == "PUT") && streamOptions.in == nil {
 		streamOptions.in = bytes.NewReader(nil)
 	}
-	if path != "/version" && !c.SkipServerVersionCheck && c.expectedAPIVersion == nil {
-		err := c.checkAPIVersion()
-		if err != nil {
+	ctx := streamOptions.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if path != "/version" {
+		if err := c.ensureAPIVersion(ctx); err != nil {
 			return err
 		}
 	}
-	req, err := http.NewRequest(method, c.getURL(path), streamOptions.in)
+	httpClient, u := c.requestClient(path)
+	req, err := http.NewRequest(method, u, streamOptions.in)
 	if err != nil {
 		return err
 	}
@@ -506,9 +631,6 @@ func (c *Client) stream(method, path string, streamOptions streamOptions) error
 	for key, val := range streamOptions.headers {
 		req.Header.Set(key, val)
 	}
-	var resp *http.Response
-	protocol := c.endpointURL.Scheme
-	address := c.endpointURL.Path
 	if streamOptions.stdout == nil {
 		streamOptions.stdout = ioutil.Discard
 	}
@@ -517,61 +639,53 @@ func (c *Client) stream(method, path string, streamOptions streamOptions) error
 	}
 
 	// make a sub-context so that our active cancellation does not affect parent
-	ctx := streamOptions.context
-	if ctx == nil {
-		ctx = context.Background()
-	}
 	subCtx, cancelRequest := context.WithCancel(ctx)
 	defer cancelRequest()
 
-	if protocol == "unix" {
-		dial, err := c.Dialer.Dial(protocol, address)
-		if err != nil {
-			return err
-		}
-		go func() {
-			select {
-			case <-subCtx.Done():
-				dial.Close()
-			}
-		}()
-		breader := bufio.NewReader(dial)
-		err = req.Write(dial)
-		if err != nil {
-			return chooseError(subCtx, err)
-		}
-
-		// ReadResponse may hang if server does not replay
-		if streamOptions.timeout > 0 {
-			dial.SetDeadline(time.Now().Add(streamOptions.timeout))
-		}
-
-		if resp, err = http.ReadResponse(breader, req); err != nil {
-			// Cancel timeout for future I/O operations
-			if streamOptions.timeout > 0 {
-				dial.SetDeadline(time.Time{})
-			}
-			if strings.Contains(err.Error(), "connection refused") {
-				return ErrConnectionRefused
-			}
-
-			return chooseError(subCtx, err)
+	release, err := c.currentLimiter().acquire(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	call := c.startCall(method, path, true)
+	var statusCode int
+	defer func() { call.done(statusCode, err) }()
+	req.Body = call.countSent(req.Body)
+
+	// the request may hang if the server does not reply
+	var timedOut uint32
+	var timer *time.Timer
+	if streamOptions.timeout > 0 {
+		timer = time.AfterFunc(streamOptions.timeout, func() {
+			atomic.StoreUint32(&timedOut, 1)
+			cancelRequest()
+		})
+	}
+	resp, err := c.roundTrip(req, func(req *http.Request) (*http.Response, error) {
+		return httpClient.Do(req.WithContext(subCtx))
+	})
+	if timer != nil && !timer.Stop() && atomic.LoadUint32(&timedOut) != 0 {
+		if err == nil {
+			resp.Body.Close()
 		}
-	} else {
-		if resp, err = ctxhttp.Do(subCtx, c.HTTPClient, req); err != nil {
-			if strings.Contains(err.Error(), "connection refused") {
-				return ErrConnectionRefused
-			}
-			return chooseError(subCtx, err)
+		return &streamTimeoutError{timeout: streamOptions.timeout}
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "connection refused") {
+			return ErrConnectionRefused
 		}
+		return chooseError(subCtx, err)
 	}
 	defer resp.Body.Close()
+	statusCode = resp.StatusCode
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
 		return newError(resp)
 	}
+	resp.Body = call.countReceived(resp.Body)
 	var canceled uint32
 	if streamOptions.inactivityTimeout > 0 {
-		ch := handleInactivityTimeout(&streamOptions, cancelRequest, &canceled)
+		ch := handleInactivityTimeout(streamOptions.inactivityTimeout, &streamOptions.stdout, &streamOptions.stderr, cancelRequest, &canceled)
 		defer close(ch)
 	}
 	err = handleStreamResponse(resp, &streamOptions)
@@ -584,6 +698,24 @@ func (c *Client) stream(method, path string, streamOptions streamOptions) error
 	return nil
 }
 
+// streamTimeoutError is returned when the daemon doesn't reply to a streaming
+// call within its timeout.
+type streamTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *streamTimeoutError) Error() string {
+	return fmt.Sprintf("timeout awaiting response headers after %s", e.timeout)
+}
+
+func (e *streamTimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *streamTimeoutError) Temporary() bool {
+	return true
+}
+
 func handleStreamResponse(resp *http.Response, streamOptions *streamOptions) error {
 	var err error
 	if !streamOptions.useJSONDecoder && resp.Header.Get("Content-Type") != "application/json" {
@@ -636,17 +768,17 @@ func (p *proxyWriter) Write(data []byte) (int, error) {
 	return p.Writer.Write(data)
 }
 
-func handleInactivityTimeout(options *streamOptions, cancelRequest func(), canceled *uint32) chan<- struct{} {
+func handleInactivityTimeout(inactivityTimeout time.Duration, stdout, stderr *io.Writer, cancelRequest func(), canceled *uint32) chan<- struct{} {
 	done := make(chan struct{})
-	proxyStdout := &proxyWriter{Writer: options.stdout}
-	proxyStderr := &proxyWriter{Writer: options.stderr}
-	options.stdout = proxyStdout
-	options.stderr = proxyStderr
+	proxyStdout := &proxyWriter{Writer: *stdout}
+	proxyStderr := &proxyWriter{Writer: *stderr}
+	*stdout = proxyStdout
+	*stderr = proxyStderr
 	go func() {
 		var lastCallCount uint64
 		for {
 			select {
-			case <-time.After(options.inactivityTimeout):
+			case <-time.After(inactivityTimeout):
 			case <-done:
 				return
 			}
@@ -669,6 +801,13 @@ type hijackOptions struct {
 	stdout         io.Writer
 	stderr         io.Writer
 	data           interface{}
+	// Timeout with no data is received, it's reset every time new data
+	// arrives
+	inactivityTimeout time.Duration
+	context           context.Context
+	// callOptions are the options of the client method making the call,
+	// reported in the plan of dry runs
+	callOptions interface{}
 }
 
 // CloseWaiter is an interface with methods for closing the underlying resource
@@ -687,75 +826,62 @@ type closerFunc func() error
 func (c closerFunc) Close() error { return c() }
 
 func (c *Client) hijack(method, path string, hijackOptions hijackOptions) (CloseWaiter, error) {
-	if path != "/version" && !c.SkipServerVersionCheck && c.expectedAPIVersion == nil {
-		err := c.checkAPIVersion()
-		if err != nil {
-			return nil, err
-		}
-	}
-	var params io.Reader
-	if hijackOptions.data != nil {
-		buf, err := json.Marshal(hijackOptions.data)
-		if err != nil {
-			return nil, err
-		}
-		params = bytes.NewBuffer(buf)
+	ctx := hijackOptions.context
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	req, err := http.NewRequest(method, c.getURL(path), params)
+	hijackOptions.context = ctx
+	rwc, err := c.hijackConn(method, path, hijackOptions)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Connection", "Upgrade")
-	req.Header.Set("Upgrade", "tcp")
-	protocol := c.endpointURL.Scheme
-	address := c.endpointURL.Path
-	if protocol != "unix" {
-		protocol = "tcp"
-		address = c.endpointURL.Host
-	}
-	var dial net.Conn
-	if c.TLSConfig != nil && protocol != "unix" {
-		dial, err = tlsDialWithDialer(c.Dialer, protocol, address, c.TLSConfig)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		dial, err = c.Dialer.Dial(protocol, address)
-		if err != nil {
-			return nil, err
-		}
+
+	// make a sub-context so that our active cancellation does not affect
+	// parent, and close the connection once it's done; the session ends
+	// with the error reported by Wait
+	subCtx, cancelRequest := context.WithCancel(ctx)
+	go func() {
+		<-subCtx.Done()
+		rwc.Conn.Close()
+	}()
+
+	// Only copy if hijackOptions.stdout and/or hijackOptions.stderr is actually set.
+	// Otherwise, if the only stream you care about is stdin, your attach session
+	// will "hang" until the container terminates, even though you're not reading
+	// stdout/stderr
+	copyOutput := hijackOptions.stdout != nil || hijackOptions.stderr != nil
+	if hijackOptions.stdout == nil {
+		hijackOptions.stdout = ioutil.Discard
+	}
+	if hijackOptions.stderr == nil {
+		hijackOptions.stderr = ioutil.Discard
+	}
+	var canceled uint32
+	var inactivityDone chan<- struct{}
+	if hijackOptions.inactivityTimeout > 0 {
+		inactivityDone = handleInactivityTimeout(hijackOptions.inactivityTimeout, &hijackOptions.stdout, &hijackOptions.stderr, cancelRequest, &canceled)
 	}
 
 	errs := make(chan error, 1)
 	quit := make(chan struct{})
 	go func() {
-		clientconn := httputil.NewClientConn(dial, nil)
-		defer clientconn.Close()
-		clientconn.Do(req)
+		defer cancelRequest()
+		if inactivityDone != nil {
+			defer close(inactivityDone)
+		}
 		if hijackOptions.success != nil {
-			hijackOptions.success <- struct{}{}
-			<-hijackOptions.success
+			select {
+			case hijackOptions.success <- struct{}{}:
+				<-hijackOptions.success
+			case <-subCtx.Done():
+			}
 		}
-		rwc, br := clientconn.Hijack()
-		defer rwc.Close()
 
 		errChanOut := make(chan error, 1)
 		errChanIn := make(chan error, 2)
-		if hijackOptions.stdout == nil && hijackOptions.stderr == nil {
+		if !copyOutput {
 			close(errChanOut)
 		} else {
-			// Only copy if hijackOptions.stdout and/or hijackOptions.stderr is actually set.
-			// Otherwise, if the only stream you care about is stdin, your attach session
-			// will "hang" until the container terminates, even though you're not reading
-			// stdout/stderr
-			if hijackOptions.stdout == nil {
-				hijackOptions.stdout = ioutil.Discard
-			}
-			if hijackOptions.stderr == nil {
-				hijackOptions.stderr = ioutil.Discard
-			}
-
 			go func() {
 				defer func() {
 					if hijackOptions.in != nil {
@@ -768,9 +894,9 @@ func (c *Client) hijack(method, path string, hijackOptions hijackOptions) (Close
 
 				var err error
 				if hijackOptions.setRawTerminal {
-					_, err = io.Copy(hijackOptions.stdout, br)
+					_, err = io.Copy(hijackOptions.stdout, rwc)
 				} else {
-					_, err = stdcopy.StdCopy(hijackOptions.stdout, hijackOptions.stderr, br)
+					_, err = stdcopy.StdCopy(hijackOptions.stdout, hijackOptions.stderr, rwc)
 				}
 				errChanOut <- err
 			}()
@@ -782,46 +908,145 @@ func (c *Client) hijack(method, path string, hijackOptions hijackOptions) (Close
 				_, err = io.Copy(rwc, hijackOptions.in)
 			}
 			errChanIn <- err
-			rwc.(interface {
-				CloseWrite() error
-			}).CloseWrite()
+			rwc.CloseWrite()
 		}()
 
 		var errIn error
 		select {
 		case errIn = <-errChanIn:
 		case <-quit:
+		case <-subCtx.Done():
 		}
 
+		// the connection is closed once the context is done, so the
+		// output is over by then too
 		var errOut error
 		select {
 		case errOut = <-errChanOut:
 		case <-quit:
 		}
 
-		if errIn != nil {
-			errs <- errIn
-		} else {
-			errs <- errOut
+		closed := false
+		select {
+		case <-quit:
+			closed = true
+		default:
 		}
+		var err error
+		switch {
+		case atomic.LoadUint32(&canceled) != 0:
+			err = ErrInactivityTimeout
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		case closed:
+		case errIn != nil:
+			err = errIn
+		default:
+			err = errOut
+		}
+		rwc.closeWithError(err)
+		errs <- err
 	}()
 
+	var closeOnce sync.Once
 	return struct {
 		closerFunc
 		waiterFunc
 	}{
-		closerFunc(func() error { close(quit); return nil }),
+		closerFunc(func() error {
+			closeOnce.Do(func() {
+				close(quit)
+				cancelRequest()
+			})
+			return nil
+		}),
 		waiterFunc(func() error { return <-errs }),
 	}, nil
 }
 
+// hijackConn starts an attach or exec session, returning the raw connection
+// to the daemon.
+func (c *Client) hijackConn(method, path string, hijackOptions hijackOptions) (*HijackedConn, error) {
+	if plan := c.planOf(method, path); plan != nil {
+		plan.add(method, path, hijackOptions.callOptions, nil)
+		return newDryRunHijackedConn(hijackOptions.setRawTerminal), nil
+	}
+	ctx := hijackOptions.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if path != "/version" {
+		if err := c.ensureAPIVersion(ctx); err != nil {
+			return nil, err
+		}
+	}
+	var params io.Reader
+	if hijackOptions.data != nil {
+		buf, err := json.Marshal(hijackOptions.data)
+		if err != nil {
+			return nil, err
+		}
+		params = bytes.NewBuffer(buf)
+	}
+	u := c.getURL(path)
+	if c.socketEndpoint() {
+		u = c.getFakeUnixURL(path)
+	}
+	req, err := http.NewRequest(method, u, params)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Content-Type", "application/json")
+	release, err := c.currentLimiter().acquire(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	call := c.startCall(method, path, true)
+	conn, err := c.upgrade(ctx, req)
+	if err != nil {
+		release()
+		call.done(0, err)
+		return nil, err
+	}
+	conn.rawTerminal = hijackOptions.setRawTerminal
+	var once sync.Once
+	conn.release = func(err error) {
+		once.Do(func() {
+			release()
+			if call != nil {
+				call.sent = atomic.LoadInt64(&conn.bytesWritten)
+				call.received = atomic.LoadInt64(&conn.bytesRead)
+				call.done(http.StatusSwitchingProtocols, err)
+			}
+		})
+	}
+	return conn, nil
+}
+
+// socketEndpoint indicates whether the client sends its requests over a unix
+// socket, either local or reached through SSH, instead of using the
+// HTTPClient.
+func (c *Client) socketEndpoint() bool {
+	return c.endpointURL.Scheme == "unix" || c.endpointURL.Scheme == "ssh"
+}
+
+// dial opens a new connection to the unix socket of the Docker daemon,
+// either local or reached through SSH.
+func (c *Client) dial() (net.Conn, error) {
+	if c.endpointURL.Scheme == "ssh" {
+		return c.sshDialer.Dial(c.Dialer)
+	}
+	return c.Dialer.Dial("unix", c.endpointURL.Path)
+}
+
 func (c *Client) getURL(path string) string {
 	urlStr := strings.TrimRight(c.endpointURL.String(), "/")
-	if c.endpointURL.Scheme == "unix" {
+	if c.socketEndpoint() {
 		urlStr = ""
 	}
-	if c.requestedAPIVersion != nil {
-		return fmt.Sprintf("%s/v%s%s", urlStr, c.requestedAPIVersion, path)
+	if requestedAPIVersion := c.getRequestedAPIVersion(); requestedAPIVersion != nil {
+		return fmt.Sprintf("%s/v%s%s", urlStr, requestedAPIVersion, path)
 	}
 	return fmt.Sprintf("%s%s", urlStr, path)
 }
@@ -836,22 +1061,43 @@ func (c *Client) getFakeUnixURL(path string) string {
 	u.Host = "unix.sock" // Doesn't matter what this is - it's not used.
 	u.Path = ""
 	urlStr := strings.TrimRight(u.String(), "/")
-	if c.requestedAPIVersion != nil {
-		return fmt.Sprintf("%s/v%s%s", urlStr, c.requestedAPIVersion, path)
+	if requestedAPIVersion := c.getRequestedAPIVersion(); requestedAPIVersion != nil {
+		return fmt.Sprintf("%s/v%s%s", urlStr, requestedAPIVersion, path)
 	}
 	return fmt.Sprintf("%s%s", urlStr, path)
 }
 
 func (c *Client) initializeUnixClient() {
-	if c.endpointURL.Scheme != "unix" {
+	if !c.socketEndpoint() {
 		return
 	}
-	socketPath := c.endpointURL.Path
-	tr := cleanhttp.DefaultTransport()
+	c.unixHTTPClient = c.newUnixHTTPClient()
+}
+
+// newUnixHTTPClient returns an HTTP client sending its requests over the
+// socket of the Docker daemon.
+func (c *Client) newUnixHTTPClient() *http.Client {
+	tr := defaultPooledTransport()
 	tr.Dial = func(network, addr string) (net.Conn, error) {
-		return c.Dialer.Dial("unix", socketPath)
+		return c.dial()
 	}
-	c.unixHTTPClient = &http.Client{Transport: tr}
+	return &http.Client{Transport: tr}
+}
+
+// maxIdleConnsPerHost is the number of idle connections to the daemon kept
+// open for reuse. All the requests go to the same host, so it's high enough
+// for clients running many short streaming calls concurrently.
+const maxIdleConnsPerHost = 64
+
+// defaultPooledTransport returns the transport used by the clients created
+// without an HTTP client. Unlike the transport returned by cleanhttp, it keeps
+// idle connections open, so they're reused by the next calls.
+func defaultPooledTransport() *http.Transport {
+	tr := cleanhttp.DefaultTransport()
+	tr.DisableKeepAlives = false
+	tr.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	tr.IdleConnTimeout = 90 * time.Second
+	return tr
 }
 
 type jsonMessage struct {
@@ -930,17 +1176,27 @@ func addQueryStringValue(items url.Values, key string, v reflect.Value) {
 }
 
 // Error represents failures in the API. It represents a failure from the API.
+//
+// When the daemon reports the failure as a JSON document in the form
+// {"message": "..."}, Message contains only the message from the document.
 type Error struct {
 	Status  int
 	Message string
 }
 
 func newError(resp *http.Response) *Error {
+	type errMsg struct {
+		Message string `json:"message"`
+	}
 	defer resp.Body.Close()
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return &Error{Status: resp.StatusCode, Message: fmt.Sprintf("cannot read body, err: %v", err)}
 	}
+	var emsg errMsg
+	if json.Unmarshal(data, &emsg) == nil && emsg.Message != "" {
+		return &Error{Status: resp.StatusCode, Message: emsg.Message}
+	}
 	return &Error{Status: resp.StatusCode, Message: string(data)}
 }
 
@@ -956,12 +1212,17 @@ func parseEndpoint(endpoint string, tls bool) (*url.URL, error) {
 	if err != nil {
 		return nil, ErrInvalidEndpoint
 	}
-	if tls && u.Scheme != "unix" {
+	if tls && u.Scheme != "unix" && u.Scheme != "ssh" {
 		u.Scheme = "https"
 	}
 	switch u.Scheme {
 	case "unix":
 		return u, nil
+	case "ssh":
+		if u.Host == "" {
+			return nil, ErrInvalidEndpoint
+		}
+		return u, nil
 	case "http", "https", "tcp":
 		_, port, err := net.SplitHostPort(u.Host)
 		if err != nil {
@@ -990,9 +1251,10 @@ func parseEndpoint(endpoint string, tls bool) (*url.URL, error) {
 }
 
 type dockerEnv struct {
-	dockerHost      string
-	dockerTLSVerify bool
-	dockerCertPath  string
+	dockerHost       string
+	dockerTLSVerify  bool
+	dockerCertPath   string
+	dockerAPIVersion string
 }
 
 func getDockerEnv() (*dockerEnv, error) {
@@ -1021,9 +1283,10 @@ func getDockerEnv() (*dockerEnv, error) {
 		}
 	}
 	return &dockerEnv{
-		dockerHost:      dockerHost,
-		dockerTLSVerify: dockerTLSVerify,
-		dockerCertPath:  dockerCertPath,
+		dockerHost:       dockerHost,
+		dockerTLSVerify:  dockerTLSVerify,
+		dockerCertPath:   dockerCertPath,
+		dockerAPIVersion: os.Getenv("DOCKER_API_VERSION"),
 	}, nil
 }
 
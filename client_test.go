@@ -6,7 +6,9 @@ package docker
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -19,10 +21,9 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
-
-	"golang.org/x/net/context"
 )
 
 func TestNewAPIClient(t *testing.T) {
@@ -630,6 +631,64 @@ func TestClientDoContextCancel(t *testing.T) {
 	}
 }
 
+func TestClientWithContextVariantsDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	calls := map[string]func(ctx context.Context) error{
+		"PingWithContext": client.PingWithContext,
+		"InfoWithContext": func(ctx context.Context) error {
+			_, err := client.InfoWithContext(ctx)
+			return err
+		},
+		"InspectContainerWithContext": func(ctx context.Context) error {
+			_, err := client.InspectContainerWithContext(ctx, "abc")
+			return err
+		},
+		"StopContainerWithContext": func(ctx context.Context) error {
+			return client.StopContainerWithContext(ctx, "abc", 10)
+		},
+		"WaitContainerWithContext": func(ctx context.Context) error {
+			_, err := client.WaitContainerWithContext(ctx, "abc")
+			return err
+		},
+		"ResizeExecTTYWithContext": func(ctx context.Context) error {
+			return client.ResizeExecTTYWithContext(ctx, "abc", 10, 20)
+		},
+		"RemoveImageWithContext": func(ctx context.Context) error {
+			return client.RemoveImageWithContext(ctx, "busybox")
+		},
+		"ListNetworksWithContext": func(ctx context.Context) error {
+			_, err := client.ListNetworksWithContext(ctx)
+			return err
+		},
+		"InspectTaskWithContext": func(ctx context.Context) error {
+			_, err := client.InspectTaskWithContext(ctx, "abc")
+			return err
+		},
+		"RemoveVolumeWithContext": func(ctx context.Context) error {
+			return client.RemoveVolumeWithContext(ctx, "data")
+		},
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := call(ctx)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("%s: wrong error. Want %#v. Got %#v.", name, context.DeadlineExceeded, err)
+		}
+	}
+}
+
 func TestClientStreamTimeoutUnixSocket(t *testing.T) {
 	srv, cleanup, err := newUnixServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		for i := 0; i < 5; i++ {
@@ -666,6 +725,365 @@ func TestClientStreamTimeoutUnixSocket(t *testing.T) {
 	}
 }
 
+func TestClientStreamReusesUnixSocketConnections(t *testing.T) {
+	var conns int32
+	srv, cleanup, err := newUnixServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"read":"2015-01-08T22:57:31.547920715Z"}`)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	client, err := NewClient("unix://" + srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		var w bytes.Buffer
+		err = client.stream("GET", "/containers/c/stats?stream=false", streamOptions{
+			rawJSONStream:  true,
+			useJSONDecoder: true,
+			stdout:         &w,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("stream: wrong number of connections. Want 1. Got %d.", n)
+	}
+}
+
+func TestClientStreamClientTimeoutUnixSocket(t *testing.T) {
+	srv, cleanup, err := newUnixServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "abc\n")
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		time.Sleep(500 * time.Millisecond)
+		fmt.Fprint(w, "def\n")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	srv.Start()
+	defer srv.Close()
+	client, err := NewClient("unix://" + srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetTimeout(100 * time.Millisecond)
+	var w bytes.Buffer
+	err = client.stream("GET", "/containers/c/logs", streamOptions{
+		setRawTerminal: true,
+		stdout:         &w,
+	})
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Fatalf("expected timeout error, got: %#v", err)
+	}
+}
+
+func TestClientStreamHeaderTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.stream("GET", "/containers/c/logs", streamOptions{
+		setRawTerminal: true,
+		timeout:        50 * time.Millisecond,
+	})
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Fatalf("expected timeout error, got: %#v", err)
+	}
+}
+
+// newWedgedHijackServer returns a server that upgrades the connection, sends
+// some output and then hangs until the client closes the connection, which is
+// signaled on the returned channel. Clients must keep their input open, as
+// closing it also ends the session.
+func newWedgedHijackServer(t *testing.T) (*httptest.Server, <-chan struct{}) {
+	closed := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\nabc\n")
+		rw.Flush()
+		io.Copy(ioutil.Discard, conn)
+		closed <- struct{}{}
+	}))
+	return srv, closed
+}
+
+func waitHijackClosed(t *testing.T, closed <-chan struct{}) {
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("the connection wasn't closed")
+	}
+}
+
+func TestClientHijackInactivityTimeout(t *testing.T) {
+	srv, closed := newWedgedHijackServer(t)
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	var w bytes.Buffer
+	err = client.AttachToContainer(AttachToContainerOptions{
+		Container:         "a123456",
+		InputStream:       stdin,
+		OutputStream:      &w,
+		Stdout:            true,
+		Stream:            true,
+		RawTerminal:       true,
+		InactivityTimeout: 100 * time.Millisecond,
+	})
+	if err != ErrInactivityTimeout {
+		t.Fatalf("expected %s, got: %v", ErrInactivityTimeout, err)
+	}
+	expected := "abc\n"
+	result := w.String()
+	if result != expected {
+		t.Fatalf("expected stream result %q, got: %q", expected, result)
+	}
+	waitHijackClosed(t, closed)
+}
+
+func TestClientHijackContextCancel(t *testing.T) {
+	srv, closed := newWedgedHijackServer(t)
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	var w bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	err = client.StartExec("e123456", StartExecOptions{
+		InputStream:  stdin,
+		OutputStream: &w,
+		RawTerminal:  true,
+		Context:      ctx,
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected %s, got: %v", context.Canceled, err)
+	}
+	expected := "abc\n"
+	result := w.String()
+	if result != expected {
+		t.Fatalf("expected stream result %q, got: %q", expected, result)
+	}
+	waitHijackClosed(t, closed)
+}
+
+func TestClientHijackContextDeadlineBlockedInput(t *testing.T) {
+	srv, closed := newWedgedHijackServer(t)
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = client.AttachToContainer(AttachToContainerOptions{
+		Container:   "a123456",
+		InputStream: stdin,
+		Stdin:       true,
+		Stream:      true,
+		Context:     ctx,
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %s, got: %v", context.DeadlineExceeded, err)
+	}
+	waitHijackClosed(t, closed)
+}
+
+func TestClientHijackCloseTearsDownConnection(t *testing.T) {
+	srv, closed := newWedgedHijackServer(t)
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	cw, err := client.AttachToContainerNonBlocking(AttachToContainerOptions{
+		Container:    "a123456",
+		InputStream:  stdin,
+		OutputStream: ioutil.Discard,
+		Stdout:       true,
+		Stream:       true,
+		RawTerminal:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Wait(); err != nil {
+		t.Fatalf("expected <nil> after Close, got: %v", err)
+	}
+	waitHijackClosed(t, closed)
+}
+
+// newSlowVersionServer returns a server reporting the API version stored in
+// version, slowly enough for concurrent calls to overlap, and counting the
+// requests to /version.
+func newSlowVersionServer(version *atomic.Value, versionCalls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/version") {
+			atomic.AddInt32(versionCalls, 1)
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprintf(w, `{"ApiVersion":%q}`, version.Load().(string))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+}
+
+func TestClientAPIVersionDetectionConcurrent(t *testing.T) {
+	var version atomic.Value
+	version.Store("1.24")
+	var versionCalls int32
+	srv := newSlowVersionServer(&version, &versionCalls)
+	defer srv.Close()
+	client, err := NewVersionedClient(srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				client.versionedAuthConfigs(AuthConfigurations{})
+				return
+			}
+			if _, err := client.ListContainers(ListContainersOptions{}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&versionCalls); n != 1 {
+		t.Errorf("API version detection: wrong number of requests to /version. Want 1. Got %d.", n)
+	}
+	if v := client.getExpectedAPIVersion().String(); v != "1.24" {
+		t.Errorf("API version detection: wrong version. Want %q. Got %q.", "1.24", v)
+	}
+}
+
+func TestClientAPIVersionDetectionContext(t *testing.T) {
+	var version atomic.Value
+	version.Store("1.24")
+	var versionCalls int32
+	srv := newSlowVersionServer(&version, &versionCalls)
+	defer srv.Close()
+	client, err := NewVersionedClient(srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.ListContainers(ListContainersOptions{Context: ctx})
+		errs <- err
+	}()
+	// wait for the first call to start the detection
+	for atomic.LoadInt32(&versionCalls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := client.ListContainers(ListContainersOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != context.DeadlineExceeded {
+		t.Errorf("ListContainers: wrong error. Want %#v. Got %#v.", context.DeadlineExceeded, err)
+	}
+	if n := atomic.LoadInt32(&versionCalls); n != 2 {
+		t.Errorf("API version detection: wrong number of requests to /version. Want 2. Got %d.", n)
+	}
+}
+
+func TestClientRefreshAPIVersion(t *testing.T) {
+	var version atomic.Value
+	version.Store("1.23")
+	var versionCalls int32
+	srv := newSlowVersionServer(&version, &versionCalls)
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.EnableAPIVersionNegotiation()
+	if _, err := client.ListContainers(ListContainersOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if v := client.getRequestedAPIVersion().String(); v != "1.23" {
+		t.Errorf("EnableAPIVersionNegotiation: wrong version. Want %q. Got %q.", "1.23", v)
+	}
+	version.Store("1.24")
+	if _, err := client.ListContainers(ListContainersOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if v := client.getRequestedAPIVersion().String(); v != "1.23" {
+		t.Errorf("ListContainers: version changed without a refresh. Want %q. Got %q.", "1.23", v)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.RefreshAPIVersion(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := client.getRequestedAPIVersion().String(); v != "1.24" {
+		t.Errorf("RefreshAPIVersion: wrong version. Want %q. Got %q.", "1.24", v)
+	}
+	if v := client.getServerAPIVersion().String(); v != "1.24" {
+		t.Errorf("RefreshAPIVersion: wrong server version. Want %q. Got %q.", "1.24", v)
+	}
+	if n := atomic.LoadInt32(&versionCalls); n != 2 {
+		t.Errorf("RefreshAPIVersion: wrong number of requests to /version. Want 2. Got %d.", n)
+	}
+}
+
 func TestClientDoConcurrentStress(t *testing.T) {
 	var reqs []*http.Request
 	var mu sync.Mutex
@@ -5,6 +5,7 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,7 +17,6 @@ import (
 	"time"
 
 	"github.com/docker/go-units"
-	"golang.org/x/net/context"
 )
 
 // ErrContainerAlreadyExists is the error returned by CreateContainer when the
@@ -60,6 +60,7 @@ type APIMount struct {
 type APIContainers struct {
 	ID         string            `json:"Id" yaml:"Id"`
 	Image      string            `json:"Image,omitempty" yaml:"Image,omitempty"`
+	ImageID    string            `json:"ImageID,omitempty" yaml:"ImageID,omitempty"`
 	Command    string            `json:"Command,omitempty" yaml:"Command,omitempty"`
 	Created    int64             `json:"Created,omitempty" yaml:"Created,omitempty"`
 	State      string            `json:"State,omitempty" yaml:"State,omitempty"`
@@ -414,6 +415,12 @@ type Container struct {
 	RestartCount int `json:"RestartCount,omitempty" yaml:"RestartCount,omitempty"`
 
 	AppArmorProfile string `json:"AppArmorProfile,omitempty" yaml:"AppArmorProfile,omitempty"`
+
+	// SizeRw is the size of the files created or changed by the container,
+	// and SizeRootFs the total size of its files. They're reported only
+	// when sizes are requested.
+	SizeRw     int64 `json:"SizeRw,omitempty" yaml:"SizeRw,omitempty"`
+	SizeRootFs int64 `json:"SizeRootFs,omitempty" yaml:"SizeRootFs,omitempty"`
 }
 
 // UpdateContainerOptions specify parameters to the UpdateContainer function.
@@ -439,11 +446,16 @@ type UpdateContainerOptions struct {
 // See https://goo.gl/Y6fXUy for more details.
 func (c *Client) UpdateContainer(id string, opts UpdateContainerOptions) error {
 	resp, err := c.do("POST", fmt.Sprintf("/containers/"+id+"/update"), doOptions{
-		data:      opts,
-		forceJSON: true,
-		context:   opts.Context,
+		data:        opts,
+		forceJSON:   true,
+		context:     opts.Context,
+		idempotent:  true,
+		callOptions: opts,
 	})
 	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return &NoSuchContainer{ID: id}
+		}
 		return err
 	}
 	defer resp.Body.Close()
@@ -467,9 +479,13 @@ type RenameContainerOptions struct {
 // See https://goo.gl/laSOIy for more details.
 func (c *Client) RenameContainer(opts RenameContainerOptions) error {
 	resp, err := c.do("POST", fmt.Sprintf("/containers/"+opts.ID+"/rename?%s", queryString(opts)), doOptions{
-		context: opts.Context,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return &NoSuchContainer{ID: opts.ID}
+		}
 		return err
 	}
 	resp.Body.Close()
@@ -480,17 +496,22 @@ func (c *Client) RenameContainer(opts RenameContainerOptions) error {
 //
 // See https://goo.gl/RdIq0b for more details.
 func (c *Client) InspectContainer(id string) (*Container, error) {
+	return c.InspectContainerWithContext(context.Background(), id)
+}
+
+// InspectContainerWithContext returns information about a container by its ID.
+// The context can be used to cancel the inspection.
+func (c *Client) InspectContainerWithContext(ctx context.Context, id string) (*Container, error) {
 	path := "/containers/" + id + "/json"
-	resp, err := c.do("GET", path, doOptions{})
+	body, err := c.inspect(ctx, "container", id, path)
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchContainer{ID: id}
 		}
 		return nil, err
 	}
-	defer resp.Body.Close()
 	var container Container
-	if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
+	if err := json.Unmarshal(body, &container); err != nil {
 		return nil, err
 	}
 	return &container, nil
@@ -500,8 +521,14 @@ func (c *Client) InspectContainer(id string) (*Container, error) {
 //
 // See https://goo.gl/9GsTIF for more details.
 func (c *Client) ContainerChanges(id string) ([]Change, error) {
+	return c.ContainerChangesWithContext(context.Background(), id)
+}
+
+// ContainerChangesWithContext returns changes in the filesystem of the given
+// container. The context can be used to cancel the request.
+func (c *Client) ContainerChangesWithContext(ctx context.Context, id string) ([]Change, error) {
 	path := "/containers/" + id + "/changes"
-	resp, err := c.do("GET", path, doOptions{})
+	resp, err := c.do("GET", path, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchContainer{ID: id}
@@ -535,6 +562,16 @@ type CreateContainerOptions struct {
 //
 // See https://goo.gl/WxQzrr for more details.
 func (c *Client) CreateContainer(opts CreateContainerOptions) (*Container, error) {
+	if opts.Config != nil && opts.Config.Healthcheck != nil {
+		if err := c.requireFeature(FeatureHealthcheck); err != nil {
+			return nil, err
+		}
+	}
+	if opts.HostConfig != nil && opts.HostConfig.AutoRemove {
+		if err := c.requireFeature(FeatureAutoRemove); err != nil {
+			return nil, err
+		}
+	}
 	path := "/containers/create?" + queryString(opts)
 	resp, err := c.do(
 		"POST",
@@ -549,7 +586,8 @@ func (c *Client) CreateContainer(opts CreateContainerOptions) (*Container, error
 				opts.HostConfig,
 				opts.NetworkingConfig,
 			},
-			context: opts.Context,
+			context:     opts.Context,
+			callOptions: opts,
 		},
 	)
 
@@ -722,13 +760,17 @@ type NetworkingConfig struct {
 //
 // See https://goo.gl/MrBAJv for more details.
 func (c *Client) StartContainer(id string, hostConfig *HostConfig) error {
-	var opts doOptions
+	return c.StartContainerWithContext(context.Background(), id, hostConfig)
+}
+
+// StartContainerWithContext starts a container, returning an error in case of
+// failure. The context can be used to cancel the request.
+func (c *Client) StartContainerWithContext(ctx context.Context, id string, hostConfig *HostConfig) error {
+	opts := doOptions{callOptions: hostConfig, context: ctx}
 	path := "/containers/" + id + "/start"
-	if c.serverAPIVersion == nil {
-		c.checkAPIVersion()
-	}
-	if c.serverAPIVersion != nil && c.serverAPIVersion.LessThan(apiVersion124) {
-		opts = doOptions{data: hostConfig, forceJSON: true}
+	if serverAPIVersion := c.getServerAPIVersion(); serverAPIVersion != nil && serverAPIVersion.LessThan(apiVersion124) {
+		opts.data = hostConfig
+		opts.forceJSON = true
 	}
 	resp, err := c.do("POST", path, opts)
 	if err != nil {
@@ -749,8 +791,15 @@ func (c *Client) StartContainer(id string, hostConfig *HostConfig) error {
 //
 // See https://goo.gl/USqsFt for more details.
 func (c *Client) StopContainer(id string, timeout uint) error {
+	return c.StopContainerWithContext(context.Background(), id, timeout)
+}
+
+// StopContainerWithContext stops a container, killing it after the given
+// timeout (in seconds). The context only cancels the request: once the daemon
+// got it, it keeps stopping the container.
+func (c *Client) StopContainerWithContext(ctx context.Context, id string, timeout uint) error {
 	path := fmt.Sprintf("/containers/%s/stop?t=%d", id, timeout)
-	resp, err := c.do("POST", path, doOptions{})
+	resp, err := c.do("POST", path, doOptions{idempotent: true, context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchContainer{ID: id}
@@ -769,8 +818,15 @@ func (c *Client) StopContainer(id string, timeout uint) error {
 //
 // See https://goo.gl/QzsDnz for more details.
 func (c *Client) RestartContainer(id string, timeout uint) error {
+	return c.RestartContainerWithContext(context.Background(), id, timeout)
+}
+
+// RestartContainerWithContext stops a container, killing it after the given
+// timeout (in seconds), and starts it again. The context only cancels the
+// request, not the restart of the container.
+func (c *Client) RestartContainerWithContext(ctx context.Context, id string, timeout uint) error {
 	path := fmt.Sprintf("/containers/%s/restart?t=%d", id, timeout)
-	resp, err := c.do("POST", path, doOptions{})
+	resp, err := c.do("POST", path, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchContainer{ID: id}
@@ -785,8 +841,14 @@ func (c *Client) RestartContainer(id string, timeout uint) error {
 //
 // See https://goo.gl/OF7W9X for more details.
 func (c *Client) PauseContainer(id string) error {
+	return c.PauseContainerWithContext(context.Background(), id)
+}
+
+// PauseContainerWithContext pauses the given container. The context can be used
+// to cancel the request.
+func (c *Client) PauseContainerWithContext(ctx context.Context, id string) error {
 	path := fmt.Sprintf("/containers/%s/pause", id)
-	resp, err := c.do("POST", path, doOptions{})
+	resp, err := c.do("POST", path, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchContainer{ID: id}
@@ -801,8 +863,14 @@ func (c *Client) PauseContainer(id string) error {
 //
 // See https://goo.gl/7dwyPA for more details.
 func (c *Client) UnpauseContainer(id string) error {
+	return c.UnpauseContainerWithContext(context.Background(), id)
+}
+
+// UnpauseContainerWithContext unpauses the given container. The context can be
+// used to cancel the request.
+func (c *Client) UnpauseContainerWithContext(ctx context.Context, id string) error {
 	path := fmt.Sprintf("/containers/%s/unpause", id)
-	resp, err := c.do("POST", path, doOptions{})
+	resp, err := c.do("POST", path, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchContainer{ID: id}
@@ -826,13 +894,19 @@ type TopResult struct {
 //
 // See https://goo.gl/Rb46aY for more details.
 func (c *Client) TopContainer(id string, psArgs string) (TopResult, error) {
+	return c.TopContainerWithContext(context.Background(), id, psArgs)
+}
+
+// TopContainerWithContext returns processes running inside a container. The
+// context can be used to cancel the request.
+func (c *Client) TopContainerWithContext(ctx context.Context, id string, psArgs string) (TopResult, error) {
 	var args string
 	var result TopResult
 	if psArgs != "" {
 		args = fmt.Sprintf("?ps_args=%s", psArgs)
 	}
 	path := fmt.Sprintf("/containers/%s/top%s", id, args)
-	resp, err := c.do("GET", path, doOptions{})
+	resp, err := c.do("GET", path, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return result, &NoSuchContainer{ID: id}
@@ -1060,7 +1134,7 @@ type KillContainerOptions struct {
 // See https://goo.gl/hkS9i8 for more details.
 func (c *Client) KillContainer(opts KillContainerOptions) error {
 	path := "/containers/" + opts.ID + "/kill" + "?" + queryString(opts)
-	resp, err := c.do("POST", path, doOptions{context: opts.Context})
+	resp, err := c.do("POST", path, doOptions{context: opts.Context, callOptions: opts})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchContainer{ID: opts.ID}
@@ -1092,8 +1166,16 @@ type RemoveContainerOptions struct {
 //
 // See https://goo.gl/RQyX62 for more details.
 func (c *Client) RemoveContainer(opts RemoveContainerOptions) error {
-	path := "/containers/" + opts.ID + "?" + queryString(opts)
-	resp, err := c.do("DELETE", path, doOptions{context: opts.Context})
+	id := opts.ID
+	if opts.Force {
+		container, err := c.guard(opts.Context, "RemoveContainer", "container", opts.ID)
+		if err != nil {
+			return err
+		}
+		id = container.ID
+	}
+	path := "/containers/" + id + "?" + queryString(opts)
+	resp, err := c.do("DELETE", path, doOptions{context: opts.Context, callOptions: opts})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchContainer{ID: opts.ID}
@@ -1104,6 +1186,45 @@ func (c *Client) RemoveContainer(opts RemoveContainerOptions) error {
 	return nil
 }
 
+// PruneContainersOptions specify parameters to the PruneContainers function.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/ContainerPrune for more details.
+type PruneContainersOptions struct {
+	// Filters restrict the containers to remove, by "until" (a timestamp
+	// or a duration) and by "label" ("key" or "key=value", "label!" to
+	// exclude containers).
+	Filters map[string][]string
+	Context context.Context
+}
+
+// PruneContainersResults specify results from the PruneContainers function.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/ContainerPrune for more details.
+type PruneContainersResults struct {
+	ContainersDeleted []string
+	SpaceReclaimed    int64
+}
+
+// PruneContainers deletes containers which are stopped.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/ContainerPrune for more details.
+func (c *Client) PruneContainers(opts PruneContainersOptions) (*PruneContainersResults, error) {
+	if err := c.requireFeature(FeaturePrune); err != nil {
+		return nil, err
+	}
+	path := "/containers/prune?" + queryString(opts)
+	resp, err := c.do("POST", path, doOptions{context: opts.Context, callOptions: opts})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var results PruneContainersResults
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
+
 // UploadToContainerOptions is the set of options that can be used when
 // uploading an archive into a container.
 //
@@ -1123,8 +1244,9 @@ func (c *Client) UploadToContainer(id string, opts UploadToContainerOptions) err
 	url := fmt.Sprintf("/containers/%s/archive?", id) + queryString(opts)
 
 	return c.stream("PUT", url, streamOptions{
-		in:      opts.InputStream,
-		context: opts.Context,
+		in:          opts.InputStream,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 }
 
@@ -1153,7 +1275,8 @@ func (c *Client) DownloadFromContainer(id string, opts DownloadFromContainerOpti
 	})
 }
 
-// CopyFromContainerOptions has been DEPRECATED, please use DownloadFromContainerOptions along with DownloadFromContainer.
+// CopyFromContainerOptions has been DEPRECATED, please use DownloadFromContainerOptions along with DownloadFromContainer,
+// or CopyFromContainerToHost.
 //
 // See https://goo.gl/R2jevW for more details.
 type CopyFromContainerOptions struct {
@@ -1170,10 +1293,7 @@ func (c *Client) CopyFromContainer(opts CopyFromContainerOptions) error {
 	if opts.Container == "" {
 		return &NoSuchContainer{ID: opts.Container}
 	}
-	if c.serverAPIVersion == nil {
-		c.checkAPIVersion()
-	}
-	if c.serverAPIVersion != nil && c.serverAPIVersion.GreaterThanOrEqualTo(apiVersion124) {
+	if serverAPIVersion := c.getServerAPIVersion(); serverAPIVersion != nil && serverAPIVersion.GreaterThanOrEqualTo(apiVersion124) {
 		return errors.New("go-dockerclient: CopyFromContainer is no longer available in Docker >= 1.12, use DownloadFromContainer instead")
 	}
 	url := fmt.Sprintf("/containers/%s/copy", opts.Container)
@@ -1193,11 +1313,18 @@ func (c *Client) CopyFromContainer(opts CopyFromContainerOptions) error {
 }
 
 // WaitContainer blocks until the given container stops, return the exit code
-// of the container status.
+// of the container status. WaitContainerWithOptions supports other conditions,
+// and waiting for containers that are not started yet.
 //
 // See https://goo.gl/Gc1rge for more details.
 func (c *Client) WaitContainer(id string) (int, error) {
-	resp, err := c.do("POST", "/containers/"+id+"/wait", doOptions{})
+	return c.WaitContainerWithContext(context.Background(), id)
+}
+
+// WaitContainerWithContext blocks until the given container stops, returning
+// the exit code of the container status, or until the context is done.
+func (c *Client) WaitContainerWithContext(ctx context.Context, id string) (int, error) {
+	resp, err := c.do("POST", "/containers/"+id+"/wait", doOptions{idempotent: true, context: ctx, stream: true})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return 0, &NoSuchContainer{ID: id}
@@ -1212,6 +1339,235 @@ func (c *Client) WaitContainer(id string) (int, error) {
 	return r.StatusCode, nil
 }
 
+// WaitCondition is the state of a container waited for by
+// WaitContainerWithOptions.
+type WaitCondition string
+
+const (
+	// WaitConditionNotRunning waits until the container is not running,
+	// which is immediate if the container is not running yet.
+	WaitConditionNotRunning = WaitCondition("not-running")
+
+	// WaitConditionNextExit waits for the next exit of the container.
+	WaitConditionNextExit = WaitCondition("next-exit")
+
+	// WaitConditionRemoved waits until the container exits and is removed,
+	// like containers removed by the daemon when they exit
+	// (HostConfig.AutoRemove).
+	WaitConditionRemoved = WaitCondition("removed")
+)
+
+// WaitContainerOptions specify parameters to the WaitContainerWithOptions
+// function.
+//
+// See https://docs.docker.com/engine/api/v1.30/#operation/ContainerWait for more details.
+type WaitContainerOptions struct {
+	ID string `qs:"-"`
+
+	// Condition is the state to wait for, WaitConditionNotRunning by
+	// default.
+	Condition WaitCondition
+
+	Context context.Context
+}
+
+// WaitContainerResult is the result of a wait for a container.
+type WaitContainerResult struct {
+	// StatusCode is the exit code of the container.
+	StatusCode int
+
+	// Error is the error message reported by the daemon for the exit of
+	// the container, if any.
+	Error string
+}
+
+// ContainerWaiter is a wait for a container started by
+// WaitContainerWithOptions.
+type ContainerWaiter struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	result *WaitContainerResult
+	err    error
+}
+
+// Wait blocks until the condition of the wait is met, returning the result of
+// the wait.
+func (w *ContainerWaiter) Wait() (*WaitContainerResult, error) {
+	<-w.done
+	return w.result, w.err
+}
+
+// Done returns a channel that's closed when the wait is over.
+func (w *ContainerWaiter) Done() <-chan struct{} {
+	return w.done
+}
+
+// Close cancels the wait, unless it's over already.
+func (w *ContainerWaiter) Close() error {
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+// WaitContainerWithOptions starts waiting for the given container to meet the
+// condition of the options. It returns once the daemon is waiting, so
+// calling it before StartContainer ensures that the exit of the container
+// isn't missed, even if the daemon removes the container as soon as it exits.
+//
+// Conditions require API version 1.30. With older versions, the wait relies on
+// the events of the container instead.
+//
+// See https://docs.docker.com/engine/api/v1.30/#operation/ContainerWait for more details.
+func (c *Client) WaitContainerWithOptions(opts WaitContainerOptions) (*ContainerWaiter, error) {
+	if opts.Condition == "" {
+		opts.Condition = WaitConditionNotRunning
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	wait := c.waitCondition
+	if err := c.requireFeature(FeatureWaitCondition); err != nil {
+		if _, ok := err.(*ErrAPIVersionUnsupported); !ok {
+			cancel()
+			return nil, err
+		}
+		wait = c.waitContainerEvents
+	}
+	result, err := wait(ctx, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	waiter := &ContainerWaiter{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(waiter.done)
+		defer cancel()
+		waiter.result, waiter.err = result()
+	}()
+	return waiter, nil
+}
+
+// waitCondition starts a wait with the condition parameter of the API. The
+// daemon sends the headers of the response once it's waiting, and the body
+// once the condition is met.
+func (c *Client) waitCondition(ctx context.Context, opts WaitContainerOptions) (func() (*WaitContainerResult, error), error) {
+	path := "/containers/" + opts.ID + "/wait?" + queryString(opts)
+	resp, err := c.do("POST", path, doOptions{idempotent: true, context: ctx, callOptions: opts, stream: true})
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return nil, &NoSuchContainer{ID: opts.ID}
+		}
+		return nil, err
+	}
+	return func() (*WaitContainerResult, error) {
+		defer resp.Body.Close()
+		var r struct {
+			StatusCode int
+			Error      *struct{ Message string }
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			return nil, chooseError(ctx, err)
+		}
+		result := WaitContainerResult{StatusCode: r.StatusCode}
+		if r.Error != nil {
+			result.Error = r.Error.Message
+		}
+		return &result, nil
+	}, nil
+}
+
+// waitContainerEvents starts a wait with the events of the container, for API
+// versions that don't support conditions. The stream of events is opened
+// before checking the state of the container, so no exit is missed.
+func (c *Client) waitContainerEvents(ctx context.Context, opts WaitContainerOptions) (func() (*WaitContainerResult, error), error) {
+	filters, err := json.Marshal(map[string][]string{"container": {opts.ID}})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do("GET", "/events?"+url.Values{"filters": {string(filters)}}.Encode(), doOptions{context: ctx, stream: true})
+	if err != nil {
+		return nil, err
+	}
+	state, err := c.waitContainerState(ctx, opts.ID)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	result := WaitContainerResult{StatusCode: state.ExitCode, Error: state.Error}
+	if opts.Condition == WaitConditionNotRunning && !state.Running {
+		resp.Body.Close()
+		return func() (*WaitContainerResult, error) { return &result, nil }, nil
+	}
+	return func() (*WaitContainerResult, error) {
+		defer resp.Body.Close()
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var event APIEvents
+			if err := decoder.Decode(&event); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, chooseError(ctx, err)
+			}
+			transformEvent(&event)
+			if event.Type != "container" {
+				continue
+			}
+			switch event.Action {
+			case "die":
+				result = c.waitExitResult(ctx, opts.ID, &event)
+				if opts.Condition != WaitConditionRemoved {
+					return &result, nil
+				}
+			case "destroy":
+				if opts.Condition != WaitConditionRemoved {
+					return nil, &NoSuchContainer{ID: opts.ID}
+				}
+				return &result, nil
+			}
+		}
+	}, nil
+}
+
+// waitExitResult returns the result of the exit of the container reported by
+// the given die event. The exit code is reported by the events of API version
+// 1.22 and newer, and the error message only by the state of the container,
+// which is gone if the daemon removed the container already.
+func (c *Client) waitExitResult(ctx context.Context, id string, event *APIEvents) WaitContainerResult {
+	var result WaitContainerResult
+	exitCode, err := strconv.Atoi(event.Actor.Attributes["exitCode"])
+	if err == nil {
+		result.StatusCode = exitCode
+	}
+	if state, stateErr := c.waitContainerState(ctx, id); stateErr == nil && !state.Running {
+		result.Error = state.Error
+		if err != nil {
+			result.StatusCode = state.ExitCode
+		}
+	}
+	return result
+}
+
+// waitContainerState returns the state of the given container, bypassing the
+// inspect cache, which may not have seen the events of the wait yet.
+func (c *Client) waitContainerState(ctx context.Context, id string) (*State, error) {
+	resp, err := c.do("GET", "/containers/"+id+"/json", doOptions{context: ctx})
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return nil, &NoSuchContainer{ID: id}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var container Container
+	if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
+		return nil, err
+	}
+	return &container.State, nil
+}
+
 // CommitContainerOptions aggregates parameters to the CommitContainer method.
 //
 // See https://goo.gl/mqfoCw for more details.
@@ -1231,8 +1587,9 @@ type CommitContainerOptions struct {
 func (c *Client) CommitContainer(opts CommitContainerOptions) (*Image, error) {
 	path := "/commit?" + queryString(opts)
 	resp, err := c.do("POST", path, doOptions{
-		data:    opts.Run,
-		context: opts.Context,
+		data:        opts.Run,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
@@ -1282,6 +1639,15 @@ type AttachToContainerOptions struct {
 
 	// Use raw terminal? Usually true when the container contains a TTY.
 	RawTerminal bool `qs:"-"`
+
+	// Timeout with no data is received, it's reset every time new data
+	// arrives. When exceeded, the connection is closed and Wait returns
+	// ErrInactivityTimeout.
+	InactivityTimeout time.Duration `qs:"-"`
+
+	// Context for the session. Once it's done, the connection is closed
+	// and Wait returns the error of the context.
+	Context context.Context `qs:"-"`
 }
 
 // AttachToContainer attaches to a container, using the given options.
@@ -1304,13 +1670,48 @@ func (c *Client) AttachToContainerNonBlocking(opts AttachToContainerOptions) (Cl
 		return nil, &NoSuchContainer{ID: opts.Container}
 	}
 	path := "/containers/" + opts.Container + "/attach?" + queryString(opts)
-	return c.hijack("POST", path, hijackOptions{
-		success:        opts.Success,
+	cw, err := c.hijack("POST", path, hijackOptions{
+		success:           opts.Success,
+		setRawTerminal:    opts.RawTerminal,
+		in:                opts.InputStream,
+		stdout:            opts.OutputStream,
+		stderr:            opts.ErrorStream,
+		inactivityTimeout: opts.InactivityTimeout,
+		context:           opts.Context,
+		callOptions:       opts,
+	})
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return nil, &NoSuchContainer{ID: opts.Container}
+		}
+		return nil, err
+	}
+	return cw, nil
+}
+
+// AttachToContainerRaw attaches to a container, returning the raw connection
+// of the session instead of copying it to the streams in the options, which
+// are ignored along with Success and InactivityTimeout. The Context only
+// applies to establishing the connection.
+//
+// See https://goo.gl/NKpkFk for more details.
+func (c *Client) AttachToContainerRaw(opts AttachToContainerOptions) (*HijackedConn, error) {
+	if opts.Container == "" {
+		return nil, &NoSuchContainer{ID: opts.Container}
+	}
+	path := "/containers/" + opts.Container + "/attach?" + queryString(opts)
+	conn, err := c.hijackConn("POST", path, hijackOptions{
 		setRawTerminal: opts.RawTerminal,
-		in:             opts.InputStream,
-		stdout:         opts.OutputStream,
-		stderr:         opts.ErrorStream,
+		context:        opts.Context,
+		callOptions:    opts,
 	})
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return nil, &NoSuchContainer{ID: opts.Container}
+		}
+		return nil, err
+	}
+	return conn, nil
 }
 
 // LogsOptions represents the set of options used when getting logs from a
@@ -1358,11 +1759,20 @@ func (c *Client) Logs(opts LogsOptions) error {
 //
 // See https://goo.gl/xERhCc for more details.
 func (c *Client) ResizeContainerTTY(id string, height, width int) error {
+	return c.ResizeContainerTTYWithContext(context.Background(), id, height, width)
+}
+
+// ResizeContainerTTYWithContext resizes the terminal to the given height and
+// width. The context can be used to cancel the request.
+func (c *Client) ResizeContainerTTYWithContext(ctx context.Context, id string, height, width int) error {
 	params := make(url.Values)
 	params.Set("h", strconv.Itoa(height))
 	params.Set("w", strconv.Itoa(width))
-	resp, err := c.do("POST", "/containers/"+id+"/resize?"+params.Encode(), doOptions{})
+	resp, err := c.do("POST", "/containers/"+id+"/resize?"+params.Encode(), doOptions{idempotent: true, context: ctx})
 	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return &NoSuchContainer{ID: id}
+		}
 		return err
 	}
 	resp.Body.Close()
@@ -7,8 +7,10 @@ package docker
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -19,6 +21,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -1150,6 +1153,193 @@ func TestWaitContainerNotFound(t *testing.T) {
 	}
 }
 
+func TestWaitContainerWithOptions(t *testing.T) {
+	release := make(chan struct{})
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/web/wait" {
+			http.Error(w, "no such container", http.StatusNotFound)
+			return
+		}
+		query = r.URL.Query()
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte(`{"StatusCode":3,"Error":{"Message":"exec failed"}}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	waiter, err := client.WaitContainerWithOptions(WaitContainerOptions{ID: "web", Condition: WaitConditionNextExit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (url.Values{"condition": {"next-exit"}}); !reflect.DeepEqual(query, expected) {
+		t.Errorf("WaitContainerWithOptions: wrong query string. Want %#v. Got %#v.", expected, query)
+	}
+	select {
+	case <-waiter.Done():
+		t.Fatal("WaitContainerWithOptions: the wait is over before the exit of the container")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	result, err := waiter.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &WaitContainerResult{StatusCode: 3, Error: "exec failed"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("WaitContainerWithOptions: wrong result. Want %#v. Got %#v.", expected, result)
+	}
+	_, err = client.WaitContainerWithOptions(WaitContainerOptions{ID: "db"})
+	if expectedErr := (&NoSuchContainer{ID: "db"}); !reflect.DeepEqual(err, expectedErr) {
+		t.Errorf("WaitContainerWithOptions: wrong error. Want %#v. Got %#v.", expectedErr, err)
+	}
+}
+
+func TestWaitContainerWithOptionsClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	waiter, err := client.WaitContainerWithOptions(WaitContainerOptions{ID: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiter.Close()
+	if _, err := waiter.Wait(); err != context.Canceled {
+		t.Errorf("WaitContainerWithOptions: wrong error. Want %#v. Got %#v.", context.Canceled, err)
+	}
+}
+
+func TestWaitContainerWithOptionsEvents(t *testing.T) {
+	var tests = []struct {
+		condition WaitCondition
+		running   bool
+		events    []string
+		expected  *WaitContainerResult
+	}{
+		{
+			condition: WaitConditionNotRunning,
+			expected:  &WaitContainerResult{StatusCode: 1, Error: "previous exit"},
+		},
+		{
+			condition: WaitConditionNextExit,
+			events: []string{
+				`{"status":"start","id":"web","Type":"container","Action":"start","Actor":{"ID":"web"},"time":1}`,
+				`{"status":"die","id":"web","Type":"container","Action":"die","Actor":{"ID":"web","Attributes":{"exitCode":"2"}},"time":2}`,
+			},
+			expected: &WaitContainerResult{StatusCode: 2, Error: "previous exit"},
+		},
+		{
+			condition: WaitConditionRemoved,
+			running:   true,
+			events: []string{
+				`{"status":"die","id":"web","Type":"container","Action":"die","Actor":{"ID":"web","Attributes":{"exitCode":"2"}},"time":2}`,
+				`{"status":"destroy","id":"web","Type":"container","Action":"destroy","Actor":{"ID":"web"},"time":3}`,
+			},
+			expected: &WaitContainerResult{StatusCode: 2},
+		},
+	}
+	for _, tt := range tests {
+		release := make(chan struct{})
+		var mu sync.Mutex
+		running := tt.running
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1.24/events":
+				if filters := r.URL.Query().Get("filters"); filters != `{"container":["web"]}` {
+					t.Errorf("WaitContainerWithOptions (%s): wrong filters. Got %q.", tt.condition, filters)
+				}
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				<-release
+				for _, event := range tt.events {
+					if strings.Contains(event, `"die"`) {
+						mu.Lock()
+						running = false
+						mu.Unlock()
+					}
+					fmt.Fprintln(w, event)
+					w.(http.Flusher).Flush()
+				}
+				<-r.Context().Done()
+			case "/v1.24/containers/web/json":
+				mu.Lock()
+				defer mu.Unlock()
+				if tt.condition == WaitConditionRemoved && !running {
+					http.Error(w, "no such container", http.StatusNotFound)
+					return
+				}
+				json.NewEncoder(w).Encode(Container{ID: "web", State: State{Running: running, ExitCode: 1, Error: "previous exit"}})
+			default:
+				http.Error(w, "not found", http.StatusNotFound)
+			}
+		}))
+		client, err := NewVersionedClient(server.URL, "1.24")
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SkipServerVersionCheck = true
+		waiter, err := client.WaitContainerWithOptions(WaitContainerOptions{ID: "web", Condition: tt.condition})
+		if err != nil {
+			t.Fatal(err)
+		}
+		close(release)
+		result, err := waiter.Wait()
+		if err != nil {
+			t.Errorf("WaitContainerWithOptions (%s): %s", tt.condition, err)
+		} else if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("WaitContainerWithOptions (%s): wrong result. Want %#v. Got %#v.", tt.condition, tt.expected, result)
+		}
+		server.Close()
+	}
+}
+
+func TestWaitContainerWithOptionsNegotiation(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		if r.URL.Path == "/version" {
+			w.Write([]byte(`{"ApiVersion":"1.32"}`))
+			return
+		}
+		w.Write([]byte(`{"StatusCode":0}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.EnableAPIVersionNegotiation()
+	waiter, err := client.WaitContainerWithOptions(WaitContainerOptions{ID: "web", Condition: WaitConditionRemoved})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waiter.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"GET /version", "POST /v1.30/containers/web/wait?condition=removed"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("WaitContainerWithOptions: wrong requests. Want %#v. Got %#v.", expected, requests)
+	}
+}
+
 func TestCommitContainer(t *testing.T) {
 	response := `{"Id":"596069db4bf5"}`
 	client := newTestClient(&FakeRoundTripper{message: response, status: http.StatusOK})
@@ -2414,3 +2604,29 @@ func TestRenameContainer(t *testing.T) {
 		t.Errorf("RenameContainer: Wrong params in request. Want %q. Got %q.", expectedValues, actualValues)
 	}
 }
+
+func TestPruneContainers(t *testing.T) {
+	body := `{"ContainersDeleted":["4fa6e0f0c678","d5c2a4b1e2b8"],"SpaceReclaimed":1024}`
+	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	opts := PruneContainersOptions{Filters: map[string][]string{"until": {"10m"}}}
+	results, err := client.PruneContainers(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &PruneContainersResults{ContainersDeleted: []string{"4fa6e0f0c678", "d5c2a4b1e2b8"}, SpaceReclaimed: 1024}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("PruneContainers: wrong results. Want %#v. Got %#v.", expected, results)
+	}
+	req := fakeRT.requests[0]
+	if req.Method != "POST" {
+		t.Errorf("PruneContainers: wrong HTTP method. Want %q. Got %q.", "POST", req.Method)
+	}
+	expectedURL, _ := url.Parse(client.getURL("/containers/prune"))
+	if req.URL.Path != expectedURL.Path {
+		t.Errorf("PruneContainers: wrong path. Want %q. Got %q.", expectedURL.Path, req.URL.Path)
+	}
+	if filters := req.URL.Query().Get("filters"); filters != `{"until":["10m"]}` {
+		t.Errorf("PruneContainers: wrong filters. Want %q. Got %q.", `{"until":["10m"]}`, filters)
+	}
+}
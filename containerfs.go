@@ -0,0 +1,686 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxContainerFSLinks is the number of symbolic links followed when resolving
+// a path before giving up, like the limit of Linux.
+const maxContainerFSLinks = 40
+
+var (
+	errContainerFSNotDir    = errors.New("not a directory")
+	errContainerFSLinkLoop  = errors.New("too many levels of symbolic links")
+	errContainerFSIsDir     = errors.New("is a directory")
+	errContainerFSNoContent = errors.New("no content in the archive")
+)
+
+// ContainerFS is a read-only view of the filesystem of a container. It
+// implements fs.FS, fs.StatFS and fs.ReadDirFS, so functions like fs.WalkDir
+// and fs.Glob, and http.FS, work with the files of containers. It also has the
+// ReadLink and Lstat methods of fs.ReadLinkFS.
+//
+// Names are relative to the root of the container. Symbolic links are
+// followed, except by ReadLink and Lstat and in the entries returned by
+// ReadDir, which describe the links themselves.
+//
+// The view returned by ContainerFS fetches the files from the container as
+// they're used, with the archive endpoints of DownloadFromContainer, and
+// caches them: reading a file downloads it once, and reading a directory
+// downloads its whole tree, as the daemon can't archive a single level of a
+// directory (see ReadDir). The view returned by ContainerFSSnapshot reads the
+// whole filesystem from a single export of the container instead, so later
+// changes of the container don't show up in it.
+type ContainerFS struct {
+	client *Client
+	id     string
+	ctx    context.Context
+	cache  *containerFSCache
+}
+
+// ContainerFS returns a view of the filesystem of the given container,
+// fetching files from the container as they're used.
+func (c *Client) ContainerFS(id string) *ContainerFS {
+	return &ContainerFS{
+		client: c,
+		id:     id,
+		ctx:    context.Background(),
+		cache:  &containerFSCache{entries: make(map[string]*containerFSEntry)},
+	}
+}
+
+// ContainerFSSnapshot returns a view of the filesystem of the given container
+// at the time of the call, reading it from an export of the container. The
+// contents of the files are kept in a temporary file, which the view must be
+// closed to remove.
+func (c *Client) ContainerFSSnapshot(ctx context.Context, id string) (*ContainerFS, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	spool, err := ioutil.TempFile("", "docker-container-fs")
+	if err != nil {
+		return nil, err
+	}
+	cache := &containerFSCache{snapshot: true, spool: spool, entries: make(map[string]*containerFSEntry)}
+	reader, writer := io.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		err := c.ExportContainer(ExportContainerOptions{ID: id, OutputStream: writer, Context: ctx})
+		writer.CloseWithError(err)
+		errs <- err
+	}()
+	err = cache.load(reader)
+	if err == nil {
+		// the padding after the end of the archive
+		_, err = io.Copy(ioutil.Discard, reader)
+	}
+	reader.CloseWithError(err)
+	if exportErr := <-errs; err == nil {
+		err = exportErr
+	}
+	if err != nil {
+		cache.close()
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return nil, &NoSuchContainer{ID: id}
+		}
+		return nil, err
+	}
+	return &ContainerFS{client: c, id: id, ctx: ctx, cache: cache}, nil
+}
+
+// Close removes the temporary file holding the contents of the files of a
+// view returned by ContainerFSSnapshot, after which the files of the view,
+// and of its copies, can't be read anymore. It does nothing for views
+// returned by ContainerFS.
+func (fsys *ContainerFS) Close() error {
+	return fsys.cache.close()
+}
+
+// WithContext returns a copy of the view using the given context for the
+// requests it makes to the daemon. The copy shares the cache of the view.
+func (fsys *ContainerFS) WithContext(ctx context.Context) *ContainerFS {
+	copied := *fsys
+	copied.ctx = ctx
+	return &copied
+}
+
+// Open opens the named file or directory for reading.
+func (fsys *ContainerFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	resolved, entry, err := fsys.walk(name, true, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := entry.info.withName(path.Base(name))
+	if info.IsDir() {
+		return &containerDir{fsys: fsys, name: name, path: resolved, info: info}, nil
+	}
+	content, err := fsys.readFile(resolved, entry)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &containerFile{SectionReader: content, info: info}, nil
+}
+
+// Stat returns information about the named file or directory.
+func (fsys *ContainerFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	_, entry, err := fsys.walk(name, true, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return entry.info.withName(path.Base(name)), nil
+}
+
+// ReadLink returns the target of the named symbolic link.
+func (fsys *ContainerFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	_, entry, err := fsys.walk(name, false, 0)
+	if err == nil && entry.info.mode&fs.ModeSymlink == 0 {
+		err = fs.ErrInvalid
+	}
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return entry.link, nil
+}
+
+// Lstat returns information about the named file or directory, without
+// following it if it's a symbolic link.
+func (fsys *ContainerFS) Lstat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrInvalid}
+	}
+	_, entry, err := fsys.walk(name, false, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return entry.info.withName(path.Base(name)), nil
+}
+
+// ReadDir reads the named directory, returning its entries sorted by name.
+//
+// The daemon can't archive a single level of a directory, so the view returned
+// by ContainerFS downloads the archive of the whole tree of the directory,
+// including the contents of its files, to list it. Only the headers of the
+// archive are kept, and the entries of the whole tree are cached, so listing
+// its subdirectories afterwards costs nothing. Listing large trees, like the
+// root of the container, is as costly as an export; ContainerFSSnapshot is
+// better suited to walking them.
+func (fsys *ContainerFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	resolved, entry, err := fsys.walk(name, true, 0)
+	if err == nil && !entry.info.IsDir() {
+		err = errContainerFSNotDir
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries, err := fsys.readDir(resolved)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// walk returns the entry at name, following the symbolic links in its
+// parents, and in the entry itself when follow is true, along with the path
+// of the entry.
+func (fsys *ContainerFS) walk(name string, follow bool, links int) (string, *containerFSEntry, error) {
+	if links > maxContainerFSLinks {
+		return "", nil, errContainerFSLinkLoop
+	}
+	name, err := fsys.walkParents(name, links)
+	if err != nil {
+		return "", nil, err
+	}
+	entry, err := fsys.lookup(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if follow && entry.info.mode&fs.ModeSymlink != 0 {
+		return fsys.walk(linkTargetName(name, entry.link), true, links+1)
+	}
+	return name, entry, nil
+}
+
+// walkParents returns the name with the symbolic links in its parents
+// resolved.
+func (fsys *ContainerFS) walkParents(name string, links int) (string, error) {
+	if name == "." {
+		return name, nil
+	}
+	parts := strings.Split(name, "/")
+	current := "."
+	for _, part := range parts[:len(parts)-1] {
+		resolved, entry, err := fsys.walk(path.Join(current, part), true, links)
+		if err != nil {
+			return "", err
+		}
+		if !entry.info.IsDir() {
+			return "", errContainerFSNotDir
+		}
+		current = resolved
+	}
+	return path.Join(current, parts[len(parts)-1]), nil
+}
+
+// linkTargetName returns the name the symbolic link with the given name and
+// target points to. Like in the container, ".." at the root stays there.
+func linkTargetName(name, target string) string {
+	if !path.IsAbs(target) {
+		target = path.Join(path.Dir(name), target)
+	}
+	cleaned := strings.TrimPrefix(path.Clean("/"+target), "/")
+	if cleaned == "" {
+		return "."
+	}
+	return cleaned
+}
+
+// lookup returns the entry at name, without following it.
+func (fsys *ContainerFS) lookup(name string) (*containerFSEntry, error) {
+	if entry, ok := fsys.cache.get(name); ok {
+		return entry, nil
+	}
+	if fsys.cache.snapshot {
+		return nil, fs.ErrNotExist
+	}
+	stat, err := fsys.client.ContainerStatPath(fsys.ctx, fsys.id, "/"+name)
+	if err == ErrNoSuchContainerPath {
+		return nil, fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &containerFSEntry{
+		info: containerFileInfo{name: path.Base(name), size: stat.Size, mode: stat.Mode, modTime: stat.Mtime},
+		link: stat.LinkTarget,
+	}
+	return fsys.cache.put(name, entry), nil
+}
+
+// readFile returns the contents of the file at the given path.
+func (fsys *ContainerFS) readFile(name string, entry *containerFSEntry) (*io.SectionReader, error) {
+	if content, ok := fsys.cache.content(entry); ok {
+		return content, nil
+	}
+	if fsys.cache.snapshot {
+		return nil, errContainerFSNoContent
+	}
+	var data []byte
+	var found bool
+	err := fsys.download(name, func(tr *tar.Reader, header *tar.Header) error {
+		if found || (header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA) {
+			return nil
+		}
+		var err error
+		data, err = ioutil.ReadAll(tr)
+		found = true
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errContainerFSNoContent
+	}
+	fsys.cache.setData(entry, data)
+	return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), nil
+}
+
+// readDir returns the entries of the directory at the given path. Listing a
+// directory downloads and caches its whole tree, without the contents of its
+// files.
+func (fsys *ContainerFS) readDir(name string) ([]fs.DirEntry, error) {
+	if entries, ok := fsys.cache.list(name); ok {
+		return entries, nil
+	}
+	if fsys.cache.snapshot {
+		return nil, fs.ErrNotExist
+	}
+	var root string
+	tree := make(map[string]*containerFSEntry)
+	err := fsys.download(name, func(tr *tar.Reader, header *tar.Header) error {
+		entryName := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if root == "" {
+			root = entryName
+		}
+		var rel string
+		switch {
+		case entryName == root:
+			rel = "."
+		case root == ".":
+			rel = entryName
+		case strings.HasPrefix(entryName, root+"/"):
+			rel = entryName[len(root)+1:]
+		default:
+			return nil
+		}
+		tree[path.Join(name, rel)] = newContainerFSEntry(path.Base(path.Join(name, rel)), header)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fsys.cache.putTree(name, tree)
+	entries, _ := fsys.cache.list(name)
+	return entries, nil
+}
+
+// download calls fn with every entry of the archive of the given path.
+func (fsys *ContainerFS) download(name string, fn func(*tar.Reader, *tar.Header) error) error {
+	reader, writer := io.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		err := fsys.client.DownloadFromContainer(fsys.id, DownloadFromContainerOptions{
+			OutputStream: writer,
+			Path:         "/" + name,
+			Context:      fsys.ctx,
+		})
+		writer.CloseWithError(err)
+		errs <- err
+	}()
+	tr := tar.NewReader(reader)
+	var err error
+	for {
+		var header *tar.Header
+		if header, err = tr.Next(); err != nil {
+			break
+		}
+		if err = fn(tr, header); err != nil {
+			break
+		}
+	}
+	if err == io.EOF {
+		// the padding after the end of the archive
+		_, err = io.Copy(ioutil.Discard, reader)
+	}
+	reader.CloseWithError(err)
+	downloadErr := <-errs
+	if err != nil {
+		return err
+	}
+	if e, ok := downloadErr.(*Error); ok && e.Status == http.StatusNotFound {
+		return fs.ErrNotExist
+	}
+	return downloadErr
+}
+
+type containerFSCache struct {
+	// snapshot indicates that the cache holds the whole filesystem.
+	snapshot bool
+
+	// spool holds the contents of the files of snapshots, one after the
+	// other.
+	spool *os.File
+
+	mu      sync.Mutex
+	entries map[string]*containerFSEntry
+}
+
+type containerFSEntry struct {
+	info containerFileInfo
+	link string
+
+	// data is the content of regular files once read, except in snapshots
+	// where offset is the position of the content in the spool
+	data    []byte
+	offset  int64
+	hasData bool
+
+	// children are the sorted names of the entries of directories, once
+	// listed
+	children []string
+	listed   bool
+}
+
+func newContainerFSEntry(name string, header *tar.Header) *containerFSEntry {
+	return &containerFSEntry{
+		info: containerFileInfo{
+			name:    name,
+			size:    header.Size,
+			mode:    header.FileInfo().Mode(),
+			modTime: header.ModTime,
+		},
+		link: header.Linkname,
+	}
+}
+
+func (c *containerFSCache) get(name string) (*containerFSEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[name]
+	return entry, ok
+}
+
+// put caches the entry unless another one was cached meanwhile, returning the
+// cached one.
+func (c *containerFSCache) put(name string, entry *containerFSEntry) *containerFSEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.entries[name]; ok {
+		return cached
+	}
+	c.entries[name] = entry
+	return entry
+}
+
+// content returns a reader of the content of the entry, if it was read.
+func (c *containerFSCache) content(entry *containerFSEntry) (*io.SectionReader, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !entry.hasData {
+		return nil, false
+	}
+	if c.spool != nil {
+		return io.NewSectionReader(c.spool, entry.offset, entry.info.size), true
+	}
+	return io.NewSectionReader(bytes.NewReader(entry.data), 0, int64(len(entry.data))), true
+}
+
+func (c *containerFSCache) setData(entry *containerFSEntry, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.data, entry.hasData = data, true
+}
+
+func (c *containerFSCache) list(name string) ([]fs.DirEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[name]
+	if !ok || !entry.listed {
+		return nil, false
+	}
+	entries := make([]fs.DirEntry, 0, len(entry.children))
+	for _, child := range entry.children {
+		if childEntry, ok := c.entries[path.Join(name, child)]; ok {
+			entries = append(entries, containerDirEntry{childEntry.info})
+		}
+	}
+	return entries, true
+}
+
+// putTree caches the tree of entries of the directory root, which are all
+// listed, keeping the contents of the files already read.
+func (c *containerFSCache) putTree(root string, tree map[string]*containerFSEntry) {
+	children := make(map[string][]string)
+	for name := range tree {
+		if name != root {
+			parent := path.Dir(name)
+			children[parent] = append(children[parent], path.Base(name))
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, entry := range tree {
+		if cached, ok := c.entries[name]; ok && cached.hasData && cached.info.modTime.Equal(entry.info.modTime) {
+			entry.data, entry.hasData = cached.data, true
+		}
+		if name == root {
+			if cached, ok := c.entries[name]; ok {
+				// the name of the root entry of the archive is the
+				// one of the path resolved by the daemon
+				entry.info.name = cached.info.name
+			}
+		}
+		if entry.info.IsDir() {
+			entry.children = children[name]
+			sort.Strings(entry.children)
+			entry.listed = true
+		}
+		c.entries[name] = entry
+	}
+}
+
+// close removes the spool of snapshots.
+func (c *containerFSCache) close() error {
+	if c.spool == nil {
+		return nil
+	}
+	err := c.spool.Close()
+	if removeErr := os.Remove(c.spool.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// load caches the entries of an export of a container, writing the contents
+// of its files to the spool.
+func (c *containerFSCache) load(r io.Reader) error {
+	c.entries["."] = &containerFSEntry{
+		info:   containerFileInfo{name: ".", mode: fs.ModeDir | 0755},
+		listed: true,
+	}
+	hardLinks := make(map[string]string)
+	var offset int64
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			continue
+		}
+		entry := newContainerFSEntry(path.Base(name), header)
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			size, err := io.Copy(c.spool, tr)
+			if err != nil {
+				return err
+			}
+			entry.offset, entry.info.size, entry.hasData = offset, size, true
+			offset += size
+		case tar.TypeLink:
+			hardLinks[name] = path.Clean(strings.TrimPrefix(header.Linkname, "/"))
+			entry.link = ""
+		case tar.TypeDir:
+			entry.listed = true
+		}
+		if name == "." {
+			entry.info.name = "."
+		}
+		c.add(name, entry)
+	}
+	for name, target := range hardLinks {
+		if targetEntry, ok := c.entries[target]; ok {
+			entry := c.entries[name]
+			entry.offset, entry.hasData = targetEntry.offset, targetEntry.hasData
+			entry.info.size = targetEntry.info.size
+		}
+	}
+	for _, entry := range c.entries {
+		sort.Strings(entry.children)
+	}
+	return nil
+}
+
+// add adds an entry of an export, adding its missing parents.
+func (c *containerFSCache) add(name string, entry *containerFSEntry) {
+	if cached, ok := c.entries[name]; ok {
+		entry.children = cached.children
+		c.entries[name] = entry
+		return
+	}
+	parent := path.Dir(name)
+	if _, ok := c.entries[parent]; !ok {
+		c.add(parent, &containerFSEntry{
+			info:   containerFileInfo{name: path.Base(parent), mode: fs.ModeDir | 0755},
+			listed: true,
+		})
+	}
+	c.entries[parent].children = append(c.entries[parent].children, path.Base(name))
+	c.entries[name] = entry
+}
+
+type containerFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi containerFileInfo) Name() string       { return fi.name }
+func (fi containerFileInfo) Size() int64        { return fi.size }
+func (fi containerFileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi containerFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi containerFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi containerFileInfo) Sys() interface{}   { return nil }
+
+func (fi containerFileInfo) withName(name string) containerFileInfo {
+	fi.name = name
+	return fi
+}
+
+type containerDirEntry struct {
+	info containerFileInfo
+}
+
+func (e containerDirEntry) Name() string               { return e.info.name }
+func (e containerDirEntry) IsDir() bool                { return e.info.IsDir() }
+func (e containerDirEntry) Type() fs.FileMode          { return e.info.mode.Type() }
+func (e containerDirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
+
+// containerFile is an open regular file of a ContainerFS. It implements
+// io.Seeker and io.ReaderAt too.
+type containerFile struct {
+	*io.SectionReader
+	info containerFileInfo
+}
+
+func (f *containerFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *containerFile) Close() error               { return nil }
+
+// containerDir is an open directory of a ContainerFS.
+type containerDir struct {
+	fsys    *ContainerFS
+	name    string
+	path    string
+	info    containerFileInfo
+	entries []fs.DirEntry
+	offset  int
+	read    bool
+}
+
+func (d *containerDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *containerDir) Close() error               { return nil }
+
+func (d *containerDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errContainerFSIsDir}
+}
+
+func (d *containerDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.readDir(d.path)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+		d.entries, d.read = entries, true
+	}
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,348 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type containerFSTestFile struct {
+	name     string
+	typeflag byte
+	data     string
+	linkname string
+}
+
+var containerFSTestFiles = []containerFSTestFile{
+	{name: "etc", typeflag: tar.TypeDir},
+	{name: "etc/hostname", typeflag: tar.TypeReg, data: "web\n"},
+	{name: "etc/hosts", typeflag: tar.TypeReg, data: "127.0.0.1 localhost\n"},
+	{name: "etc/localhost", typeflag: tar.TypeSymlink, linkname: "../etc/hostname"},
+	{name: "empty", typeflag: tar.TypeDir},
+	{name: "var", typeflag: tar.TypeDir},
+	{name: "var/www", typeflag: tar.TypeDir},
+	{name: "var/www/index.html", typeflag: tar.TypeReg, data: "<h1>web</h1>\n"},
+	{name: "var/www/style.css", typeflag: tar.TypeReg, data: "h1 {}\n"},
+	{name: "www", typeflag: tar.TypeSymlink, linkname: "/var/www"},
+}
+
+func containerFSTestHeader(file containerFSTestFile, name string) *tar.Header {
+	header := &tar.Header{
+		Name:     name,
+		Typeflag: file.typeflag,
+		Linkname: file.linkname,
+		Size:     int64(len(file.data)),
+		Mode:     0644,
+		ModTime:  time.Date(2016, 11, 3, 10, 30, 0, 0, time.UTC),
+	}
+	switch file.typeflag {
+	case tar.TypeDir:
+		header.Mode = 0755
+		header.Name += "/"
+	case tar.TypeSymlink:
+		header.Mode = 0777
+	}
+	return header
+}
+
+func writeContainerFSTestFile(tw *tar.Writer, file containerFSTestFile, name string) {
+	tw.WriteHeader(containerFSTestHeader(file, name))
+	tw.Write([]byte(file.data))
+}
+
+// containerFSTestExport returns the export of a fake container holding
+// containerFSTestFiles.
+func containerFSTestExport() string {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range containerFSTestFiles {
+		writeContainerFSTestFile(tw, file, file.name)
+	}
+	tw.Close()
+	return buf.String()
+}
+
+// containerFSTestArchive returns the encoded stat and the archive of the given
+// path in a fake container holding containerFSTestFiles, as served by
+// /containers/{id}/archive. It returns false when the path doesn't exist.
+func containerFSTestArchive(p string) (string, []byte, bool) {
+	p = strings.TrimPrefix(path.Clean(p), "/")
+	root := containerFSTestFile{name: ".", typeflag: tar.TypeDir}
+	if p != "" {
+		var found bool
+		for _, file := range containerFSTestFiles {
+			if file.name == p {
+				root, found = file, true
+			}
+		}
+		if !found {
+			return "", nil, false
+		}
+	}
+	header := containerFSTestHeader(root, path.Base(root.name))
+	data, _ := json.Marshal(ContainerPathStat{
+		Name:       header.FileInfo().Name(),
+		Size:       header.Size,
+		Mode:       header.FileInfo().Mode(),
+		Mtime:      header.ModTime,
+		LinkTarget: root.linkname,
+	})
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	writeContainerFSTestFile(tw, root, path.Base(root.name))
+	if root.typeflag == tar.TypeDir {
+		for _, file := range containerFSTestFiles {
+			if p == "" {
+				writeContainerFSTestFile(tw, file, file.name)
+			} else if strings.HasPrefix(file.name, p+"/") {
+				writeContainerFSTestFile(tw, file, path.Base(p)+file.name[len(p):])
+			}
+		}
+	}
+	tw.Close()
+	return base64.StdEncoding.EncodeToString(data), buf.Bytes(), true
+}
+
+func TestContainerFS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stat, archive, ok := containerFSTestArchive(r.URL.Query().Get("path"))
+		if r.URL.Path != "/containers/web/archive" || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Docker-Container-Path-Stat", stat)
+		w.Write(archive)
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	fakeRT := &FakeRoundTripper{message: containerFSTestExport(), status: http.StatusOK}
+	snapshot, err := newTestClient(fakeRT).ContainerFSSnapshot(context.Background(), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+	var tests = []struct {
+		name string
+		fsys fs.FS
+	}{
+		{"lazy", client.ContainerFS("web")},
+		{"snapshot", snapshot},
+	}
+	expected := []string{
+		"etc/hostname", "etc/hosts", "etc/localhost",
+		"var/www/index.html", "var/www/style.css",
+	}
+	for _, tt := range tests {
+		if err := fstest.TestFS(tt.fsys, expected...); err != nil {
+			t.Errorf("ContainerFS (%s): %s", tt.name, err)
+		}
+		data, err := fs.ReadFile(tt.fsys, "www/index.html")
+		if err != nil {
+			t.Errorf("ContainerFS (%s): %s", tt.name, err)
+		} else if string(data) != "<h1>web</h1>\n" {
+			t.Errorf("ContainerFS (%s): wrong content of www/index.html. Want %q. Got %q.", tt.name, "<h1>web</h1>\n", data)
+		}
+		data, err = fs.ReadFile(tt.fsys, "etc/localhost")
+		if err != nil {
+			t.Errorf("ContainerFS (%s): %s", tt.name, err)
+		} else if string(data) != "web\n" {
+			t.Errorf("ContainerFS (%s): wrong content of etc/localhost. Want %q. Got %q.", tt.name, "web\n", data)
+		}
+		matches, err := fs.Glob(tt.fsys, "*/*/*.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"var/www/style.css"}; !reflect.DeepEqual(matches, want) {
+			t.Errorf("ContainerFS (%s): wrong matches. Want %#v. Got %#v.", tt.name, want, matches)
+		}
+		var walked []string
+		err = fs.WalkDir(tt.fsys, "var", func(name string, d fs.DirEntry, err error) error {
+			walked = append(walked, name)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"var", "var/www", "var/www/index.html", "var/www/style.css"}; !reflect.DeepEqual(walked, want) {
+			t.Errorf("ContainerFS (%s): wrong walk. Want %#v. Got %#v.", tt.name, want, walked)
+		}
+		if _, err := fs.Stat(tt.fsys, "etc/missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("ContainerFS (%s): wrong error. Want fs.ErrNotExist. Got %#v.", tt.name, err)
+		}
+		if _, err := fs.ReadDir(tt.fsys, "etc/hosts"); err == nil {
+			t.Errorf("ContainerFS (%s): unexpected <nil> error reading the entries of a file", tt.name)
+		}
+		if _, err := tt.fsys.Open("../etc"); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("ContainerFS (%s): wrong error. Want fs.ErrInvalid. Got %#v.", tt.name, err)
+		}
+	}
+	if n := len(fakeRT.requests); n != 1 {
+		t.Errorf("ContainerFSSnapshot: wrong number of exports. Want 1. Got %d.", n)
+	}
+	req := fakeRT.requests[0]
+	if req.Method != "GET" || req.URL.Path != "/containers/web/export" {
+		t.Errorf("ContainerFSSnapshot: wrong request. Want GET /containers/web/export. Got %s %s.", req.Method, req.URL.Path)
+	}
+}
+
+func TestContainerFSCache(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	count := func(request string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[request]
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		mu.Unlock()
+		stat, archive, ok := containerFSTestArchive(r.URL.Query().Get("path"))
+		if r.URL.Path != "/containers/web/archive" || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Docker-Container-Path-Stat", stat)
+		w.Write(archive)
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	fsys := client.ContainerFS("web")
+	for i := 0; i < 2; i++ {
+		if _, err := fs.ReadFile(fsys, "etc/hosts"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// etc and etc/hosts
+	if n := count("HEAD /containers/web/archive"); n != 2 {
+		t.Errorf("ContainerFS: wrong number of stats. Want 2. Got %d.", n)
+	}
+	if n := count("GET /containers/web/archive"); n != 1 {
+		t.Errorf("ContainerFS: wrong number of downloads. Want 1. Got %d.", n)
+	}
+	entries, err := fsys.ReadDir("var")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "www" || !entries[0].IsDir() {
+		t.Errorf("ContainerFS: wrong entries of var. Got %#v.", entries)
+	}
+	if _, err := fs.ReadDir(fsys, "var/www"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("var/www/style.css"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("HEAD /containers/web/archive"); n != 3 {
+		t.Errorf("ContainerFS: wrong number of stats. Want 3. Got %d.", n)
+	}
+	if n := count("GET /containers/web/archive"); n != 2 {
+		t.Errorf("ContainerFS: wrong number of downloads. Want 2. Got %d.", n)
+	}
+}
+
+func TestContainerFSFileServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stat, archive, ok := containerFSTestArchive(r.URL.Query().Get("path"))
+		if r.URL.Path != "/containers/web/archive" || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("X-Docker-Container-Path-Stat", stat)
+		w.Write(archive)
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	files := httptest.NewServer(http.FileServer(http.FS(client.ContainerFS("web"))))
+	defer files.Close()
+	resp, err := http.Get(files.URL + "/www/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(data) != "h1 {}\n" {
+		t.Errorf("ContainerFS: wrong response. Want 200 %q. Got %d %q.", "h1 {}\n", resp.StatusCode, data)
+	}
+}
+
+func TestContainerFSSnapshotHardLink(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755})
+	tw.WriteHeader(&tar.Header{Name: "bin/busybox", Typeflag: tar.TypeReg, Mode: 0755, Size: 7})
+	tw.Write([]byte("busybox"))
+	tw.WriteHeader(&tar.Header{Name: "bin/sh", Typeflag: tar.TypeLink, Linkname: "bin/busybox", Mode: 0755})
+	tw.WriteHeader(&tar.Header{Name: "bin/true", Typeflag: tar.TypeReg, Mode: 0755, Size: 4})
+	tw.Write([]byte("true"))
+	tw.Close()
+	client := newTestClient(&FakeRoundTripper{message: buf.String(), status: http.StatusOK})
+	fsys, err := client.ContainerFSSnapshot(context.Background(), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"bin/busybox": "busybox", "bin/sh": "busybox", "bin/true": "true"} {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("ContainerFSSnapshot: wrong content of %s. Want %q. Got %q.", name, expected, data)
+		}
+	}
+	spool := fsys.cache.spool.Name()
+	if err := fsys.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("Close: wrong error. Want os.ErrNotExist. Got %#v.", err)
+	}
+	if _, err := fs.ReadFile(fsys, "bin/true"); err == nil {
+		t.Error("ContainerFSSnapshot: unexpected <nil> error reading a file after Close")
+	}
+}
+
+func TestContainerFSSnapshotNoSuchContainer(t *testing.T) {
+	client := newTestClient(&FakeRoundTripper{message: "no such container", status: http.StatusNotFound})
+	_, err := client.ContainerFSSnapshot(context.Background(), "db")
+	if _, ok := err.(*NoSuchContainer); !ok {
+		t.Errorf("ContainerFSSnapshot: wrong error. Want *NoSuchContainer. Got %#v.", err)
+	}
+}
@@ -0,0 +1,565 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoSuchContainerPath is the error returned when the container or the
+	// path in the container doesn't exist. The daemon doesn't tell the two
+	// cases apart.
+	ErrNoSuchContainerPath = errors.New("no such container or path in the container")
+
+	// ErrCopyDirToFile is the error returned when copying a directory over
+	// an existing file.
+	ErrCopyDirToFile = errors.New("cannot copy a directory to a file")
+
+	// ErrCopyNotADirectory is the error returned when a path given to a
+	// copy ends with a separator, but isn't a directory.
+	ErrCopyNotADirectory = errors.New("not a directory")
+
+	// ErrCopyDestDirNotExists is the error returned when copying a file to a
+	// directory, given by a destination path ending with a separator, that
+	// doesn't exist.
+	ErrCopyDestDirNotExists = errors.New("destination directory must exist")
+)
+
+// ErrUnsafeArchiveEntry is the error returned when an archive copied from a
+// container holds an entry that would be extracted out of the destination,
+// either with a path leading out of it or through a symbolic link.
+type ErrUnsafeArchiveEntry struct {
+	Name string
+}
+
+func (err *ErrUnsafeArchiveEntry) Error() string {
+	return "unsafe path in archive: " + err.Name
+}
+
+// ContainerPathStat describes a path in the filesystem of a container.
+type ContainerPathStat struct {
+	Name  string      `json:"name"`
+	Size  int64       `json:"size"`
+	Mode  os.FileMode `json:"mode"`
+	Mtime time.Time   `json:"mtime"`
+
+	// LinkTarget is the path the symbolic link resolves to, when the path
+	// is a symbolic link.
+	LinkTarget string `json:"linkTarget"`
+}
+
+// ContainerStatPath returns information about a path in the filesystem of a
+// container, without following it when it's a symbolic link. It returns
+// ErrNoSuchContainerPath if the container or the path doesn't exist.
+//
+// See https://goo.gl/KnZJDX for more details.
+func (c *Client) ContainerStatPath(ctx context.Context, id, containerPath string) (*ContainerPathStat, error) {
+	uri := fmt.Sprintf("/containers/%s/archive?", id) + url.Values{"path": {containerPath}}.Encode()
+	resp, err := c.do("HEAD", uri, doOptions{context: ctx})
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return nil, ErrNoSuchContainerPath
+		}
+		return nil, err
+	}
+	resp.Body.Close()
+	header := resp.Header.Get("X-Docker-Container-Path-Stat")
+	if header == "" {
+		return nil, errors.New("missing X-Docker-Container-Path-Stat header in the response")
+	}
+	data, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, err
+	}
+	var stat ContainerPathStat
+	if err := json.Unmarshal(data, &stat); err != nil {
+		return nil, err
+	}
+	return &stat, nil
+}
+
+// CopyOption configures CopyToContainer and CopyFromContainerToHost.
+type CopyOption func(*copyOptions)
+
+type copyOptions struct {
+	followLink bool
+	idMapping  func(uid, gid int) (int, int)
+}
+
+// WithCopyFollowLink makes the copy follow the source path when it's a
+// symbolic link, copying its target under the name of the link, like
+// docker cp -L. Symbolic links inside a copied directory are always copied as
+// links.
+func WithCopyFollowLink() CopyOption {
+	return func(opts *copyOptions) {
+		opts.followLink = true
+	}
+}
+
+// WithCopyIDMapping maps the user and group IDs of the copied files. Files
+// copied to a container are owned by the mapped IDs of the source files,
+// instead of the IDs themselves. Files copied from a container are changed to
+// the mapped IDs of the files in the container, which usually requires
+// privileges, instead of belonging to the user making the copy.
+func WithCopyIDMapping(mapping func(uid, gid int) (int, int)) CopyOption {
+	return func(opts *copyOptions) {
+		opts.idMapping = mapping
+	}
+}
+
+// CopyToContainer copies a file or a directory of the host into the
+// filesystem of a container, with the semantics of docker cp:
+//
+//   - a file is copied into the destination when it's a directory, over it
+//     when it's a file, and to a new file otherwise, in which case a
+//     destination ending with a separator must be an existing directory;
+//   - a directory is copied into the destination when it's a directory, and
+//     to a new directory otherwise, but never over a file. When the source
+//     ends with "/.", the contents of the directory are copied instead.
+//
+// Symbolic links are copied as links, and the mode and modification time of
+// the files are preserved.
+func (c *Client) CopyToContainer(ctx context.Context, id, hostPath, containerPath string, opts ...CopyOption) error {
+	options := newCopyOptions(opts)
+	srcIsDir, srcContents := copyPathSuffix(hostPath, os.PathSeparator)
+	srcPath := filepath.Clean(hostPath)
+	srcInfo, err := os.Lstat(srcPath)
+	if err == nil && (options.followLink || srcIsDir) && srcInfo.Mode()&os.ModeSymlink != 0 {
+		// a trailing separator resolves the link too
+		if srcPath, err = filepath.EvalSymlinks(srcPath); err == nil {
+			srcInfo, err = os.Stat(srcPath)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if srcIsDir && !srcInfo.IsDir() {
+		return ErrCopyNotADirectory
+	}
+	dstPath := containerPath
+	stat, err := c.ContainerStatPath(ctx, id, dstPath)
+	if err == nil && stat.Mode&os.ModeSymlink != 0 {
+		dstPath = resolveLinkTarget(dstPath, stat.LinkTarget)
+		stat, err = c.ContainerStatPath(ctx, id, dstPath)
+	}
+	dstIsDir, _ := copyPathSuffix(containerPath, '/')
+	var dstDir, dstName string
+	switch {
+	case err == ErrNoSuchContainerPath:
+		if dstIsDir && !srcInfo.IsDir() {
+			return ErrCopyDestDirNotExists
+		}
+		dstDir, dstName = path.Split(path.Clean(dstPath))
+	case err != nil:
+		return err
+	case stat.Mode.IsDir():
+		dstDir, dstName = dstPath, filepath.Base(hostPath)
+		if srcContents {
+			dstName = ""
+		}
+	case srcInfo.IsDir():
+		return ErrCopyDirToFile
+	case dstIsDir:
+		return ErrCopyNotADirectory
+	default:
+		dstDir, dstName = path.Split(path.Clean(dstPath))
+	}
+	if dstDir == "" {
+		// relative paths start at the root of the container
+		dstDir = "/"
+	}
+	reader, writer := io.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		err := writeCopyArchive(writer, srcPath, srcInfo, dstName, options)
+		writer.CloseWithError(err)
+		errs <- err
+	}()
+	err = c.UploadToContainer(id, UploadToContainerOptions{
+		InputStream:          reader,
+		Path:                 dstDir,
+		NoOverwriteDirNonDir: true,
+		Context:              ctx,
+	})
+	reader.Close()
+	archiveErr := <-errs
+	if err != nil {
+		return err
+	}
+	if archiveErr != io.ErrClosedPipe {
+		return archiveErr
+	}
+	return nil
+}
+
+// CopyFromContainerToHost copies a file or a directory of the filesystem of a
+// container to the host, with the semantics of docker cp described in
+// CopyToContainer.
+//
+// The extraction of the files refuses, with an ErrUnsafeArchiveEntry, the
+// entries that would be written out of the destination, either with a path
+// leading out of it or through a symbolic link.
+func (c *Client) CopyFromContainerToHost(ctx context.Context, id, containerPath, hostPath string, opts ...CopyOption) error {
+	options := newCopyOptions(opts)
+	srcPath := containerPath
+	stat, err := c.ContainerStatPath(ctx, id, srcPath)
+	if err != nil {
+		return err
+	}
+	if options.followLink && stat.Mode&os.ModeSymlink != 0 {
+		srcPath = resolveLinkTarget(srcPath, stat.LinkTarget)
+		if stat, err = c.ContainerStatPath(ctx, id, srcPath); err != nil {
+			return err
+		}
+	}
+	srcIsDir, srcContents := copyPathSuffix(containerPath, '/')
+	if srcIsDir && !stat.Mode.IsDir() {
+		return ErrCopyNotADirectory
+	}
+	dstIsDir, _ := copyPathSuffix(hostPath, os.PathSeparator)
+	var dstDir, dstName string
+	dstInfo, err := os.Stat(hostPath)
+	switch {
+	case os.IsNotExist(err):
+		if dstIsDir && !stat.Mode.IsDir() {
+			return ErrCopyDestDirNotExists
+		}
+		dstDir, dstName = filepath.Split(filepath.Clean(hostPath))
+		if dstDir == "" {
+			dstDir = "."
+		}
+		if _, err := os.Stat(dstDir); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case dstInfo.IsDir():
+		dstDir, dstName = hostPath, path.Base(containerPath)
+		if srcContents {
+			dstName = ""
+		}
+	case stat.Mode.IsDir():
+		return ErrCopyDirToFile
+	case dstIsDir:
+		return ErrCopyNotADirectory
+	default:
+		dstDir, dstName = filepath.Split(filepath.Clean(hostPath))
+		if dstDir == "" {
+			dstDir = "."
+		}
+	}
+	reader, writer := io.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		err := c.DownloadFromContainer(id, DownloadFromContainerOptions{
+			OutputStream: writer,
+			Path:         path.Clean(srcPath),
+			Context:      ctx,
+		})
+		writer.CloseWithError(err)
+		errs <- err
+	}()
+	err = extractCopyArchive(reader, dstDir, dstName, options)
+	if err == nil {
+		// the padding after the end of the archive
+		_, err = io.Copy(ioutil.Discard, reader)
+	}
+	reader.CloseWithError(err)
+	downloadErr := <-errs
+	if err != nil {
+		return err
+	}
+	return downloadErr
+}
+
+func newCopyOptions(opts []CopyOption) *copyOptions {
+	var options copyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &options
+}
+
+// copyPathSuffix tells whether a path given to a copy ends with a separator,
+// asserting that it's a directory, and whether it ends with a separator
+// followed by a dot, asking for the contents of the directory.
+func copyPathSuffix(p string, separator byte) (isDir, contents bool) {
+	sep := string(separator)
+	if separator != '/' {
+		// slashes are separators on every system
+		p = strings.Replace(p, sep, "/", -1)
+	}
+	contents = p == "." || strings.HasSuffix(p, "/.")
+	return contents || strings.HasSuffix(p, "/"), contents
+}
+
+// resolveLinkTarget returns the path a symbolic link of a container resolves
+// to.
+func resolveLinkTarget(linkPath, target string) string {
+	if path.IsAbs(target) {
+		return target
+	}
+	return path.Join(path.Dir(linkPath), target)
+}
+
+// writeCopyArchive writes an archive of the given file or directory, naming
+// its root entry name, or holding only the contents of the directory if name
+// is empty.
+func writeCopyArchive(w io.Writer, srcPath string, srcInfo os.FileInfo, name string, options *copyOptions) error {
+	tw := tar.NewWriter(w)
+	if !srcInfo.IsDir() {
+		if err := writeCopyEntry(tw, srcPath, srcInfo, name, options); err != nil {
+			return err
+		}
+		return tw.Close()
+	}
+	err := filepath.Walk(srcPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcPath, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." && name == "" {
+			return nil
+		}
+		return writeCopyEntry(tw, p, info, path.Join(name, filepath.ToSlash(rel)), options)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeCopyEntry(tw *tar.Writer, p string, info os.FileInfo, name string, options *copyOptions) error {
+	if info.Mode()&os.ModeSocket != 0 {
+		// like docker cp, sockets are left out
+		return nil
+	}
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(p); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if options.idMapping != nil {
+		header.Uid, header.Gid = options.idMapping(header.Uid, header.Gid)
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// extractCopyArchive extracts an archive into the directory dir, renaming
+// its root entry name, or extracting only the contents of the root directory
+// if name is empty.
+func extractCopyArchive(r io.Reader, dir, name string, options *copyOptions) error {
+	type extractedDir struct {
+		path   string
+		header *tar.Header
+	}
+	var dirs []extractedDir
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rel, ok := rebaseEntryName(header.Name, name)
+		if !ok {
+			continue
+		}
+		target, err := extractionPath(dir, rel, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			info, err := os.Lstat(target)
+			if err == nil && !info.IsDir() {
+				return fmt.Errorf("cannot overwrite non-directory %s with a directory", target)
+			}
+			if err != nil {
+				if err := os.Mkdir(target, 0700); err != nil {
+					return err
+				}
+			}
+			dirs = append(dirs, extractedDir{path: target, header: header})
+		case tar.TypeReg, tar.TypeRegA:
+			if err := removeNonDir(target); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := removeNonDir(target); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			linkRel, ok := rebaseEntryName(header.Linkname, name)
+			if !ok {
+				return &ErrUnsafeArchiveEntry{Name: header.Linkname}
+			}
+			linkTarget, err := extractionPath(dir, linkRel, header.Linkname)
+			if err != nil {
+				return err
+			}
+			// a hard link to a symbolic link would let a later entry
+			// write through it, outside of dir
+			info, err := os.Lstat(linkTarget)
+			if err != nil {
+				return err
+			}
+			if info.Mode()&os.ModeSymlink != 0 || info.IsDir() {
+				return &ErrUnsafeArchiveEntry{Name: header.Name}
+			}
+			if err := removeNonDir(target); err != nil {
+				return err
+			}
+			if err := os.Link(linkTarget, target); err != nil {
+				return err
+			}
+		default:
+			// devices and fifos can't be copied to the host
+			continue
+		}
+		if options.idMapping != nil {
+			uid, gid := options.idMapping(header.Uid, header.Gid)
+			if err := os.Lchown(target, uid, gid); err != nil {
+				return err
+			}
+		}
+		// the mode and times of hard links are the ones of the file they
+		// link to, which were restored with it
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+			if err := restoreModeAndTimes(target, header); err != nil {
+				return err
+			}
+		}
+	}
+	// extracting files changes the modification time of their directories
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := restoreModeAndTimes(dirs[i].path, dirs[i].header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebaseEntryName replaces the root of the name of an archive entry with
+// newRoot, returning false for the root entry itself when newRoot is empty.
+func rebaseEntryName(entryName, newRoot string) (string, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(path.Clean(entryName), "/"), "/", 2)
+	if len(parts) == 1 {
+		return newRoot, newRoot != ""
+	}
+	return path.Join(newRoot, parts[1]), true
+}
+
+// extractionPath returns the path where the archive entry with the given
+// relative path is extracted into dir, making sure that it's inside dir and
+// that none of its parents is a symbolic link.
+func extractionPath(dir, rel, entryName string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(rel))
+	relTarget, err := filepath.Rel(dir, target)
+	if err != nil || relTarget == "." || relTarget == ".." || strings.HasPrefix(relTarget, ".."+string(os.PathSeparator)) {
+		return "", &ErrUnsafeArchiveEntry{Name: entryName}
+	}
+	parent := dir
+	parts := strings.Split(relTarget, string(os.PathSeparator))
+	for _, part := range parts[:len(parts)-1] {
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(parent, 0755); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 || !info.IsDir() {
+			return "", &ErrUnsafeArchiveEntry{Name: entryName}
+		}
+	}
+	return target, nil
+}
+
+// removeNonDir removes the file at the given path, if any, so it can be
+// replaced without following it if it's a symbolic link.
+func removeNonDir(p string) error {
+	info, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot overwrite directory %s with a non-directory", p)
+	}
+	return os.Remove(p)
+}
+
+func restoreModeAndTimes(p string, header *tar.Header) error {
+	mode := header.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if err := os.Chmod(p, mode); err != nil {
+		return err
+	}
+	accessTime := header.AccessTime
+	if accessTime.IsZero() {
+		accessTime = header.ModTime
+	}
+	return os.Chtimes(p, accessTime, header.ModTime)
+}
@@ -0,0 +1,303 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pathStatHeader returns the header of the response to the stat of a path in
+// a container.
+func pathStatHeader(stat ContainerPathStat) map[string]string {
+	data, _ := json.Marshal(stat)
+	return map[string]string{
+		"X-Docker-Container-Path-Stat": base64.StdEncoding.EncodeToString(data),
+		"Content-Type":                 "application/x-tar",
+	}
+}
+
+func buildTestArchive(headers ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(header.Name))
+		}
+		tw.WriteHeader(header)
+		if header.Typeflag == tar.TypeReg {
+			tw.Write([]byte(header.Name))
+		}
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func TestContainerStatPath(t *testing.T) {
+	mtime := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	stats := map[string]ContainerPathStat{
+		"/etc/hosts": {Name: "hosts", Size: 174, Mode: 0644, Mtime: mtime},
+		"/bin/sh":    {Name: "sh", Mode: os.ModeSymlink | 0777, Mtime: mtime, LinkTarget: "/bin/dash"},
+	}
+	fakeRT := &FakeRoundTripper{status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	for p, expected := range stats {
+		fakeRT.header = pathStatHeader(expected)
+		stat, err := client.ContainerStatPath(context.Background(), "web", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*stat, expected) {
+			t.Errorf("ContainerStatPath(%q): wrong stat. Want %#v. Got %#v.", p, expected, *stat)
+		}
+	}
+	fakeRT.status = http.StatusNotFound
+	fakeRT.header = nil
+	if _, err := client.ContainerStatPath(context.Background(), "web", "/missing"); err != ErrNoSuchContainerPath {
+		t.Errorf("ContainerStatPath: wrong error. Want %#v. Got %#v.", ErrNoSuchContainerPath, err)
+	}
+}
+
+func TestCopyToContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copy-to-container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0640)
+	ioutil.WriteFile(filepath.Join(src, "sub", "b"), []byte("b"), 0600)
+	os.Symlink("a", filepath.Join(src, "l"))
+	mtime := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(src, "a"), mtime, mtime)
+	stats := map[string]ContainerPathStat{
+		"/dst":  {Name: "dst", Mode: os.ModeDir | 0755},
+		"/file": {Name: "file", Mode: 0644},
+		"/link": {Name: "link", Mode: os.ModeSymlink | 0777, LinkTarget: "dst"},
+	}
+	var mu sync.Mutex
+	uploads := make(map[string][]*tar.Header)
+	uploaded := func(p string) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		var names []string
+		for _, header := range uploads[p] {
+			names = append(names, header.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := path.Clean(r.URL.Query().Get("path"))
+		if r.Method == "HEAD" {
+			stat, ok := stats[p]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			for k, v := range pathStatHeader(stat) {
+				w.Header().Set(k, v)
+			}
+			return
+		}
+		var headers []*tar.Header
+		tr := tar.NewReader(r.Body)
+		for {
+			header, err := tr.Next()
+			if err != nil {
+				break
+			}
+			headers = append(headers, header)
+		}
+		mu.Lock()
+		uploads[p] = headers
+		mu.Unlock()
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	var tests = []struct {
+		src, dst string
+		path     string
+		entries  []string
+		err      error
+	}{
+		{src: "src", dst: "/dst", path: "/dst", entries: []string{"src/", "src/a", "src/l", "src/sub/", "src/sub/b"}},
+		{src: "src/.", dst: "/dst", path: "/dst", entries: []string{"a", "l", "sub/", "sub/b"}},
+		{src: "src", dst: "/new", path: "/", entries: []string{"new/", "new/a", "new/l", "new/sub/", "new/sub/b"}},
+		{src: "src/a", dst: "/link", path: "/dst", entries: []string{"a"}},
+		{src: "src/a", dst: "/file", path: "/", entries: []string{"file"}},
+		{src: "src/a", dst: "/new/", err: ErrCopyDestDirNotExists},
+		{src: "src", dst: "/file", err: ErrCopyDirToFile},
+		{src: "src/a/", dst: "/dst", err: ErrCopyNotADirectory},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		uploads = make(map[string][]*tar.Header)
+		mu.Unlock()
+		err := client.CopyToContainer(context.Background(), "web", dir+"/"+tt.src, tt.dst)
+		if err != tt.err {
+			t.Errorf("CopyToContainer(%q, %q): wrong error. Want %v. Got %v.", tt.src, tt.dst, tt.err, err)
+		}
+		if entries := uploaded(tt.path); tt.err == nil && !reflect.DeepEqual(entries, tt.entries) {
+			t.Errorf("CopyToContainer(%q, %q): wrong entries in %q. Want %#v. Got %#v.", tt.src, tt.dst, tt.path, tt.entries, entries)
+		}
+	}
+
+	mapping := WithCopyIDMapping(func(uid, gid int) (int, int) { return 1000, 1001 })
+	if err := client.CopyToContainer(context.Background(), "web", filepath.Join(dir, "src", "a"), "/dst", mapping); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	header := uploads["/dst"][0]
+	mu.Unlock()
+	if header.Uid != 1000 || header.Gid != 1001 || header.Mode&0777 != 0640 || !header.ModTime.Equal(mtime) {
+		t.Errorf("CopyToContainer: wrong header. Got %#v.", header)
+	}
+}
+
+func TestCopyFromContainerToHost(t *testing.T) {
+	mtime := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	archive := buildTestArchive(
+		&tar.Header{Name: "data/", Typeflag: tar.TypeDir, Mode: 0750, ModTime: mtime},
+		&tar.Header{Name: "data/a", Typeflag: tar.TypeReg, Mode: 0640, ModTime: mtime},
+		&tar.Header{Name: "data/l", Typeflag: tar.TypeSymlink, Linkname: "a", ModTime: mtime},
+	)
+	stats := map[string]ContainerPathStat{
+		"/data":  {Name: "data", Mode: os.ModeDir | 0750},
+		"/hosts": {Name: "hosts", Mode: 0644},
+	}
+	archives := map[string][]byte{
+		"/data":  archive,
+		"/hosts": buildTestArchive(&tar.Header{Name: "hosts", Typeflag: tar.TypeReg, Mode: 0644, ModTime: mtime}),
+	}
+	fakeRT := &FakeRoundTripper{}
+	client := newTestClient(fakeRT)
+	dir, err := ioutil.TempDir("", "copy-from-container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "existing"), 0755)
+	os.Mkdir(filepath.Join(dir, "contents"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+	var tests = []struct {
+		src, dst string
+		file     string
+		err      error
+	}{
+		{src: "/data", dst: "existing", file: "existing/data/a"},
+		{src: "/data/.", dst: "contents", file: "contents/a"},
+		{src: "/data", dst: "new", file: "new/a"},
+		{src: "/hosts", dst: "file", file: "file"},
+		{src: "/hosts", dst: "missing/", err: ErrCopyDestDirNotExists},
+		{src: "/data", dst: "file", err: ErrCopyDirToFile},
+		{src: "/missing", dst: "existing", err: ErrNoSuchContainerPath},
+	}
+	for _, tt := range tests {
+		dst := filepath.Join(dir, tt.dst)
+		if tt.dst[len(tt.dst)-1] == '/' {
+			dst += string(os.PathSeparator)
+		}
+		fakeRT.status, fakeRT.header, fakeRT.message = http.StatusNotFound, nil, ""
+		if stat, ok := stats[path.Clean(tt.src)]; ok {
+			fakeRT.status, fakeRT.header, fakeRT.message = http.StatusOK, pathStatHeader(stat), string(archives[path.Clean(tt.src)])
+		}
+		err := client.CopyFromContainerToHost(context.Background(), "web", tt.src, dst)
+		if err != tt.err {
+			t.Errorf("CopyFromContainerToHost(%q, %q): wrong error. Want %v. Got %v.", tt.src, tt.dst, tt.err, err)
+			continue
+		}
+		if tt.err != nil {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Errorf("CopyFromContainerToHost(%q, %q): %s", tt.src, tt.dst, err)
+			continue
+		}
+		if info.Mode().Perm() != 0640 && info.Mode().Perm() != 0644 || !info.ModTime().Equal(mtime) {
+			t.Errorf("CopyFromContainerToHost(%q, %q): wrong mode or mtime. Got %v, %v.", tt.src, tt.dst, info.Mode(), info.ModTime())
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dir, "new", "l")); err != nil || link != "a" {
+		t.Errorf("CopyFromContainerToHost: wrong symbolic link. Want %q. Got %q (%v).", "a", link, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "new")); err != nil || info.Mode().Perm() != 0750 || !info.ModTime().Equal(mtime) {
+		t.Errorf("CopyFromContainerToHost: wrong directory. Got %v (%v).", info, err)
+	}
+}
+
+func TestCopyFromContainerToHostUnsafeArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copy-from-container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outside := filepath.Join(dir, "outside")
+	os.Mkdir(outside, 0755)
+	secret := filepath.Join(outside, "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	archives := map[string][]byte{
+		"/dotdot": buildTestArchive(
+			&tar.Header{Name: "dotdot/", Typeflag: tar.TypeDir, Mode: 0755},
+			&tar.Header{Name: "../../../outside/evil", Typeflag: tar.TypeReg, Mode: 0644},
+		),
+		"/link": buildTestArchive(
+			&tar.Header{Name: "link/", Typeflag: tar.TypeDir, Mode: 0755},
+			&tar.Header{Name: "link/escape", Typeflag: tar.TypeSymlink, Linkname: outside},
+			&tar.Header{Name: "link/escape/evil", Typeflag: tar.TypeReg, Mode: 0644},
+		),
+		"/hardlink": buildTestArchive(
+			&tar.Header{Name: "hardlink/", Typeflag: tar.TypeDir, Mode: 0755},
+			&tar.Header{Name: "hardlink/a", Typeflag: tar.TypeSymlink, Linkname: secret},
+			&tar.Header{Name: "hardlink/b", Typeflag: tar.TypeLink, Linkname: "hardlink/a", Mode: 0777},
+		),
+	}
+	stats := map[string]ContainerPathStat{
+		"/dotdot":   {Name: "dotdot", Mode: os.ModeDir | 0755},
+		"/link":     {Name: "link", Mode: os.ModeDir | 0755},
+		"/hardlink": {Name: "hardlink", Mode: os.ModeDir | 0755},
+	}
+	fakeRT := &FakeRoundTripper{status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	dst := filepath.Join(dir, "dst")
+	os.Mkdir(dst, 0755)
+	for _, src := range []string{"/dotdot/.", "/link", "/hardlink"} {
+		fakeRT.header, fakeRT.message = pathStatHeader(stats[path.Clean(src)]), string(archives[path.Clean(src)])
+		err := client.CopyFromContainerToHost(context.Background(), "web", src, dst)
+		if _, ok := err.(*ErrUnsafeArchiveEntry); !ok {
+			t.Errorf("CopyFromContainerToHost(%q): wrong error. Want *ErrUnsafeArchiveEntry. Got %#v.", src, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil")); !os.IsNotExist(err) {
+		t.Errorf("CopyFromContainerToHost: file extracted out of the destination.")
+	}
+	if info, err := os.Stat(secret); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("CopyFromContainerToHost: wrong mode of the file out of the destination. Want %#o. Got %#o.", 0600, info.Mode().Perm())
+	}
+}
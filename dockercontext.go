@@ -0,0 +1,229 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/pkg/homedir"
+)
+
+// DefaultDockerContext is the name of the Docker CLI context that isn't
+// stored on disk, and is configured by the environment variables
+// DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH.
+const DefaultDockerContext = "default"
+
+// NoSuchDockerContext is the error returned when a given Docker CLI context
+// does not exist.
+type NoSuchDockerContext struct {
+	Name string
+}
+
+func (err *NoSuchDockerContext) Error() string {
+	return "No such Docker context: " + err.Name
+}
+
+// DockerContext represents the docker endpoint of a context created with
+// the docker context command.
+type DockerContext struct {
+	Name          string
+	Host          string
+	SkipTLSVerify bool
+
+	// TLSConfig is nil when the context does not use TLS.
+	TLSConfig *tls.Config
+}
+
+type dockerContextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// dockerConfigDir returns the directory of the Docker CLI configuration,
+// honoring the DOCKER_CONFIG environment variable.
+func dockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	home := homedir.Get()
+	if home == "" {
+		return "", errors.New("environment variable HOME must be set if DOCKER_CONFIG is not set")
+	}
+	return filepath.Join(home, ".docker"), nil
+}
+
+// CurrentDockerContext returns the name of the Docker CLI context that the
+// docker command would use, following the same precedence: the default
+// context when DOCKER_HOST is set, then the DOCKER_CONTEXT environment
+// variable, then the currentContext in config.json.
+func CurrentDockerContext() (string, error) {
+	if os.Getenv("DOCKER_HOST") != "" {
+		return DefaultDockerContext, nil
+	}
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name, nil
+	}
+	dir, err := dockerConfigDir()
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultDockerContext, nil
+		}
+		return "", err
+	}
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", err
+	}
+	if config.CurrentContext == "" {
+		return DefaultDockerContext, nil
+	}
+	return config.CurrentContext, nil
+}
+
+// LoadDockerContext loads the Docker CLI context with the given name from
+// the contexts directory of the Docker CLI configuration. An empty name
+// loads the current context.
+//
+// The default context isn't stored on disk, so it can't be loaded by this
+// function; use NewClientFromEnv instead.
+func LoadDockerContext(name string) (*DockerContext, error) {
+	if name == "" {
+		var err error
+		name, err = CurrentDockerContext()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if name == DefaultDockerContext {
+		return nil, errors.New("the default Docker context is not stored on disk")
+	}
+	dir, err := dockerConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(digest[:])
+	data, err := ioutil.ReadFile(filepath.Join(dir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &NoSuchDockerContext{Name: name}
+		}
+		return nil, err
+	}
+	var meta dockerContextMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok {
+		return nil, errors.New("Docker context " + name + " has no docker endpoint")
+	}
+	dockerContext := DockerContext{
+		Name:          name,
+		Host:          endpoint.Host,
+		SkipTLSVerify: endpoint.SkipTLSVerify,
+	}
+	tlsConfig, err := loadDockerContextTLS(filepath.Join(dir, "contexts", "tls", id, "docker"), endpoint.SkipTLSVerify)
+	if err != nil {
+		return nil, err
+	}
+	dockerContext.TLSConfig = tlsConfig
+	return &dockerContext, nil
+}
+
+// loadDockerContextTLS builds the TLS configuration of a context from the
+// files stored in the given directory, like the Docker CLI does: the context
+// uses TLS when it has any TLS material or when it skips the verification.
+func loadDockerContextTLS(dir string, skipVerify bool) (*tls.Config, error) {
+	files := make(map[string][]byte)
+	for _, name := range []string{"ca.pem", "cert.pem", "key.pem"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		files[name] = data
+	}
+	if len(files) == 0 && !skipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: skipVerify}
+	if ca, ok := files["ca.pem"]; ok {
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("Could not add RootCA pem")
+		}
+		tlsConfig.RootCAs = caPool
+	}
+	cert, hasCert := files["cert.pem"]
+	key, hasKey := files["key.pem"]
+	if hasCert != hasKey {
+		return nil, errors.New("Both cert and key are required")
+	}
+	if hasCert {
+		tlsCert, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{tlsCert}
+	}
+	return tlsConfig, nil
+}
+
+// FromDockerContext configures the client with the endpoint and TLS settings
+// of the Docker CLI context with the given name. An empty name selects the
+// current context, as resolved by CurrentDockerContext. The default context
+// is configured from the environment, like FromEnv.
+func FromDockerContext(name string) ClientOption {
+	return func(o *clientOptions) error {
+		contextName := name
+		if contextName == "" {
+			var err error
+			contextName, err = CurrentDockerContext()
+			if err != nil {
+				return err
+			}
+		}
+		if contextName == DefaultDockerContext {
+			return FromEnv()(o)
+		}
+		dockerContext, err := LoadDockerContext(contextName)
+		if err != nil {
+			return err
+		}
+		o.endpoint = dockerContext.Host
+		o.hostSet = true
+		o.tlsConfig = dockerContext.TLSConfig
+		return nil
+	}
+}
+
+// NewClientFromDockerContext returns a Client instance ready for
+// communication with the endpoint of the Docker CLI context with the given
+// name, as created by the docker context command. An empty name selects the
+// context that the docker command would use. It will use the latest remote
+// API version available in the server.
+func NewClientFromDockerContext(name string) (*Client, error) {
+	return NewClientWithOptions(FromDockerContext(name))
+}
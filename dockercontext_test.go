@@ -0,0 +1,173 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newDockerContextHome(t *testing.T) (string, func()) {
+	home, err := ioutil.TempDir("", "docker-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := setEnv(map[string]string{
+		"HOME":           home,
+		"DOCKER_CONFIG":  "",
+		"DOCKER_CONTEXT": "",
+		"DOCKER_HOST":    "",
+	})
+	return home, func() {
+		restore()
+		os.RemoveAll(home)
+	}
+}
+
+func writeDockerContext(t *testing.T, home, name, meta string, tlsFiles ...string) {
+	digest := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(digest[:])
+	metaDir := filepath.Join(home, ".docker", "contexts", "meta", id)
+	if err := os.MkdirAll(metaDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(metaDir, "meta.json"), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if len(tlsFiles) == 0 {
+		return
+	}
+	tlsDir := filepath.Join(home, ".docker", "contexts", "tls", id, "docker")
+	if err := os.MkdirAll(tlsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range tlsFiles {
+		data, err := ioutil.ReadFile(filepath.Join("testing", "data", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(tlsDir, f), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeDockerConfig(t *testing.T, home, config string) {
+	if err := os.MkdirAll(filepath.Join(home, ".docker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, ".docker", "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCurrentDockerContext(t *testing.T) {
+	home, cleanup := newDockerContextHome(t)
+	defer cleanup()
+	name, err := CurrentDockerContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != DefaultDockerContext {
+		t.Errorf("CurrentDockerContext: wrong context without config. Want %q. Got %q.", DefaultDockerContext, name)
+	}
+	writeDockerConfig(t, home, `{"currentContext":"remote"}`)
+	var tests = []struct {
+		env      map[string]string
+		expected string
+	}{
+		{map[string]string{}, "remote"},
+		{map[string]string{"DOCKER_HOST": "tcp://localhost:2375"}, DefaultDockerContext},
+		{map[string]string{"DOCKER_CONTEXT": "other"}, "other"},
+		{map[string]string{"DOCKER_HOST": "tcp://localhost:2375", "DOCKER_CONTEXT": "other"}, DefaultDockerContext},
+	}
+	for _, tt := range tests {
+		restore := setEnv(tt.env)
+		name, err := CurrentDockerContext()
+		restore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != tt.expected {
+			t.Errorf("CurrentDockerContext(%v): Want %q. Got %q.", tt.env, tt.expected, name)
+		}
+	}
+}
+
+func TestNewClientFromDockerContext(t *testing.T) {
+	home, cleanup := newDockerContextHome(t)
+	defer cleanup()
+	writeDockerContext(t, home, "plain", `{"Name":"plain","Endpoints":{"docker":{"Host":"tcp://10.0.0.1:2375"}}}`)
+	client, err := NewClientFromDockerContext("plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.endpointURL.String() != "http://10.0.0.1:2375" {
+		t.Errorf("NewClientFromDockerContext: wrong endpoint URL. Want %q. Got %q.", "http://10.0.0.1:2375", client.endpointURL)
+	}
+	if client.TLSConfig != nil {
+		t.Errorf("NewClientFromDockerContext: expected nil TLS config, got %#v.", client.TLSConfig)
+	}
+}
+
+func TestNewClientFromDockerContextTLS(t *testing.T) {
+	home, cleanup := newDockerContextHome(t)
+	defer cleanup()
+	writeDockerContext(t, home, "secure", `{"Name":"secure","Endpoints":{"docker":{"Host":"tcp://10.0.0.2:2376","SkipTLSVerify":false}}}`, "ca.pem", "cert.pem", "key.pem")
+	writeDockerConfig(t, home, `{"currentContext":"secure"}`)
+	client, err := NewClientFromDockerContext("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.endpointURL.String() != "https://10.0.0.2:2376" {
+		t.Errorf("NewClientFromDockerContext: wrong endpoint URL. Want %q. Got %q.", "https://10.0.0.2:2376", client.endpointURL)
+	}
+	if client.TLSConfig == nil || client.TLSConfig.RootCAs == nil || len(client.TLSConfig.Certificates) != 1 {
+		t.Errorf("NewClientFromDockerContext: wrong TLS config: %#v.", client.TLSConfig)
+	}
+	if client.TLSConfig.InsecureSkipVerify {
+		t.Error("NewClientFromDockerContext: expected InsecureSkipVerify to be false, got true")
+	}
+}
+
+func TestNewClientFromDockerContextSkipTLSVerify(t *testing.T) {
+	home, cleanup := newDockerContextHome(t)
+	defer cleanup()
+	writeDockerContext(t, home, "insecure", `{"Name":"insecure","Endpoints":{"docker":{"Host":"tcp://10.0.0.3:2376","SkipTLSVerify":true}}}`)
+	dockerContext, err := LoadDockerContext("insecure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dockerContext.TLSConfig == nil || !dockerContext.TLSConfig.InsecureSkipVerify {
+		t.Errorf("LoadDockerContext: wrong TLS config: %#v.", dockerContext.TLSConfig)
+	}
+}
+
+func TestNewClientFromDockerContextDefault(t *testing.T) {
+	_, cleanup := newDockerContextHome(t)
+	defer cleanup()
+	restore := setEnv(map[string]string{"DOCKER_HOST": "tcp://localhost:2375", "DOCKER_TLS_VERIFY": ""})
+	defer restore()
+	client, err := NewClientFromDockerContext("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.endpoint != "tcp://localhost:2375" {
+		t.Errorf("NewClientFromDockerContext: wrong endpoint. Want %q. Got %q.", "tcp://localhost:2375", client.endpoint)
+	}
+}
+
+func TestNewClientFromDockerContextNotFound(t *testing.T) {
+	_, cleanup := newDockerContextHome(t)
+	defer cleanup()
+	_, err := NewClientFromDockerContext("missing")
+	if e, ok := err.(*NoSuchDockerContext); !ok || e.Name != "missing" {
+		t.Errorf("NewClientFromDockerContext: wrong error. Want %#v. Got %#v.", &NoSuchDockerContext{Name: "missing"}, err)
+	}
+}
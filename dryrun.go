@@ -0,0 +1,257 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PlannedAction is a call that a client in dry-run mode didn't make, as it
+// would have changed the state of the daemon.
+type PlannedAction struct {
+	// Operation is the name of the client method, like "CreateContainer"
+	// or "RemoveImage".
+	Operation string
+
+	// Target is the ID or name of the resource the action applies to, as
+	// given in the path of the request, if any.
+	Target string
+
+	// Options are the options given to the client method, like a
+	// CreateContainerOptions for CreateContainer, or nil if the method
+	// takes none. Registry credentials are never part of the options.
+	Options interface{}
+
+	// Method and Path are the HTTP method and the path, along with the
+	// query string, of the request that would have been sent.
+	Method string
+	Path   string
+
+	// ResultID is the synthetic ID returned for the resource the action
+	// would have created, if any.
+	ResultID string
+}
+
+// WithDryRun makes the client run in dry-run mode (see SetDryRun).
+func WithDryRun() ClientOption {
+	return func(o *clientOptions) error {
+		o.dryRun = true
+		return nil
+	}
+}
+
+// SetDryRun enables or disables the dry-run mode of the client. Calls already
+// started when SetDryRun is called aren't affected.
+//
+// In dry-run mode, calls reading the state of the daemon (listing and
+// inspecting resources, getting logs...) are made as usual, while calls that
+// would change it are added to the plan of the client (see Plan) instead.
+// They return synthetic results: created resources get a made-up ID, which
+// the daemon doesn't know about, streams have no output, and attach or exec
+// sessions end right away.
+func (c *Client) SetDryRun(enabled bool) {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+	if !enabled {
+		c.dryRun = nil
+		return
+	}
+	if c.dryRun == nil {
+		c.dryRun = &dryRunPlan{}
+	}
+}
+
+// DryRun indicates whether the client runs in dry-run mode.
+func (c *Client) DryRun() bool {
+	return c.currentDryRun() != nil
+}
+
+// Plan returns the actions planned by the client in dry-run mode, in the order
+// of the calls.
+func (c *Client) Plan() []PlannedAction {
+	plan := c.currentDryRun()
+	if plan == nil {
+		return nil
+	}
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+	return append([]PlannedAction(nil), plan.actions...)
+}
+
+// ResetPlan clears the actions planned by the client in dry-run mode.
+func (c *Client) ResetPlan() {
+	plan := c.currentDryRun()
+	if plan == nil {
+		return
+	}
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+	plan.actions = nil
+}
+
+// currentDryRun returns the plan of the client, which is nil when the client
+// isn't in dry-run mode.
+func (c *Client) currentDryRun() *dryRunPlan {
+	c.configMu.RLock()
+	defer c.configMu.RUnlock()
+	return c.dryRun
+}
+
+// readOnlyOperations are the operations that don't change the state of the
+// daemon, even though they're not GET requests.
+var readOnlyOperations = map[string]bool{
+	"AuthCheck": true,
+}
+
+type dryRunPlan struct {
+	mu      sync.Mutex
+	actions []PlannedAction
+}
+
+// dryRunResponse holds the synthetic result of a planned call.
+type dryRunResponse struct {
+	statusCode int
+	body       []byte
+}
+
+// planOf returns the plan the given call is added to instead of being made,
+// which is the case of calls changing the state of the daemon in dry-run mode.
+// It returns nil when the call is made.
+func (c *Client) planOf(method, path string) *dryRunPlan {
+	plan := c.currentDryRun()
+	if plan == nil || method == "GET" || method == "HEAD" {
+		return nil
+	}
+	if operation, _ := matchRoute(method, path); readOnlyOperations[operation] {
+		return nil
+	}
+	return plan
+}
+
+// add adds the given call to the plan, returning its synthetic result.
+func (p *dryRunPlan) add(method, path string, options interface{}, body []byte) dryRunResponse {
+	operation, target := matchRoute(method, path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	action := PlannedAction{
+		Operation: operation,
+		Target:    target,
+		Options:   options,
+		Method:    method,
+		Path:      path,
+	}
+	var response dryRunResponse
+	if synthesize, ok := syntheticResults[operation]; ok {
+		action.ResultID = syntheticID()
+		response = dryRunResponse{statusCode: http.StatusCreated, body: synthesize(action.ResultID, body)}
+	} else if body, ok := syntheticBodies[operation]; ok {
+		response = dryRunResponse{statusCode: http.StatusOK, body: []byte(body)}
+	} else {
+		response = dryRunResponse{statusCode: http.StatusNoContent}
+	}
+	p.actions = append(p.actions, action)
+	return response
+}
+
+// syntheticID returns a random ID looking like the ones of the daemon.
+func syntheticID() string {
+	id := make([]byte, 32)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// syntheticResults build the body of the response to the planned calls
+// creating resources, from the ID of the resource and the body of the
+// request.
+var syntheticResults = map[string]func(id string, body []byte) []byte{
+	"CreateContainer": syntheticIDResult,
+	"CreateExec":      syntheticIDResult,
+	"CommitContainer": syntheticIDResult,
+	"CreateNetwork":   syntheticIDResult,
+	"CreateService":   syntheticIDResult,
+	"CreateVolume": func(id string, body []byte) []byte {
+		var volume struct {
+			Name   string
+			Driver string
+		}
+		json.Unmarshal(body, &volume)
+		if volume.Name == "" {
+			volume.Name = id
+		}
+		if volume.Driver == "" {
+			volume.Driver = "local"
+		}
+		result, _ := json.Marshal(volume)
+		return result
+	},
+	"InitSwarm": func(id string, body []byte) []byte {
+		result, _ := json.Marshal(id)
+		return result
+	},
+}
+
+// syntheticBodies are the bodies of the response to the planned calls that
+// don't create resources but still return a result: nothing is waited for,
+// and nothing is pruned.
+var syntheticBodies = map[string]string{
+	"WaitContainer":   `{"StatusCode":0}`,
+	"PruneContainers": `{}`,
+	"PruneImages":     `{}`,
+	"PruneVolumes":    `{}`,
+	"PruneNetworks":   `{}`,
+}
+
+func syntheticIDResult(id string, body []byte) []byte {
+	result, _ := json.Marshal(map[string]string{"Id": id})
+	return result
+}
+
+func (r dryRunResponse) httpResponse() *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.statusCode, http.StatusText(r.statusCode)),
+		StatusCode:    r.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+	}
+}
+
+// dryRunConn is the connection of a planned attach or exec session: it
+// discards the input, and has no output.
+type dryRunConn struct{}
+
+func (dryRunConn) Read(p []byte) (int, error)         { return 0, io.EOF }
+func (dryRunConn) Write(p []byte) (int, error)        { return len(p), nil }
+func (dryRunConn) Close() error                       { return nil }
+func (dryRunConn) CloseWrite() error                  { return nil }
+func (dryRunConn) LocalAddr() net.Addr                { return dryRunAddr{} }
+func (dryRunConn) RemoteAddr() net.Addr               { return dryRunAddr{} }
+func (dryRunConn) SetDeadline(t time.Time) error      { return nil }
+func (dryRunConn) SetReadDeadline(t time.Time) error  { return nil }
+func (dryRunConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type dryRunAddr struct{}
+
+func (dryRunAddr) Network() string { return "dry-run" }
+func (dryRunAddr) String() string  { return "dry-run" }
+
+func newDryRunHijackedConn(rawTerminal bool) *HijackedConn {
+	conn := dryRunConn{}
+	return &HijackedConn{Conn: conn, Reader: bufio.NewReader(conn), rawTerminal: rawTerminal}
+}
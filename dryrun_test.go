@@ -0,0 +1,206 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/engine-api/types/swarm"
+)
+
+func TestDryRun(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "[]", status: http.StatusOK}
+	client, err := NewClientWithOptions(
+		WithHost("http://localhost:4243"),
+		WithHTTPClient(&http.Client{Transport: fakeRT}),
+		WithDryRun(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !client.DryRun() {
+		t.Fatal("DryRun: expected the client to run in dry-run mode")
+	}
+	if _, err := client.ListContainers(ListContainersOptions{All: true}); err != nil {
+		t.Fatal(err)
+	}
+	createOpts := CreateContainerOptions{Name: "web", Config: &Config{Image: "nginx"}}
+	container, err := client.CreateContainer(createOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(container.ID) != 64 || container.Name != "web" {
+		t.Errorf("CreateContainer: wrong synthetic container. Got %#v.", container)
+	}
+	if err := client.StartContainer(container.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if code, err := client.WaitContainer(container.ID); err != nil || code != 0 {
+		t.Errorf("WaitContainer: wrong synthetic result. Want 0, <nil>. Got %d, %v.", code, err)
+	}
+	volume, err := client.CreateVolume(CreateVolumeOptions{Name: "data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if volume.Name != "data" || volume.Driver != "local" {
+		t.Errorf("CreateVolume: wrong synthetic volume. Got %#v.", volume)
+	}
+	var output bytes.Buffer
+	if err := client.PullImage(PullImageOptions{Repository: "nginx", OutputStream: &output}, AuthConfiguration{Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("PullImage: expected no output, got %q.", output.String())
+	}
+	exec, err := client.CreateExec(CreateExecOptions{Container: container.ID, Cmd: []string{"ls"}, AttachStdout: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.StartExec(exec.ID, StartExecOptions{OutputStream: &output, InputStream: strings.NewReader("input")}); err != nil {
+		t.Fatal(err)
+	}
+	updateOpts := UpdateServiceOptions{ServiceSpec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "web"}}}
+	if err := client.UpdateService("svc1", updateOpts); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveImage("quay.io/org/app:1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if results, err := client.PruneImages(PruneImagesOptions{}); err != nil || len(results.ImagesDeleted) != 0 {
+		t.Errorf("PruneImages: wrong synthetic result. Want no deleted images. Got %#v, %v.", results, err)
+	}
+	fakeRT.message = `{"Status":"Login Succeeded"}`
+	if _, err := client.AuthCheck(&AuthConfiguration{Username: "user"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []string
+	for _, req := range fakeRT.requests {
+		if req.Method != "GET" {
+			changes = append(changes, req.Method+" "+req.URL.Path)
+		}
+	}
+	if expected := []string{"POST /auth"}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("DryRun: wrong requests sent to the daemon. Want %#v. Got %#v.", expected, changes)
+	}
+	plan := client.Plan()
+	var operations []string
+	for _, action := range plan {
+		operations = append(operations, action.Operation)
+	}
+	expectedOperations := []string{
+		"CreateContainer", "StartContainer", "WaitContainer", "CreateVolume", "PullImage",
+		"CreateExec", "StartExec", "UpdateService", "RemoveImage", "PruneImages",
+	}
+	if !reflect.DeepEqual(operations, expectedOperations) {
+		t.Fatalf("Plan: wrong operations. Want %#v. Got %#v.", expectedOperations, operations)
+	}
+	if opts, ok := plan[0].Options.(CreateContainerOptions); !ok || !reflect.DeepEqual(opts, createOpts) {
+		t.Errorf("Plan: wrong options for CreateContainer. Want %#v. Got %#v.", createOpts, plan[0].Options)
+	}
+	if plan[0].ResultID != container.ID || plan[0].Method != "POST" || plan[0].Path != "/containers/create?name=web" {
+		t.Errorf("Plan: wrong action for CreateContainer. Got %#v.", plan[0])
+	}
+	if plan[1].Target != container.ID || plan[1].ResultID != "" {
+		t.Errorf("Plan: wrong action for StartContainer. Got %#v.", plan[1])
+	}
+	if opts, ok := plan[4].Options.(PullImageOptions); !ok || opts.Repository != "nginx" {
+		t.Errorf("Plan: wrong options for PullImage. Got %#v.", plan[4].Options)
+	}
+	if plan[6].Target != exec.ID {
+		t.Errorf("Plan: wrong target for StartExec. Want %q. Got %q.", exec.ID, plan[6].Target)
+	}
+	if opts, ok := plan[7].Options.(UpdateServiceOptions); !ok || !reflect.DeepEqual(opts, updateOpts) || plan[7].Target != "svc1" {
+		t.Errorf("Plan: wrong action for UpdateService. Got %#v.", plan[7])
+	}
+	if plan[8].Target != "quay.io/org/app:1.0" || plan[8].Method != "DELETE" {
+		t.Errorf("Plan: wrong action for RemoveImage. Got %#v.", plan[8])
+	}
+
+	client.ResetPlan()
+	if plan := client.Plan(); len(plan) != 0 {
+		t.Errorf("ResetPlan: expected an empty plan, got %#v.", plan)
+	}
+	client.SetDryRun(false)
+	if err := client.RemoveImage("nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if req := fakeRT.requests[len(fakeRT.requests)-1]; req.Method != "DELETE" || req.URL.Path != "/images/nginx" {
+		t.Errorf("SetDryRun: expected the call to reach the daemon, got request %s %s.", req.Method, req.URL.Path)
+	}
+}
+
+func TestDryRunBuildImageHidesCredentials(t *testing.T) {
+	client := newTestClient(&FakeRoundTripper{status: http.StatusInternalServerError})
+	client.SetDryRun(true)
+	opts := BuildImageOptions{
+		Name:         "app",
+		InputStream:  bytes.NewReader(nil),
+		OutputStream: &bytes.Buffer{},
+		AuthConfigs: AuthConfigurations{Configs: map[string]AuthConfiguration{
+			"quay.io": {Username: "user", Password: "secret"},
+		}},
+	}
+	if err := client.BuildImage(opts); err != nil {
+		t.Fatal(err)
+	}
+	plan := client.Plan()
+	if len(plan) != 1 {
+		t.Fatalf("Plan: wrong number of actions. Want 1. Got %d.", len(plan))
+	}
+	planned, ok := plan[0].Options.(BuildImageOptions)
+	if !ok || planned.Name != "app" || len(planned.AuthConfigs.Configs) != 0 {
+		t.Errorf("Plan: wrong options for BuildImage. Got %#v.", plan[0].Options)
+	}
+}
+
+func TestDryRunAttachToContainerRaw(t *testing.T) {
+	client := newTestClient(&FakeRoundTripper{status: http.StatusInternalServerError})
+	client.SetDryRun(true)
+	conn, err := client.AttachToContainerRaw(AttachToContainerOptions{Container: "abc", Stdin: true, Stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if n, err := conn.Write([]byte("input")); n != 5 || err != nil {
+		t.Errorf("Write: wrong result. Want 5, <nil>. Got %d, %v.", n, err)
+	}
+	if _, err := conn.ReadFrame(); err == nil {
+		t.Error("ReadFrame: expected the planned session to have no output")
+	}
+	if plan := client.Plan(); len(plan) != 1 || plan[0].Operation != "AttachToContainer" || plan[0].Target != "abc" {
+		t.Errorf("Plan: wrong actions. Got %#v.", plan)
+	}
+}
+
+func TestSetDryRunConcurrentCalls(t *testing.T) {
+	client := newTestClient(&FakeRoundTripper{status: http.StatusInternalServerError})
+	client.AddInterceptor(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		// the fake round tripper isn't safe for concurrent use
+		return &http.Response{StatusCode: http.StatusNoContent, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := client.StartContainer("abc", nil); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			client.SetDryRun(i%2 == 0)
+			client.Plan()
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,60 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import "net/http"
+
+// IsNotFound indicates whether the given error reports that the requested
+// resource (container, image, exec instance, network, volume, service, node,
+// task or path in a container) does not exist.
+func IsNotFound(err error) bool {
+	switch e := err.(type) {
+	case *Error:
+		return e.Status == http.StatusNotFound
+	case *NoSuchContainer, *NoSuchExec, *NoSuchNetwork, *NoSuchNetworkOrContainer,
+		*NoSuchService, *NoSuchNode, *NoSuchTask:
+		return true
+	}
+	return err == ErrNoSuchImage || err == ErrNoSuchVolume || err == ErrNoSuchContainerPath
+}
+
+// IsConflict indicates whether the given error reports a conflict with the
+// current state of a resource, like creating a container with a name that is
+// already in use or removing a volume that is in use.
+func IsConflict(err error) bool {
+	if e, ok := err.(*Error); ok {
+		return e.Status == http.StatusConflict
+	}
+	return err == ErrContainerAlreadyExists || err == ErrNetworkAlreadyExists || err == ErrVolumeInUse
+}
+
+// IsUnauthorized indicates whether the given error reports that the request
+// was not authorized, for example because of invalid registry credentials.
+func IsUnauthorized(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Status == http.StatusUnauthorized
+}
+
+// IsNotModified indicates whether the given error reports that the request
+// had no effect, like starting a container that is already running or
+// stopping a container that is not running.
+func IsNotModified(err error) bool {
+	switch e := err.(type) {
+	case *Error:
+		return e.Status == http.StatusNotModified
+	case *ContainerAlreadyRunning, *ContainerNotRunning:
+		return true
+	}
+	return false
+}
+
+// IsUnavailable indicates whether the given error reports that the Docker
+// daemon could not be reached or is temporarily unable to handle the request.
+func IsUnavailable(err error) bool {
+	if e, ok := err.(*Error); ok {
+		return e.Status == http.StatusServiceUnavailable
+	}
+	return err == ErrConnectionRefused
+}
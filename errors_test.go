@@ -0,0 +1,104 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestErrorJSONMessage(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"message":"No such container: abc"}`)),
+	}
+	err := newError(resp)
+	expected := "API error (404): No such container: abc"
+	if err.Error() != expected {
+		t.Errorf("newError: wrong message. Want %q. Got %q.", expected, err.Error())
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	var tests = []struct {
+		err          error
+		notFound     bool
+		conflict     bool
+		unauthorized bool
+		notModified  bool
+		unavailable  bool
+	}{
+		{&Error{Status: http.StatusNotFound}, true, false, false, false, false},
+		{&NoSuchContainer{ID: "abc"}, true, false, false, false, false},
+		{&NoSuchExec{ID: "abc"}, true, false, false, false, false},
+		{&NoSuchNetwork{ID: "abc"}, true, false, false, false, false},
+		{&NoSuchNetworkOrContainer{NetworkID: "net", ContainerID: "abc"}, true, false, false, false, false},
+		{&NoSuchService{ID: "abc"}, true, false, false, false, false},
+		{&NoSuchNode{ID: "abc"}, true, false, false, false, false},
+		{&NoSuchTask{ID: "abc"}, true, false, false, false, false},
+		{ErrNoSuchImage, true, false, false, false, false},
+		{ErrNoSuchVolume, true, false, false, false, false},
+		{ErrNoSuchContainerPath, true, false, false, false, false},
+		{&Error{Status: http.StatusConflict}, false, true, false, false, false},
+		{ErrContainerAlreadyExists, false, true, false, false, false},
+		{ErrNetworkAlreadyExists, false, true, false, false, false},
+		{ErrVolumeInUse, false, true, false, false, false},
+		{&Error{Status: http.StatusUnauthorized}, false, false, true, false, false},
+		{&Error{Status: http.StatusNotModified}, false, false, false, true, false},
+		{&ContainerAlreadyRunning{ID: "abc"}, false, false, false, true, false},
+		{&ContainerNotRunning{ID: "abc"}, false, false, false, true, false},
+		{&Error{Status: http.StatusServiceUnavailable}, false, false, false, false, true},
+		{ErrConnectionRefused, false, false, false, false, true},
+		{&Error{Status: http.StatusInternalServerError}, false, false, false, false, false},
+		{errors.New("something else"), false, false, false, false, false},
+		{nil, false, false, false, false, false},
+	}
+	for _, tt := range tests {
+		if got := IsNotFound(tt.err); got != tt.notFound {
+			t.Errorf("IsNotFound(%#v): Want %v. Got %v.", tt.err, tt.notFound, got)
+		}
+		if got := IsConflict(tt.err); got != tt.conflict {
+			t.Errorf("IsConflict(%#v): Want %v. Got %v.", tt.err, tt.conflict, got)
+		}
+		if got := IsUnauthorized(tt.err); got != tt.unauthorized {
+			t.Errorf("IsUnauthorized(%#v): Want %v. Got %v.", tt.err, tt.unauthorized, got)
+		}
+		if got := IsNotModified(tt.err); got != tt.notModified {
+			t.Errorf("IsNotModified(%#v): Want %v. Got %v.", tt.err, tt.notModified, got)
+		}
+		if got := IsUnavailable(tt.err); got != tt.unavailable {
+			t.Errorf("IsUnavailable(%#v): Want %v. Got %v.", tt.err, tt.unavailable, got)
+		}
+	}
+}
+
+func TestErrorClassificationFromAPI(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: `{"message":"no such exec instance"}`, status: http.StatusNotFound}
+	client := newTestClient(fakeRT)
+	err := client.ResizeExecTTY("abc", 10, 20)
+	if !IsNotFound(err) {
+		t.Errorf("ResizeExecTTY: expected not found error, got %#v.", err)
+	}
+	if _, ok := err.(*NoSuchExec); !ok {
+		t.Errorf("ResizeExecTTY: wrong error type. Want *NoSuchExec. Got %#v.", err)
+	}
+	err = client.RemoveVolume("vol")
+	if err != ErrNoSuchVolume || !IsNotFound(err) {
+		t.Errorf("RemoveVolume: wrong error. Want %#v. Got %#v.", ErrNoSuchVolume, err)
+	}
+}
+
+func TestRemoveVolumeReturnsOtherErrors(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: `{"message":"daemon exploded"}`, status: http.StatusInternalServerError}
+	client := newTestClient(fakeRT)
+	err := client.RemoveVolume("vol")
+	e, ok := err.(*Error)
+	if !ok || e.Status != http.StatusInternalServerError || e.Message != "daemon exploded" {
+		t.Errorf("RemoveVolume: wrong error. Want 500 *Error. Got %#v.", err)
+	}
+}
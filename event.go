@@ -5,14 +5,13 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math"
-	"net"
 	"net/http"
-	"net/http/httputil"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -232,15 +231,22 @@ func (eventState *eventMonitoringState) monitorEvents(c *Client) {
 }
 
 func (eventState *eventMonitoringState) connectWithRetry(c *Client) error {
-	var retries int
+	policy := c.RetryPolicy
+	retry := policy.shouldRetry
+	if policy == nil {
+		// without a policy, the monitor reconnects whatever the error
+		policy = eventMonitorRetryPolicy
+		retry = func(attempt int, err error) bool {
+			return attempt+1 < policy.MaxAttempts
+		}
+	}
 	eventState.RLock()
 	eventChan := eventState.C
 	errChan := eventState.errC
 	eventState.RUnlock()
 	err := c.eventHijack(atomic.LoadInt64(&eventState.lastSeen), eventChan, errChan)
-	for ; err != nil && retries < maxMonitorConnRetries; retries++ {
-		waitTime := int64(retryInitialWaitTime * math.Pow(2, float64(retries)))
-		time.Sleep(time.Duration(waitTime) * time.Millisecond)
+	for attempt := 0; err != nil && retry(attempt, err); attempt++ {
+		policy.wait(context.Background(), attempt)
 		eventState.RLock()
 		eventChan = eventState.C
 		errChan = eventState.errC
@@ -292,33 +298,27 @@ func (c *Client) eventHijack(startTime int64, eventChan chan *APIEvents, errChan
 	if startTime != 0 {
 		uri += fmt.Sprintf("?since=%d", startTime)
 	}
-	protocol := c.endpointURL.Scheme
-	address := c.endpointURL.Path
-	if protocol != "unix" {
-		protocol = "tcp"
-		address = c.endpointURL.Host
-	}
-	var dial net.Conn
-	var err error
-	if c.TLSConfig == nil {
-		dial, err = c.Dialer.Dial(protocol, address)
-	} else {
-		dial, err = tlsDialWithDialer(c.Dialer, protocol, address, c.TLSConfig)
-	}
+	client, u := c.requestClient(uri)
+	httpClient := *client
+	// The event stream is long-lived, so it must not be interrupted by the
+	// timeout of the client.
+	httpClient.Timeout = 0
+	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
 		return err
 	}
-	conn := httputil.NewClientConn(dial, nil)
-	req, err := http.NewRequest("GET", uri, nil)
+	req.Header.Set("User-Agent", userAgent)
+	res, err := c.roundTrip(req, httpClient.Do)
 	if err != nil {
+		if strings.Contains(err.Error(), "connection refused") {
+			return ErrConnectionRefused
+		}
 		return err
 	}
-	res, err := conn.Do(req)
-	if err != nil {
-		return err
+	if res.StatusCode < 200 || res.StatusCode >= 400 {
+		return newError(res)
 	}
-	go func(res *http.Response, conn *httputil.ClientConn) {
-		defer conn.Close()
+	go func(res *http.Response) {
 		defer res.Body.Close()
 		decoder := json.NewDecoder(res.Body)
 		for {
@@ -344,7 +344,7 @@ func (c *Client) eventHijack(startTime int64, eventChan chan *APIEvents, errChan
 			transformEvent(&event)
 			eventChan <- &event
 		}
-	}(res, conn)
+	}(res)
 	return nil
 }
 
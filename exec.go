@@ -5,14 +5,15 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
-
-	"golang.org/x/net/context"
+	"time"
 )
 
 // Exec is the type representing a `docker exec` instance and containing the
@@ -41,7 +42,7 @@ type CreateExecOptions struct {
 // See https://goo.gl/1KSIb7 for more details
 func (c *Client) CreateExec(opts CreateExecOptions) (*Exec, error) {
 	path := fmt.Sprintf("/containers/%s/exec", opts.Container)
-	resp, err := c.do("POST", path, doOptions{data: opts, context: opts.Context})
+	resp, err := c.do("POST", path, doOptions{data: opts, context: opts.Context, callOptions: opts})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchContainer{ID: opts.Container}
@@ -79,6 +80,13 @@ type StartExecOptions struct {
 	// to unexpected behavior.
 	Success chan struct{} `json:"-"`
 
+	// Timeout with no data is received, it's reset every time new data
+	// arrives. When exceeded, the connection is closed and Wait returns
+	// ErrInactivityTimeout.
+	InactivityTimeout time.Duration `json:"-"`
+
+	// Context for the session. Once it's done, the connection is closed
+	// and Wait returns the error of the context.
 	Context context.Context `json:"-"`
 }
 
@@ -111,7 +119,7 @@ func (c *Client) StartExecNonBlocking(id string, opts StartExecOptions) (CloseWa
 	path := fmt.Sprintf("/exec/%s/start", id)
 
 	if opts.Detach {
-		resp, err := c.do("POST", path, doOptions{data: opts, context: opts.Context})
+		resp, err := c.do("POST", path, doOptions{data: opts, context: opts.Context, callOptions: opts})
 		if err != nil {
 			if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 				return nil, &NoSuchExec{ID: id}
@@ -122,14 +130,54 @@ func (c *Client) StartExecNonBlocking(id string, opts StartExecOptions) (CloseWa
 		return nil, nil
 	}
 
-	return c.hijack("POST", path, hijackOptions{
-		success:        opts.Success,
+	cw, err := c.hijack("POST", path, hijackOptions{
+		success:           opts.Success,
+		setRawTerminal:    opts.RawTerminal,
+		in:                opts.InputStream,
+		stdout:            opts.OutputStream,
+		stderr:            opts.ErrorStream,
+		data:              opts,
+		inactivityTimeout: opts.InactivityTimeout,
+		context:           opts.Context,
+		callOptions:       opts,
+	})
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return nil, &NoSuchExec{ID: id}
+		}
+		return nil, err
+	}
+	return cw, nil
+}
+
+// StartExecRaw starts a previously set up exec instance id, returning the raw
+// connection of the interactive session instead of copying it to the streams
+// in the options, which are ignored along with Success and InactivityTimeout.
+// The Context only applies to establishing the connection. Detached sessions
+// have no connection, so opts.Detach must be false.
+//
+// See https://goo.gl/iQCnto for more details
+func (c *Client) StartExecRaw(id string, opts StartExecOptions) (*HijackedConn, error) {
+	if id == "" {
+		return nil, &NoSuchExec{ID: id}
+	}
+	if opts.Detach {
+		return nil, errors.New("cannot take over the connection of a detached exec")
+	}
+	path := fmt.Sprintf("/exec/%s/start", id)
+	conn, err := c.hijackConn("POST", path, hijackOptions{
 		setRawTerminal: opts.RawTerminal,
-		in:             opts.InputStream,
-		stdout:         opts.OutputStream,
-		stderr:         opts.ErrorStream,
 		data:           opts,
+		context:        opts.Context,
+		callOptions:    opts,
 	})
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return nil, &NoSuchExec{ID: id}
+		}
+		return nil, err
+	}
+	return conn, nil
 }
 
 // ResizeExecTTY resizes the tty session used by the exec command id. This API
@@ -138,13 +186,22 @@ func (c *Client) StartExecNonBlocking(id string, opts StartExecOptions) (CloseWa
 //
 // See https://goo.gl/e1JpsA for more details
 func (c *Client) ResizeExecTTY(id string, height, width int) error {
+	return c.ResizeExecTTYWithContext(context.Background(), id, height, width)
+}
+
+// ResizeExecTTYWithContext resizes the tty session used by the exec command id.
+// The context can be used to cancel the request.
+func (c *Client) ResizeExecTTYWithContext(ctx context.Context, id string, height, width int) error {
 	params := make(url.Values)
 	params.Set("h", strconv.Itoa(height))
 	params.Set("w", strconv.Itoa(width))
 
 	path := fmt.Sprintf("/exec/%s/resize?%s", id, params.Encode())
-	resp, err := c.do("POST", path, doOptions{})
+	resp, err := c.do("POST", path, doOptions{idempotent: true, context: ctx})
 	if err != nil {
+		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
+			return &NoSuchExec{ID: id}
+		}
 		return err
 	}
 	resp.Body.Close()
@@ -181,8 +238,14 @@ type ExecInspect struct {
 //
 // See https://goo.gl/gPtX9R for more details
 func (c *Client) InspectExec(id string) (*ExecInspect, error) {
+	return c.InspectExecWithContext(context.Background(), id)
+}
+
+// InspectExecWithContext returns low-level information about the exec command
+// id. The context can be used to cancel the inspection.
+func (c *Client) InspectExecWithContext(ctx context.Context, id string) (*ExecInspect, error) {
 	path := fmt.Sprintf("/exec/%s/json", id)
-	resp, err := c.do("GET", path, doOptions{})
+	resp, err := c.do("GET", path, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchExec{ID: id}
@@ -0,0 +1,125 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"fmt"
+)
+
+// Feature represents a feature of the Docker API that is available only
+// starting from a given API version.
+type Feature string
+
+// Features that depend on the version of the Docker API.
+const (
+	// FeatureSwarm is the support for Swarm mode: swarm, services, nodes
+	// and tasks.
+	FeatureSwarm = Feature("swarm")
+
+	// FeatureHealthcheck is the support for container health checks
+	// (Config.Healthcheck).
+	FeatureHealthcheck = Feature("healthcheck")
+
+	// FeatureAutoRemove is the support for removing containers on the
+	// daemon side when they exit (HostConfig.AutoRemove).
+	FeatureAutoRemove = Feature("auto-remove")
+
+	// FeatureVolumeFilters is the support for filtering volumes in
+	// ListVolumes.
+	FeatureVolumeFilters = Feature("volume-filters")
+
+	// FeaturePrune is the support for removing unused containers, images,
+	// volumes and networks in a single call.
+	FeaturePrune = Feature("prune")
+
+	// FeatureDiskUsage is the support for reporting the space used by
+	// images, containers and volumes (DiskUsage).
+	FeatureDiskUsage = Feature("disk-usage")
+
+	// FeatureWaitCondition is the support for waiting for a condition
+	// other than the exit of a running container (WaitContainerOptions).
+	FeatureWaitCondition = Feature("wait-condition")
+)
+
+var featureAPIVersions = map[Feature]APIVersion{
+	FeatureSwarm:         apiVersion124,
+	FeatureHealthcheck:   apiVersion124,
+	FeatureAutoRemove:    apiVersion125,
+	FeatureVolumeFilters: apiVersion121,
+	FeaturePrune:         apiVersion125,
+	FeatureDiskUsage:     apiVersion125,
+	FeatureWaitCondition: apiVersion130,
+}
+
+// ErrAPIVersionUnsupported is the error returned when an operation requires a
+// version of the API newer than the one used by the client.
+type ErrAPIVersionUnsupported struct {
+	Feature         Feature
+	RequiredVersion APIVersion
+	CurrentVersion  APIVersion
+}
+
+func (err *ErrAPIVersionUnsupported) Error() string {
+	return fmt.Sprintf("%s requires API version %s or newer, but the client is using API version %s", err.Feature, err.RequiredVersion, err.CurrentVersion)
+}
+
+// Supports indicates whether the given feature is available in the API
+// version used by the client and supported by the server. It detects the
+// version of the server if it hasn't been detected yet, unless the client
+// skips the server version check, in which case the feature is assumed to be
+// available if the version is unknown.
+func (c *Client) Supports(feature Feature) (bool, error) {
+	required, ok := featureAPIVersions[feature]
+	if !ok {
+		return false, fmt.Errorf("unknown API feature %q", feature)
+	}
+	version, err := c.featureAPIVersion()
+	if err != nil {
+		return false, err
+	}
+	return version == nil || version.GreaterThanOrEqualTo(required), nil
+}
+
+// featureAPIVersion returns the API version that features are checked
+// against: the lowest between the version used by the client and the version
+// of the server, when they're known. It detects the version of the server,
+// unless the client skips the check, in which case only the version requested
+// by the client is considered. It returns nil if the version is unknown.
+func (c *Client) featureAPIVersion() (APIVersion, error) {
+	if err := c.ensureAPIVersion(context.Background()); err != nil {
+		return nil, err
+	}
+	c.apiVersionMu.RLock()
+	defer c.apiVersionMu.RUnlock()
+	version := c.requestedAPIVersion
+	if version == nil {
+		version = c.expectedAPIVersion
+	}
+	skipped := c.SkipServerVersionCheck && !c.negotiateAPIVersion
+	if server := c.serverAPIVersion; server != nil && !skipped && (version == nil || server.LessThan(version)) {
+		version = server
+	}
+	return version, nil
+}
+
+// requireFeature returns ErrAPIVersionUnsupported if the given feature is not
+// available in the API version used by the client or the one of the server
+// (see Supports).
+func (c *Client) requireFeature(feature Feature) error {
+	version, err := c.featureAPIVersion()
+	if err != nil {
+		return err
+	}
+	required := featureAPIVersions[feature]
+	if version != nil && version.LessThan(required) {
+		return &ErrAPIVersionUnsupported{
+			Feature:         feature,
+			RequiredVersion: required,
+			CurrentVersion:  version,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type versionServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	paths []string
+}
+
+func newVersionServer(apiVersion string) *versionServer {
+	srv := &versionServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		srv.paths = append(srv.paths, r.URL.Path)
+		srv.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/version") {
+			fmt.Fprintf(w, `{"ApiVersion":%q}`, apiVersion)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	return srv
+}
+
+func (srv *versionServer) requestedPaths() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.paths
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	var tests = []struct {
+		server    string
+		requested string
+		expected  string
+	}{
+		{"1.23", "", "1.23"},
+		{"1.30", "", maxAPIVersion.String()},
+		{"1.35", "", maxAPIVersion.String()},
+		{"1.23", "1.25", "1.23"},
+		{"1.24", "1.22", "1.22"},
+	}
+	for _, tt := range tests {
+		srv := newVersionServer(tt.server)
+		client, err := NewVersionedClient(srv.URL, tt.requested)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SkipServerVersionCheck = true
+		client.EnableAPIVersionNegotiation()
+		if _, err := client.ListContainers(ListContainersOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		expectedPaths := []string{"/version", "/v" + tt.expected + "/containers/json"}
+		if paths := srv.requestedPaths(); !reflect.DeepEqual(paths, expectedPaths) {
+			t.Errorf("negotiation (server=%s, requested=%q): wrong paths. Want %#v. Got %#v.", tt.server, tt.requested, expectedPaths, paths)
+		}
+		srv.Close()
+	}
+}
+
+func TestRequireFeatureUnsupported(t *testing.T) {
+	srv := newVersionServer("1.23")
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.EnableAPIVersionNegotiation()
+	_, err = client.ListServices(ListServicesOptions{})
+	e, ok := err.(*ErrAPIVersionUnsupported)
+	if !ok {
+		t.Fatalf("ListServices: wrong error. Want *ErrAPIVersionUnsupported. Got %#v.", err)
+	}
+	if e.Feature != FeatureSwarm || e.RequiredVersion.String() != "1.24" || e.CurrentVersion.String() != "1.23" {
+		t.Errorf("ListServices: wrong error details: %#v", e)
+	}
+	expectedMsg := "swarm requires API version 1.24 or newer, but the client is using API version 1.23"
+	if e.Error() != expectedMsg {
+		t.Errorf("ErrAPIVersionUnsupported: wrong message. Want %q. Got %q.", expectedMsg, e.Error())
+	}
+	if paths := srv.requestedPaths(); !reflect.DeepEqual(paths, []string{"/version"}) {
+		t.Errorf("ListServices: should not reach the server, got requests to %#v", paths)
+	}
+}
+
+func TestRequireFeatureCreateContainer(t *testing.T) {
+	srv := newVersionServer("1.24")
+	defer srv.Close()
+	client, err := NewVersionedClient(srv.URL, "1.24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.CreateContainer(CreateContainerOptions{
+		Config:     &Config{Image: "busybox"},
+		HostConfig: &HostConfig{AutoRemove: true},
+	})
+	if e, ok := err.(*ErrAPIVersionUnsupported); !ok || e.Feature != FeatureAutoRemove {
+		t.Errorf("CreateContainer: wrong error. Want *ErrAPIVersionUnsupported for %q. Got %#v.", FeatureAutoRemove, err)
+	}
+}
+
+func TestRequireFeatureUnknownVersion(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "[]", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	if _, err := client.ListServices(ListServicesOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireFeatureServerVersion(t *testing.T) {
+	srv := newVersionServer("1.24")
+	defer srv.Close()
+	client, err := NewVersionedClient(srv.URL, "1.30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.DiskUsage()
+	if e, ok := err.(*ErrAPIVersionUnsupported); !ok || e.Feature != FeatureDiskUsage || e.CurrentVersion.String() != "1.24" {
+		t.Errorf("DiskUsage: wrong error. Want *ErrAPIVersionUnsupported for %q at 1.24. Got %#v.", FeatureDiskUsage, err)
+	}
+	if supported, err := client.Supports(FeatureDiskUsage); err != nil || supported {
+		t.Errorf("Supports(%q): Want false. Got %v (%v).", FeatureDiskUsage, supported, err)
+	}
+}
+
+func TestSupportsSkipServerVersionCheck(t *testing.T) {
+	srv := newVersionServer("1.24")
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	supported, err := client.Supports(FeatureDiskUsage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !supported {
+		t.Errorf("Supports(%q): Want true. Got false.", FeatureDiskUsage)
+	}
+	if paths := srv.requestedPaths(); len(paths) != 0 {
+		t.Errorf("Supports: should not reach the server, got requests to %#v", paths)
+	}
+}
+
+func TestSupports(t *testing.T) {
+	srv := newVersionServer("1.24")
+	defer srv.Close()
+	// unlike NewClient, checks the version of the server
+	client, err := NewVersionedClient(srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		feature  Feature
+		expected bool
+	}{
+		{FeatureSwarm, true},
+		{FeatureHealthcheck, true},
+		{FeatureVolumeFilters, true},
+		{FeatureAutoRemove, false},
+		{FeaturePrune, false},
+		{FeatureDiskUsage, false},
+		{FeatureWaitCondition, false},
+	}
+	for _, tt := range tests {
+		supported, err := client.Supports(tt.feature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if supported != tt.expected {
+			t.Errorf("Supports(%q): Want %v. Got %v.", tt.feature, tt.expected, supported)
+		}
+	}
+	if _, err := client.Supports(Feature("teleport")); err == nil {
+		t.Error("Supports: expected non-nil error for unknown feature, got <nil>")
+	}
+	if paths := srv.requestedPaths(); len(paths) != 1 {
+		t.Errorf("Supports: expected a single request to /version, got %#v", paths)
+	}
+}
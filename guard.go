@@ -0,0 +1,200 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// GuardPolicy describes the resources that destructive calls of the client
+// must leave alone. It applies to RemoveContainer with Force, RemoveImage,
+// RemoveImageExtended, RemoveVolume, RemoveNetwork, LeaveSwarm with Force and
+// RemoveNode. The prune calls aren't checked, as the daemon picks the
+// resources they remove: protected resources should be excluded by the
+// filters of these calls, like a "label!" filter.
+//
+// Before making one of these calls, the client inspects its target, and
+// refuses the call with an ErrProtectedResource if the target is protected by
+// the policy. Containers, networks and nodes are then removed by the ID of the
+// inspected resource, so the call can't end up removing another resource that
+// took the name of the target in the meantime. If the target can't be
+// inspected, the call fails with the error of the inspection.
+type GuardPolicy struct {
+	// Labels protect the resources having any of the given labels. A
+	// resource is protected by a label when it has the label with the
+	// given value, or with any value if the given value is empty.
+	Labels map[string]string
+
+	// NamePatterns protect the resources having a name matching any of the
+	// given patterns, with the syntax of path.Match. Images are matched by
+	// the name given to the call and by their tags.
+	NamePatterns []string
+
+	// Check is called for every resource that isn't protected by its
+	// labels or name, and protects it by returning a non-nil error, which
+	// is the reason of the refusal.
+	Check func(operation string, resource GuardedResource) error
+}
+
+// GuardedResource is the target of a destructive call checked by a
+// GuardPolicy.
+type GuardedResource struct {
+	// Kind is the kind of the resource: "container", "image", "volume",
+	// "network", "node" or "swarm".
+	Kind string
+
+	ID     string
+	Names  []string
+	Labels map[string]string
+}
+
+// ErrProtectedResource is the error returned when a destructive call is
+// refused by the GuardPolicy of the client.
+type ErrProtectedResource struct {
+	Operation string
+	Resource  GuardedResource
+	Reason    string
+}
+
+func (err *ErrProtectedResource) Error() string {
+	name := err.Resource.ID
+	if len(err.Resource.Names) > 0 && err.Resource.Names[0] != name {
+		name = fmt.Sprintf("%s (%s)", err.Resource.Names[0], err.Resource.ID)
+	}
+	return fmt.Sprintf("%s refused: %s %s is protected: %s", err.Operation, err.Resource.Kind, name, err.Reason)
+}
+
+// WithGuardPolicy sets the policy protecting resources from the destructive
+// calls of the client (see GuardPolicy).
+func WithGuardPolicy(policy *GuardPolicy) ClientOption {
+	return func(o *clientOptions) error {
+		o.guard = policy
+		return nil
+	}
+}
+
+// protectedBy returns the reason why the policy protects the given resource
+// from the given operation, or an empty string if it doesn't.
+func (p *GuardPolicy) protectedBy(operation string, resource GuardedResource) string {
+	keys := make([]string, 0, len(p.Labels))
+	for key := range p.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, ok := resource.Labels[key]
+		if !ok {
+			continue
+		}
+		if expected := p.Labels[key]; expected == "" || expected == value {
+			return fmt.Sprintf("label %s=%s", key, value)
+		}
+	}
+	for _, pattern := range p.NamePatterns {
+		for _, name := range resource.Names {
+			if matched, _ := path.Match(pattern, name); matched {
+				return fmt.Sprintf("name %s matches %s", name, pattern)
+			}
+		}
+	}
+	if p.Check != nil {
+		if err := p.Check(operation, resource); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// guard resolves the target of a destructive call, and checks it against the
+// guard policy of the client. Without a policy, the target isn't inspected,
+// and the returned resource only holds the target as its ID.
+func (c *Client) guard(ctx context.Context, operation, kind, target string) (GuardedResource, error) {
+	if c.GuardPolicy == nil {
+		return GuardedResource{Kind: kind, ID: target}, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	resource, err := c.resolveResource(ctx, kind, target)
+	if err != nil {
+		return resource, err
+	}
+	if reason := c.GuardPolicy.protectedBy(operation, resource); reason != "" {
+		return resource, &ErrProtectedResource{Operation: operation, Resource: resource, Reason: reason}
+	}
+	return resource, nil
+}
+
+func (c *Client) resolveResource(ctx context.Context, kind, target string) (GuardedResource, error) {
+	resource := GuardedResource{Kind: kind, ID: target}
+	switch kind {
+	case "container":
+		container, err := c.InspectContainerWithContext(ctx, target)
+		if err != nil {
+			return resource, err
+		}
+		resource.ID = container.ID
+		resource.Names = []string{strings.TrimPrefix(container.Name, "/")}
+		if container.Config != nil {
+			resource.Labels = container.Config.Labels
+		}
+	case "image":
+		image, err := c.InspectImageWithContext(ctx, target)
+		if err != nil {
+			return resource, err
+		}
+		resource.ID = image.ID
+		if target != image.ID {
+			resource.Names = append(resource.Names, target)
+		}
+		resource.Names = append(resource.Names, image.RepoTags...)
+		if image.Config != nil {
+			resource.Labels = image.Config.Labels
+		}
+	case "volume":
+		volume, err := c.InspectVolumeWithContext(ctx, target)
+		if err != nil {
+			return resource, err
+		}
+		resource.ID = volume.Name
+		resource.Names = []string{volume.Name}
+		resource.Labels = volume.Labels
+	case "network":
+		network, err := c.NetworkInfoWithContext(ctx, target)
+		if err != nil {
+			return resource, err
+		}
+		resource.ID = network.ID
+		resource.Names = []string{network.Name}
+		resource.Labels = network.Labels
+	case "node":
+		node, err := c.InspectNodeWithContext(ctx, target)
+		if err != nil {
+			return resource, err
+		}
+		resource.ID = node.ID
+		for _, name := range []string{node.Spec.Name, node.Description.Hostname} {
+			if name != "" {
+				resource.Names = append(resource.Names, name)
+			}
+		}
+		resource.Labels = node.Spec.Labels
+	case "swarm":
+		swarm, err := c.InspectSwarm(ctx)
+		if err != nil {
+			return resource, err
+		}
+		resource.ID = swarm.ID
+		if swarm.Spec.Name != "" {
+			resource.Names = []string{swarm.Spec.Name}
+		}
+		resource.Labels = swarm.Spec.Labels
+	}
+	return resource, nil
+}
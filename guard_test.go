@@ -0,0 +1,188 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// guardChanges returns the DELETE and POST requests received by the given
+// round tripper.
+func guardChanges(rt *FakeRoundTripper) []string {
+	var changes []string
+	for _, req := range rt.requests {
+		if req.Method != "GET" {
+			changes = append(changes, req.Method+" "+req.URL.Path)
+		}
+	}
+	return changes
+}
+
+func TestGuardPolicy(t *testing.T) {
+	policy := &GuardPolicy{
+		Labels:       map[string]string{"protected": "true", "env": ""},
+		NamePatterns: []string{"prod/*", "manager*"},
+		Check: func(operation string, resource GuardedResource) error {
+			if resource.Kind == "volume" && resource.Labels["tier"] == "storage" {
+				return errors.New("storage volumes are kept")
+			}
+			return nil
+		},
+	}
+	fakeRT := &FakeRoundTripper{status: http.StatusOK}
+	client, err := NewClientWithOptions(
+		WithHost("http://localhost:4243"),
+		WithHTTPClient(&http.Client{Transport: fakeRT}),
+		WithGuardPolicy(policy),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := []struct {
+		inspected string
+		call      func() error
+		expected  ErrProtectedResource
+	}{
+		{
+			`{"Id":"c0ffee","Name":"/db","Config":{"Labels":{"protected":"true"}}}`,
+			func() error { return client.RemoveContainer(RemoveContainerOptions{ID: "db", Force: true}) },
+			ErrProtectedResource{
+				Operation: "RemoveContainer",
+				Resource:  GuardedResource{Kind: "container", ID: "c0ffee", Names: []string{"db"}, Labels: map[string]string{"protected": "true"}},
+				Reason:    "label protected=true",
+			},
+		},
+		{
+			`{"Id":"sha256:1111","RepoTags":["prod/app:1.0","app:latest"]}`,
+			func() error { return client.RemoveImageExtended("prod/app:1.0", RemoveImageOptions{Force: true}) },
+			ErrProtectedResource{
+				Operation: "RemoveImageExtended",
+				Resource:  GuardedResource{Kind: "image", ID: "sha256:1111", Names: []string{"prod/app:1.0", "prod/app:1.0", "app:latest"}},
+				Reason:    "name prod/app:1.0 matches prod/*",
+			},
+		},
+		{
+			`{"Name":"data","Driver":"local","Labels":{"tier":"storage"}}`,
+			func() error { return client.RemoveVolume("data") },
+			ErrProtectedResource{
+				Operation: "RemoveVolume",
+				Resource:  GuardedResource{Kind: "volume", ID: "data", Names: []string{"data"}, Labels: map[string]string{"tier": "storage"}},
+				Reason:    "storage volumes are kept",
+			},
+		},
+		{
+			`{"ID":"n0de","Spec":{"Labels":{"protected":"yes"}},"Description":{"Hostname":"manager1"}}`,
+			func() error { return client.RemoveNode(RemoveNodeOptions{ID: "manager1"}) },
+			ErrProtectedResource{
+				Operation: "RemoveNode",
+				Resource:  GuardedResource{Kind: "node", ID: "n0de", Names: []string{"manager1"}, Labels: map[string]string{"protected": "yes"}},
+				Reason:    "name manager1 matches manager*",
+			},
+		},
+		{
+			`{"ID":"sw4rm","Spec":{"Name":"default","Labels":{"env":"production"}}}`,
+			func() error { return client.LeaveSwarm(LeaveSwarmOptions{Force: true}) },
+			ErrProtectedResource{
+				Operation: "LeaveSwarm",
+				Resource:  GuardedResource{Kind: "swarm", ID: "sw4rm", Names: []string{"default"}, Labels: map[string]string{"env": "production"}},
+				Reason:    "label env=production",
+			},
+		},
+	}
+	for _, tt := range refused {
+		fakeRT.message = tt.inspected
+		err := tt.call()
+		e, ok := err.(*ErrProtectedResource)
+		if !ok {
+			t.Errorf("%s: wrong error. Want *ErrProtectedResource. Got %#v.", tt.expected.Operation, err)
+			continue
+		}
+		if !reflect.DeepEqual(*e, tt.expected) {
+			t.Errorf("%s: wrong error. Want %#v. Got %#v.", tt.expected.Operation, tt.expected, *e)
+		}
+	}
+	if got := guardChanges(fakeRT); len(got) != 0 {
+		t.Fatalf("GuardPolicy: expected protected resources to be left alone, got requests %#v.", got)
+	}
+
+	allowed := []struct {
+		inspected string
+		call      func() error
+	}{
+		{
+			`{"Id":"beef","Name":"/web","Config":{"Labels":{"protected":"false"}}}`,
+			func() error { return client.RemoveContainer(RemoveContainerOptions{ID: "web", Force: true}) },
+		},
+		{
+			// only forced removals of containers are guarded
+			"",
+			func() error { return client.RemoveContainer(RemoveContainerOptions{ID: "db"}) },
+		},
+		{
+			`{"Id":"sha256:2222","RepoTags":["dev/app:latest"]}`,
+			func() error { return client.RemoveImage("dev/app") },
+		},
+		{
+			`{"Name":"cache","Driver":"local"}`,
+			func() error { return client.RemoveVolume("cache") },
+		},
+		{
+			`{"Name":"backend","Id":"n3tw0rk"}`,
+			func() error { return client.RemoveNetwork("backend") },
+		},
+		{
+			`{"ID":"sw4rm","Spec":{"Name":"default","Labels":{"env":"production"}}}`,
+			func() error { return client.LeaveSwarm(LeaveSwarmOptions{}) },
+		},
+	}
+	for _, tt := range allowed {
+		fakeRT.message = tt.inspected
+		if err := tt.call(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		"DELETE /containers/beef",
+		"DELETE /containers/db",
+		"DELETE /images/dev/app",
+		"DELETE /volumes/cache",
+		"DELETE /networks/n3tw0rk",
+		"POST /swarm/leave",
+	}
+	if got := guardChanges(fakeRT); !reflect.DeepEqual(got, expected) {
+		t.Errorf("GuardPolicy: wrong requests for unprotected resources. Want %#v. Got %#v.", expected, got)
+	}
+}
+
+func TestGuardPolicyInspectionFailure(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "not found", status: http.StatusNotFound}
+	client := newTestClient(fakeRT)
+	client.GuardPolicy = &GuardPolicy{}
+	err := client.RemoveContainer(RemoveContainerOptions{ID: "missing", Force: true})
+	if e, ok := err.(*NoSuchContainer); !ok || e.ID != "missing" {
+		t.Errorf("RemoveContainer: wrong error. Want %#v. Got %#v.", &NoSuchContainer{ID: "missing"}, err)
+	}
+	if err := client.RemoveImage("nginx:missing"); err != ErrNoSuchImage {
+		t.Errorf("RemoveImage: wrong error. Want %#v. Got %#v.", ErrNoSuchImage, err)
+	}
+	if got := guardChanges(fakeRT); len(got) != 0 {
+		t.Errorf("GuardPolicy: expected no destructive request, got %#v.", got)
+	}
+}
+
+func TestProtectedResourceError(t *testing.T) {
+	err := &ErrProtectedResource{
+		Operation: "RemoveContainer",
+		Resource:  GuardedResource{Kind: "container", ID: "c0ffee", Names: []string{"db"}},
+		Reason:    "label protected=true",
+	}
+	expected := "RemoveContainer refused: container db (c0ffee) is protected: label protected=true"
+	if got := err.Error(); got != expected {
+		t.Errorf("Error: wrong message. Want %q. Got %q.", expected, got)
+	}
+}
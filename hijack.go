@@ -0,0 +1,160 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// StreamType identifies the stream of a frame in the output of an attach or
+// exec session.
+type StreamType byte
+
+// Streams of the frames in the output of attach and exec sessions.
+const (
+	Stdin  StreamType = 0
+	Stdout StreamType = 1
+	Stderr StreamType = 2
+)
+
+func (s StreamType) String() string {
+	switch s {
+	case Stdin:
+		return "stdin"
+	case Stdout:
+		return "stdout"
+	case Stderr:
+		return "stderr"
+	}
+	return fmt.Sprintf("stream(%d)", byte(s))
+}
+
+// Frame is a chunk of output from an attach or exec session, along with the
+// stream that produced it.
+type Frame struct {
+	Stream  StreamType
+	Payload []byte
+}
+
+// HijackedConn is the raw connection of an attach or exec session, taken
+// over from the HTTP connection used for starting the session.
+//
+// HijackedConn implements io.ReadWriteCloser: writes go to the input of the
+// session, and reads return the output exactly as sent by the daemon, which
+// is multiplexed unless the session uses a TTY (see ReadFrame).
+type HijackedConn struct {
+	// Conn is the connection to the Docker daemon. The output of the
+	// session must be read from Reader, which may hold data received
+	// along with the response headers.
+	Conn net.Conn
+
+	// Reader is the buffered reader for the output of the session.
+	Reader *bufio.Reader
+
+	rawTerminal  bool
+	header       [8]byte
+	release      func(error)
+	bytesRead    int64
+	bytesWritten int64
+
+	// errMu protects err, the first error of the reads and writes of the
+	// session, reported when the session ends
+	errMu sync.Mutex
+	err   error
+}
+
+func (c *HijackedConn) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	atomic.AddInt64(&c.bytesRead, int64(n))
+	c.recordError(err)
+	return n, err
+}
+
+func (c *HijackedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.bytesWritten, int64(n))
+	c.recordError(err)
+	return n, err
+}
+
+func (c *HijackedConn) recordError(err error) {
+	if err == nil || err == io.EOF {
+		return
+	}
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// CloseWrite shuts down the writing side of the connection, signaling the
+// end of the input to the daemon, while the output can still be read.
+func (c *HijackedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface {
+		CloseWrite() error
+	}); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (c *HijackedConn) Close() error {
+	c.errMu.Lock()
+	sessionErr := c.err
+	c.errMu.Unlock()
+	return c.closeWithError(sessionErr)
+}
+
+// closeWithError closes the connection, ending the session with the given
+// error.
+func (c *HijackedConn) closeWithError(sessionErr error) error {
+	err := c.Conn.Close()
+	if c.release != nil {
+		c.release(sessionErr)
+	}
+	return err
+}
+
+// ReadFrame reads the next frame of output from the session, returning
+// io.EOF when the output is over.
+//
+// When the session uses a TTY, the output isn't multiplexed, and every
+// frame holds the data available in a single read, reported as Stdout.
+func (c *HijackedConn) ReadFrame() (*Frame, error) {
+	if c.rawTerminal {
+		buf := make([]byte, 32*1024)
+		n, err := c.Read(buf)
+		if n > 0 {
+			return &Frame{Stream: Stdout, Payload: buf[:n]}, nil
+		}
+		return nil, err
+	}
+	if _, err := io.ReadFull(c, c.header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated frame header: %s", err)
+		}
+		return nil, err
+	}
+	stream := StreamType(c.header[0])
+	if stream > Stderr {
+		return nil, fmt.Errorf("unrecognized stream %d in frame header", c.header[0])
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(c.header[4:]))
+	if _, err := io.ReadFull(c, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return &Frame{Stream: stream, Payload: payload}, nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func muxFrame(stream StreamType, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = byte(stream)
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func newPipeHijackedConn(data []byte, rawTerminal bool) *HijackedConn {
+	client, server := net.Pipe()
+	go func() {
+		server.Write(data)
+		server.Close()
+	}()
+	return &HijackedConn{Conn: client, Reader: bufio.NewReader(client), rawTerminal: rawTerminal}
+}
+
+func TestHijackedConnReadFrame(t *testing.T) {
+	var data []byte
+	data = append(data, muxFrame(Stdout, "hello ")...)
+	data = append(data, muxFrame(Stderr, "oops")...)
+	data = append(data, muxFrame(Stdout, "world")...)
+	conn := newPipeHijackedConn(data, false)
+	defer conn.Close()
+	var frames []Frame
+	for {
+		frame, err := conn.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, *frame)
+	}
+	expected := []Frame{
+		{Stream: Stdout, Payload: []byte("hello ")},
+		{Stream: Stderr, Payload: []byte("oops")},
+		{Stream: Stdout, Payload: []byte("world")},
+	}
+	if !reflect.DeepEqual(frames, expected) {
+		t.Errorf("ReadFrame: wrong frames. Want %#v. Got %#v.", expected, frames)
+	}
+}
+
+func TestHijackedConnReadFrameRawTerminal(t *testing.T) {
+	conn := newPipeHijackedConn([]byte("plain tty output"), true)
+	defer conn.Close()
+	var output bytes.Buffer
+	for {
+		frame, err := conn.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.Stream != Stdout {
+			t.Errorf("ReadFrame: wrong stream. Want %s. Got %s.", Stdout, frame.Stream)
+		}
+		output.Write(frame.Payload)
+	}
+	if output.String() != "plain tty output" {
+		t.Errorf("ReadFrame: wrong output. Want %q. Got %q.", "plain tty output", output.String())
+	}
+}
+
+func TestHijackedConnReadFrameTruncated(t *testing.T) {
+	frame := muxFrame(Stdout, "truncated")
+	conn := newPipeHijackedConn(frame[:len(frame)-3], false)
+	defer conn.Close()
+	if _, err := conn.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadFrame: wrong error. Want %#v. Got %#v.", io.ErrUnexpectedEOF, err)
+	}
+	conn = newPipeHijackedConn(frame[:5], false)
+	defer conn.Close()
+	if _, err := conn.ReadFrame(); err == nil {
+		t.Error("ReadFrame: expected non-nil error for truncated header, got <nil>")
+	}
+	conn = newPipeHijackedConn(muxFrame(StreamType(7), "bad"), false)
+	defer conn.Close()
+	if _, err := conn.ReadFrame(); err == nil {
+		t.Error("ReadFrame: expected non-nil error for unknown stream, got <nil>")
+	}
+}
+
+func TestAttachToContainerRaw(t *testing.T) {
+	server := httptest.NewServer(upgradeEchoHandler(t))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.AttachToContainerRaw(AttachToContainerOptions{
+		Container:   "a123456",
+		Stdin:       true,
+		Stdout:      true,
+		Stream:      true,
+		RawTerminal: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("bridged")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	output, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "bridged" {
+		t.Errorf("AttachToContainerRaw: wrong output. Want %q. Got %q.", "bridged", string(output))
+	}
+}
+
+func TestAttachToContainerRawNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.AttachToContainerRaw(AttachToContainerOptions{Container: "a123456"})
+	expected := &NoSuchContainer{ID: "a123456"}
+	if e, ok := err.(*NoSuchContainer); !ok || e.ID != expected.ID {
+		t.Errorf("AttachToContainerRaw: wrong error. Want %#v. Got %#v.", expected, err)
+	}
+}
+
+func TestStartExecRaw(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.multiplexed-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		rw.Write(muxFrame(Stdout, "out"))
+		rw.Write(muxFrame(Stderr, "err"))
+		rw.Flush()
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.StartExecRaw("e123456", StartExecOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, expected := range []Frame{{Stream: Stdout, Payload: []byte("out")}, {Stream: Stderr, Payload: []byte("err")}} {
+		frame, err := conn.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*frame, expected) {
+			t.Errorf("StartExecRaw: wrong frame. Want %#v. Got %#v.", expected, *frame)
+		}
+	}
+	if _, err := conn.ReadFrame(); err != io.EOF {
+		t.Errorf("StartExecRaw: wrong error after last frame. Want %#v. Got %#v.", io.EOF, err)
+	}
+}
+
+func TestStartExecRawDetach(t *testing.T) {
+	client := newTestClient(&FakeRoundTripper{message: "", status: http.StatusOK})
+	if _, err := client.StartExecRaw("e123456", StartExecOptions{Detach: true}); err == nil {
+		t.Error("StartExecRaw: expected non-nil error for detached exec, got <nil>")
+	}
+}
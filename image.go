@@ -6,6 +6,7 @@ package docker
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -15,8 +16,6 @@ import (
 	"net/url"
 	"os"
 	"time"
-
-	"golang.org/x/net/context"
 )
 
 // APIImages represent an image returned in the ListImages call.
@@ -29,6 +28,22 @@ type APIImages struct {
 	ParentID    string            `json:"ParentId,omitempty" yaml:"ParentId,omitempty"`
 	RepoDigests []string          `json:"RepoDigests,omitempty" yaml:"RepoDigests,omitempty"`
 	Labels      map[string]string `json:"Labels,omitempty" yaml:"Labels,omitempty"`
+
+	// SharedSize is the size of the layers the image shares with other
+	// images, and Containers the number of containers using the image.
+	// They're reported only by DiskUsage, and are -1 when the daemon
+	// didn't compute them.
+	SharedSize int64 `json:"SharedSize,omitempty" yaml:"SharedSize,omitempty"`
+	Containers int64 `json:"Containers,omitempty" yaml:"Containers,omitempty"`
+}
+
+// UniqueSize returns the size of the layers used only by the image, or -1 if
+// the size of its shared layers is unknown.
+func (img *APIImages) UniqueSize() int64 {
+	if img.SharedSize < 0 {
+		return -1
+	}
+	return img.Size - img.SharedSize
 }
 
 // RootFS represents the underlying layers used by an image
@@ -135,7 +150,13 @@ type ImageHistory struct {
 //
 // See https://goo.gl/8bnTId for more details.
 func (c *Client) ImageHistory(name string) ([]ImageHistory, error) {
-	resp, err := c.do("GET", "/images/"+name+"/history", doOptions{})
+	return c.ImageHistoryWithContext(context.Background(), name)
+}
+
+// ImageHistoryWithContext returns the history of the image by its name or ID.
+// The context can be used to cancel the request.
+func (c *Client) ImageHistoryWithContext(ctx context.Context, name string) ([]ImageHistory, error) {
+	resp, err := c.do("GET", "/images/"+name+"/history", doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, ErrNoSuchImage
@@ -154,7 +175,16 @@ func (c *Client) ImageHistory(name string) ([]ImageHistory, error) {
 //
 // See https://goo.gl/V3ZWnK for more details.
 func (c *Client) RemoveImage(name string) error {
-	resp, err := c.do("DELETE", "/images/"+name, doOptions{})
+	return c.RemoveImageWithContext(context.Background(), name)
+}
+
+// RemoveImageWithContext removes an image by its name or ID. The context can be
+// used to cancel the request.
+func (c *Client) RemoveImageWithContext(ctx context.Context, name string) error {
+	if _, err := c.guard(ctx, "RemoveImage", "image", name); err != nil {
+		return err
+	}
+	resp, err := c.do("DELETE", "/images/"+name, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return ErrNoSuchImage
@@ -180,8 +210,11 @@ type RemoveImageOptions struct {
 //
 // See https://goo.gl/V3ZWnK for more details.
 func (c *Client) RemoveImageExtended(name string, opts RemoveImageOptions) error {
+	if _, err := c.guard(opts.Context, "RemoveImageExtended", "image", name); err != nil {
+		return err
+	}
 	uri := fmt.Sprintf("/images/%s?%s", name, queryString(&opts))
-	resp, err := c.do("DELETE", uri, doOptions{context: opts.Context})
+	resp, err := c.do("DELETE", uri, doOptions{context: opts.Context, callOptions: opts})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return ErrNoSuchImage
@@ -192,29 +225,81 @@ func (c *Client) RemoveImageExtended(name string, opts RemoveImageOptions) error
 	return nil
 }
 
+// PruneImagesOptions specify parameters to the PruneImages function.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/ImagePrune for more details.
+type PruneImagesOptions struct {
+	// Filters restrict the images to remove, by "dangling" ("true", the
+	// default, removes only untagged images, "false" all the unused
+	// ones), by "until" (a timestamp or a duration) and by "label" ("key"
+	// or "key=value", "label!" to exclude images).
+	Filters map[string][]string
+	Context context.Context
+}
+
+// PrunedImage is an image removed by PruneImages: either a tag that was
+// removed or an image that was deleted.
+type PrunedImage struct {
+	Untagged string `json:",omitempty"`
+	Deleted  string `json:",omitempty"`
+}
+
+// PruneImagesResults specify results from the PruneImages function.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/ImagePrune for more details.
+type PruneImagesResults struct {
+	ImagesDeleted  []PrunedImage
+	SpaceReclaimed int64
+}
+
+// PruneImages deletes images which are not used by any container.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/ImagePrune for more details.
+func (c *Client) PruneImages(opts PruneImagesOptions) (*PruneImagesResults, error) {
+	if err := c.requireFeature(FeaturePrune); err != nil {
+		return nil, err
+	}
+	path := "/images/prune?" + queryString(opts)
+	resp, err := c.do("POST", path, doOptions{context: opts.Context, callOptions: opts})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var results PruneImagesResults
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
+
 // InspectImage returns an image by its name or ID.
 //
 // See https://goo.gl/jHPcg6 for more details.
 func (c *Client) InspectImage(name string) (*Image, error) {
-	resp, err := c.do("GET", "/images/"+name+"/json", doOptions{})
+	return c.InspectImageWithContext(context.Background(), name)
+}
+
+// InspectImageWithContext returns an image by its name or ID. The context can be
+// used to cancel the inspection.
+func (c *Client) InspectImageWithContext(ctx context.Context, name string) (*Image, error) {
+	body, err := c.inspect(ctx, "image", name, "/images/"+name+"/json")
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, ErrNoSuchImage
 		}
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	var image Image
 
 	// if the caller elected to skip checking the server's version, assume it's the latest
-	if c.SkipServerVersionCheck || c.expectedAPIVersion.GreaterThanOrEqualTo(apiVersion112) {
-		if err := json.NewDecoder(resp.Body).Decode(&image); err != nil {
+	if c.SkipServerVersionCheck || c.getExpectedAPIVersion().GreaterThanOrEqualTo(apiVersion112) {
+		if err := json.Unmarshal(body, &image); err != nil {
 			return nil, err
 		}
 	} else {
 		var imagePre012 ImagePre012
-		if err := json.NewDecoder(resp.Body).Decode(&imagePre012); err != nil {
+		if err := json.Unmarshal(body, &imagePre012); err != nil {
 			return nil, err
 		}
 
@@ -268,6 +353,7 @@ func (c *Client) PushImage(opts PushImageOptions, auth AuthConfiguration) error
 	if err != nil {
 		return err
 	}
+	planned := opts
 	name := opts.Name
 	opts.Name = ""
 	path := "/images/" + name + "/push?" + queryString(&opts)
@@ -278,6 +364,7 @@ func (c *Client) PushImage(opts PushImageOptions, auth AuthConfiguration) error
 		stdout:            opts.OutputStream,
 		inactivityTimeout: opts.InactivityTimeout,
 		context:           opts.Context,
+		callOptions:       planned,
 	})
 }
 
@@ -313,10 +400,10 @@ func (c *Client) PullImage(opts PullImageOptions, auth AuthConfiguration) error
 	if err != nil {
 		return err
 	}
-	return c.createImage(queryString(&opts), headers, nil, opts.OutputStream, opts.RawJSONStream, opts.InactivityTimeout, opts.Context)
+	return c.createImage(queryString(&opts), headers, nil, opts.OutputStream, opts.RawJSONStream, opts.InactivityTimeout, opts.Context, opts)
 }
 
-func (c *Client) createImage(qs string, headers map[string]string, in io.Reader, w io.Writer, rawJSONStream bool, timeout time.Duration, context context.Context) error {
+func (c *Client) createImage(qs string, headers map[string]string, in io.Reader, w io.Writer, rawJSONStream bool, timeout time.Duration, context context.Context, callOptions interface{}) error {
 	path := "/images/create?" + qs
 	return c.stream("POST", path, streamOptions{
 		setRawTerminal:    true,
@@ -326,6 +413,7 @@ func (c *Client) createImage(qs string, headers map[string]string, in io.Reader,
 		rawJSONStream:     rawJSONStream,
 		inactivityTimeout: timeout,
 		context:           context,
+		callOptions:       callOptions,
 	})
 }
 
@@ -345,6 +433,7 @@ func (c *Client) LoadImage(opts LoadImageOptions) error {
 		setRawTerminal: true,
 		in:             opts.InputStream,
 		context:        opts.Context,
+		callOptions:    opts,
 	})
 }
 
@@ -428,7 +517,7 @@ func (c *Client) ImportImage(opts ImportImageOptions) error {
 		opts.InputStream = f
 		opts.Source = "-"
 	}
-	return c.createImage(queryString(&opts), nil, opts.InputStream, opts.OutputStream, opts.RawJSONStream, opts.InactivityTimeout, opts.Context)
+	return c.createImage(queryString(&opts), nil, opts.InputStream, opts.OutputStream, opts.RawJSONStream, opts.InactivityTimeout, opts.Context, opts)
 }
 
 // BuildImageOptions present the set of informations available for building an
@@ -528,6 +617,8 @@ func (c *Client) BuildImage(opts BuildImageOptions) error {
 		}
 	}
 
+	planned := opts
+	planned.AuthConfigs = AuthConfigurations{}
 	return c.stream("POST", fmt.Sprintf("/build?%s", qs), streamOptions{
 		setRawTerminal:    true,
 		rawJSONStream:     opts.RawJSONStream,
@@ -536,14 +627,12 @@ func (c *Client) BuildImage(opts BuildImageOptions) error {
 		stdout:            opts.OutputStream,
 		inactivityTimeout: opts.InactivityTimeout,
 		context:           opts.Context,
+		callOptions:       planned,
 	})
 }
 
 func (c *Client) versionedAuthConfigs(authConfigs AuthConfigurations) interface{} {
-	if c.serverAPIVersion == nil {
-		c.checkAPIVersion()
-	}
-	if c.serverAPIVersion != nil && c.serverAPIVersion.GreaterThanOrEqualTo(apiVersion119) {
+	if serverAPIVersion := c.getServerAPIVersion(); serverAPIVersion != nil && serverAPIVersion.GreaterThanOrEqualTo(apiVersion119) {
 		return AuthConfigurations119(authConfigs.Configs)
 	}
 	return authConfigs
@@ -567,7 +656,8 @@ func (c *Client) TagImage(name string, opts TagImageOptions) error {
 		return ErrNoSuchImage
 	}
 	resp, err := c.do("POST", "/images/"+name+"/tag?"+queryString(&opts), doOptions{
-		context: opts.Context,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 
 	if err != nil {
@@ -629,7 +719,13 @@ type APIImageSearch struct {
 //
 // See https://goo.gl/AYjyrF for more details.
 func (c *Client) SearchImages(term string) ([]APIImageSearch, error) {
-	resp, err := c.do("GET", "/images/search?term="+term, doOptions{})
+	return c.SearchImagesWithContext(context.Background(), term)
+}
+
+// SearchImagesWithContext searches the docker hub with the given term. The
+// context can be used to cancel the search.
+func (c *Client) SearchImagesWithContext(ctx context.Context, term string) ([]APIImageSearch, error) {
+	resp, err := c.do("GET", "/images/search?term="+term, doOptions{context: ctx})
 	if err != nil {
 		return nil, err
 	}
@@ -645,6 +741,12 @@ func (c *Client) SearchImages(term string) ([]APIImageSearch, error) {
 //
 // See https://goo.gl/AYjyrF for more details.
 func (c *Client) SearchImagesEx(term string, auth AuthConfiguration) ([]APIImageSearch, error) {
+	return c.SearchImagesExWithContext(context.Background(), term, auth)
+}
+
+// SearchImagesExWithContext searches the docker hub with the given term and
+// credentials. The context can be used to cancel the search.
+func (c *Client) SearchImagesExWithContext(ctx context.Context, term string, auth AuthConfiguration) ([]APIImageSearch, error) {
 	headers, err := headersWithAuth(auth)
 	if err != nil {
 		return nil, err
@@ -652,6 +754,7 @@ func (c *Client) SearchImagesEx(term string, auth AuthConfiguration) ([]APIImage
 
 	resp, err := c.do("GET", "/images/search?term="+term, doOptions{
 		headers: headers,
+		context: ctx,
 	})
 	if err != nil {
 		return nil, err
@@ -19,7 +19,7 @@ import (
 	"time"
 )
 
-func newTestClient(rt *FakeRoundTripper) Client {
+func newTestClient(rt *FakeRoundTripper) *Client {
 	endpoint := "http://localhost:4243"
 	u, _ := parseEndpoint("http://localhost:4243", false)
 	testAPIVersion, _ := NewAPIVersion("1.17")
@@ -31,7 +31,7 @@ func newTestClient(rt *FakeRoundTripper) Client {
 		SkipServerVersionCheck: true,
 		serverAPIVersion:       testAPIVersion,
 	}
-	return client
+	return &client
 }
 
 type stdoutMock struct {
@@ -1032,3 +1032,29 @@ func TestSearchImagesEx(t *testing.T) {
 		t.Errorf("SearchImages: Wrong return value. Want %#v. Got %#v.", expected, result)
 	}
 }
+
+func TestPruneImages(t *testing.T) {
+	body := `{"ImagesDeleted":[{"Untagged":"busybox:latest"},{"Deleted":"sha256:2b8fd9751c4c"}],"SpaceReclaimed":1093484}`
+	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	opts := PruneImagesOptions{Filters: map[string][]string{"dangling": {"false"}}}
+	results, err := client.PruneImages(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &PruneImagesResults{
+		ImagesDeleted:  []PrunedImage{{Untagged: "busybox:latest"}, {Deleted: "sha256:2b8fd9751c4c"}},
+		SpaceReclaimed: 1093484,
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("PruneImages: wrong results. Want %#v. Got %#v.", expected, results)
+	}
+	req := fakeRT.requests[0]
+	expectedURL, _ := url.Parse(client.getURL("/images/prune"))
+	if req.Method != "POST" || req.URL.Path != expectedURL.Path {
+		t.Errorf("PruneImages: wrong request. Want POST %s. Got %s %s.", expectedURL.Path, req.Method, req.URL.Path)
+	}
+	if filters := req.URL.Query().Get("filters"); filters != `{"dangling":["false"]}` {
+		t.Errorf("PruneImages: wrong filters. Want %q. Got %q.", `{"dangling":["false"]}`, filters)
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInspectCacheTTL is the time after which results are discarded from
+// the inspect cache when no TTL is given.
+const DefaultInspectCacheTTL = time.Minute
+
+// ErrInspectCacheEnabled is the error returned when enabling the inspect cache
+// of a client that already has it enabled.
+var ErrInspectCacheEnabled = errors.New("inspect cache already enabled")
+
+// InspectCacheOptions specify parameters to the EnableInspectCache function.
+type InspectCacheOptions struct {
+	// TTL is the time after which a cached result is discarded, even if no
+	// event invalidated it, so events missed while the event stream is
+	// interrupted don't keep stale results around for long. Defaults to
+	// DefaultInspectCacheTTL.
+	TTL time.Duration
+}
+
+// InspectCacheStats are the statistics of the inspect cache of a client.
+type InspectCacheStats struct {
+	// Hits and Misses are the number of inspections answered from the
+	// cache and from the daemon.
+	Hits   int64
+	Misses int64
+
+	// Invalidations is the number of results discarded because of an event
+	// or a call of the client changing the resource, and Expirations the
+	// number of results discarded because of their TTL.
+	Invalidations int64
+	Expirations   int64
+
+	// Entries is the number of resources in the cache.
+	Entries int
+}
+
+// EnableInspectCache enables a read-through cache for the results of
+// InspectContainer, InspectImage and NetworkInfo, so resources inspected
+// repeatedly are fetched from the daemon only once.
+//
+// Results are cached by the ID of the resource and by its names, and
+// discarded when an event reports a change of the resource (see
+// AddEventListener), when a call of the client changes it, or after the TTL
+// given in the options. If the event stream ends, the cache is emptied, and
+// results are only discarded after their TTL from then on.
+func (c *Client) EnableInspectCache(opts InspectCacheOptions) error {
+	if c.currentInspectCache() != nil {
+		return ErrInspectCacheEnabled
+	}
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = DefaultInspectCacheTTL
+	}
+	cache := &inspectCache{
+		ttl:     ttl,
+		entries: make(map[string]*inspectCacheEntry),
+		events:  make(chan *APIEvents, 100),
+		done:    make(chan struct{}),
+	}
+	if err := c.AddEventListener(cache.events); err != nil {
+		return err
+	}
+	c.configMu.Lock()
+	if c.inspectCache != nil {
+		// enabled by a concurrent call
+		c.configMu.Unlock()
+		c.RemoveEventListener(cache.events)
+		return ErrInspectCacheEnabled
+	}
+	c.inspectCache = cache
+	c.configMu.Unlock()
+	go cache.watch()
+	return nil
+}
+
+// DisableInspectCache disables the inspect cache of the client, discarding
+// the cached results.
+func (c *Client) DisableInspectCache() error {
+	c.configMu.Lock()
+	cache := c.inspectCache
+	c.inspectCache = nil
+	c.configMu.Unlock()
+	if cache == nil {
+		return nil
+	}
+	err := c.RemoveEventListener(cache.events)
+	close(cache.done)
+	return err
+}
+
+// InspectCacheStats returns the statistics of the inspect cache of the
+// client, which are all zero when the cache is disabled.
+func (c *Client) InspectCacheStats() InspectCacheStats {
+	cache := c.currentInspectCache()
+	if cache == nil {
+		return InspectCacheStats{}
+	}
+	return cache.stats()
+}
+
+// currentInspectCache returns the inspect cache of the client, which is nil
+// when the cache is disabled.
+func (c *Client) currentInspectCache() *inspectCache {
+	c.configMu.RLock()
+	defer c.configMu.RUnlock()
+	return c.inspectCache
+}
+
+// inspect returns the body of the response to the inspection of the given
+// resource, from the inspect cache when possible.
+func (c *Client) inspect(ctx context.Context, kind, name, path string) ([]byte, error) {
+	cache := c.currentInspectCache()
+	var generation int64
+	if cache != nil {
+		var body []byte
+		if body, generation = cache.get(kind, name); body != nil {
+			return body, nil
+		}
+	}
+	resp, err := c.do("GET", path, doOptions{context: ctx})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if cache != nil {
+		cache.put(kind, name, body, generation)
+	}
+	return body, nil
+}
+
+// cachedKinds map the first segment of API paths to the kinds of resources in
+// the inspect cache.
+var cachedKinds = map[string]string{
+	"containers": "container",
+	"images":     "image",
+	"networks":   "network",
+}
+
+// invalidatingActions are the actions of events that change the resources in
+// the inspect cache.
+var invalidatingActions = map[string]map[string]bool{
+	"container": {
+		"start": true, "stop": true, "die": true, "pause": true, "unpause": true, "rename": true,
+		"update": true, "destroy": true, "health_status": true,
+	},
+	"image": {
+		"tag": true, "untag": true, "delete": true, "pull": true, "import": true, "load": true,
+	},
+	"network": {
+		"connect": true, "disconnect": true, "destroy": true,
+	},
+}
+
+type inspectCache struct {
+	ttl    time.Duration
+	events chan *APIEvents
+	done   chan struct{}
+
+	mu sync.Mutex
+	// entries holds the cached results by kind and by ID or name, so each
+	// result appears once for every key it's known by.
+	entries map[string]*inspectCacheEntry
+	// generation is incremented by every invalidation, so results fetched
+	// while a resource is being changed are not cached.
+	generation int64
+	counters   InspectCacheStats
+}
+
+type inspectCacheEntry struct {
+	body    []byte
+	keys    []string
+	expires time.Time
+}
+
+func inspectCacheKey(kind, name string) string {
+	if kind == "container" {
+		name = strings.TrimPrefix(name, "/")
+	}
+	return kind + " " + name
+}
+
+// get returns the cached result for the given resource, or nil along with
+// the current generation of the cache.
+func (c *inspectCache) get(kind, name string) ([]byte, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[inspectCacheKey(kind, name)]; ok {
+		if time.Now().Before(entry.expires) {
+			c.counters.Hits++
+			return entry.body, c.generation
+		}
+		c.remove(entry)
+		c.counters.Expirations++
+	}
+	c.counters.Misses++
+	return nil, c.generation
+}
+
+// put caches the result of the inspection of the given resource, unless the
+// cache was invalidated since the given generation.
+func (c *inspectCache) put(kind, name string, body []byte, generation int64) {
+	var resource struct {
+		ID       string `json:"Id"`
+		Name     string
+		RepoTags []string
+	}
+	if err := json.Unmarshal(body, &resource); err != nil || resource.ID == "" {
+		return
+	}
+	names := append([]string{resource.ID, name}, resource.RepoTags...)
+	if resource.Name != "" {
+		names = append(names, resource.Name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	entry := &inspectCacheEntry{body: body, expires: time.Now().Add(c.ttl)}
+	for _, name := range names {
+		key := inspectCacheKey(kind, name)
+		if previous, ok := c.entries[key]; ok && previous != entry {
+			c.remove(previous)
+		}
+		c.entries[key] = entry
+		entry.keys = append(entry.keys, key)
+	}
+}
+
+func (c *inspectCache) remove(entry *inspectCacheEntry) {
+	for _, key := range entry.keys {
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// invalidate discards the cached results for the given resources.
+func (c *inspectCache) invalidate(kind string, names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if entry, ok := c.entries[inspectCacheKey(kind, name)]; ok {
+			c.remove(entry)
+			c.counters.Invalidations++
+		}
+	}
+}
+
+// invalidatePath discards the cached result for the resource changed by a
+// call to the given path.
+func (c *inspectCache) invalidatePath(method, path string) {
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	kind, ok := cachedKinds[segments[0]]
+	if !ok {
+		return
+	}
+	operation, target := matchRoute(method, path)
+	if pruneOperations[operation] {
+		// the pruned resources are only known from the response
+		c.flush()
+		return
+	}
+	c.invalidate(kind, target)
+}
+
+// pruneOperations remove resources in bulk, changing the cached ones in ways
+// that the path of the call doesn't tell.
+var pruneOperations = map[string]bool{
+	"PruneContainers": true,
+	"PruneImages":     true,
+	"PruneNetworks":   true,
+}
+
+func (c *inspectCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = make(map[string]*inspectCacheEntry)
+}
+
+func (c *inspectCache) stats() InspectCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.counters
+	seen := make(map[*inspectCacheEntry]bool)
+	for _, entry := range c.entries {
+		seen[entry] = true
+	}
+	stats.Entries = len(seen)
+	return stats
+}
+
+// watch invalidates the cached results as events report changes, until the
+// cache is disabled.
+func (c *inspectCache) watch() {
+	for {
+		select {
+		case event, ok := <-c.events:
+			if !ok {
+				c.flush()
+				return
+			}
+			c.handleEvent(event)
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *inspectCache) handleEvent(event *APIEvents) {
+	action := event.Action
+	if i := strings.Index(action, ":"); i >= 0 {
+		// like "health_status: healthy"
+		action = action[:i]
+	}
+	if !invalidatingActions[event.Type][action] {
+		return
+	}
+	switch event.Type {
+	case "image":
+		c.invalidate("image", event.Actor.ID, event.Actor.Attributes["name"])
+	case "network":
+		c.invalidate("network", event.Actor.ID)
+		c.invalidate("container", event.Actor.Attributes["container"])
+	default:
+		c.invalidate(event.Type, event.Actor.ID)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitInvalidations waits for the inspect cache of the client to reach the
+// given number of invalidations.
+func waitInvalidations(t *testing.T, client *Client, expected int64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for client.InspectCacheStats().Invalidations < expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("InspectCacheStats: timeout waiting for %d invalidations. Got %#v.", expected, client.InspectCacheStats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestInspectCache(t *testing.T) {
+	resources := map[string]string{
+		"/containers/web/json":        `{"Id":"5745704abe9caa5","Name":"/web","State":{"Running":true}}`,
+		"/containers/db/json":         `{"Id":"dfdf82bd3881","Name":"/db"}`,
+		"/images/busybox/json":        `{"Id":"sha256:2b8fd9751c4c","RepoTags":["busybox:latest"]}`,
+		"/networks/backend":           `{"Name":"backend","Id":"7d86d31b1478"}`,
+		"/containers/5745704abe9caa5": "",
+	}
+	events := make(chan string)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	count := func(request string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[request]
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case event := <-events:
+					w.Write([]byte(event + "\n"))
+					w.(http.Flusher).Flush()
+				case <-done:
+					return
+				}
+			}
+		}
+		mu.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		mu.Unlock()
+		body, ok := resources[r.URL.Path]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if body == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	defer close(done)
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	if err := client.EnableInspectCache(InspectCacheOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	defer client.DisableInspectCache()
+	if err := client.EnableInspectCache(InspectCacheOptions{}); err != ErrInspectCacheEnabled {
+		t.Errorf("EnableInspectCache: wrong error. Want %#v. Got %#v.", ErrInspectCacheEnabled, err)
+	}
+	for _, id := range []string{"web", "/web", "5745704abe9caa5"} {
+		container, err := client.InspectContainer(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if container.ID != "5745704abe9caa5" || !container.State.Running {
+			t.Errorf("InspectContainer(%q): wrong container. Got %#v.", id, container)
+		}
+	}
+	if n := count("GET /containers/web/json"); n != 1 {
+		t.Errorf("InspectContainer: wrong number of requests. Want 1. Got %d.", n)
+	}
+	// results are independent copies
+	container, _ := client.InspectContainer("web")
+	container.Name = "changed"
+	if container, _ = client.InspectContainer("web"); container.Name != "/web" {
+		t.Errorf("InspectContainer: cached result changed by the caller. Got %#v.", container)
+	}
+	if _, err := client.InspectImage("busybox"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.NetworkInfo("backend"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.InspectContainer("db"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.InspectContainer("missing"); err == nil {
+		t.Fatal("InspectContainer: expected non-nil error, got <nil>")
+	}
+	stats := client.InspectCacheStats()
+	expected := InspectCacheStats{Hits: 4, Misses: 5, Entries: 4}
+	if stats != expected {
+		t.Errorf("InspectCacheStats: wrong stats. Want %#v. Got %#v.", expected, stats)
+	}
+
+	events <- `{"action":"exec_start: ls","type":"container","actor":{"id":"5745704abe9caa5"},"time":1442421716}`
+	events <- `{"action":"die","type":"container","actor":{"id":"5745704abe9caa5"},"time":1442421716}`
+	waitInvalidations(t, client, 1)
+	if _, err := client.InspectContainer("web"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count("GET /containers/web/json"); n != 2 {
+		t.Errorf("InspectContainer: expected the die event to invalidate the container. Got %d requests.", n)
+	}
+
+	events <- `{"action":"untag","type":"image","actor":{"id":"sha256:2b8fd9751c4c","attributes":{"name":"busybox:latest"}},"time":1442421717}`
+	events <- `{"action":"connect","type":"network","actor":{"id":"7d86d31b1478","attributes":{"container":"dfdf82bd3881"}},"time":1442421718}`
+	waitInvalidations(t, client, 4)
+	client.InspectImage("busybox")
+	client.NetworkInfo("backend")
+	client.InspectContainer("db")
+	for _, request := range []string{"GET /images/busybox/json", "GET /networks/backend", "GET /containers/db/json"} {
+		if n := count(request); n != 2 {
+			t.Errorf("%s: expected the events to invalidate the result. Got %d requests.", request, n)
+		}
+	}
+
+	if err := client.RemoveContainer(RemoveContainerOptions{ID: "5745704abe9caa5"}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.InspectCacheStats(); stats.Invalidations != 5 {
+		t.Errorf("RemoveContainer: expected the call to invalidate the container. Got %#v.", stats)
+	}
+}
+
+func TestInspectCacheTTL(t *testing.T) {
+	done := make(chan struct{})
+	var inspections int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-done
+			return
+		}
+		atomic.AddInt32(&inspections, 1)
+		w.Write([]byte(`{"Id":"sha256:2b8fd9751c4c","RepoTags":["busybox:latest"]}`))
+	}))
+	defer server.Close()
+	defer close(done)
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	if err := client.EnableInspectCache(InspectCacheOptions{TTL: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	defer client.DisableInspectCache()
+	client.InspectImage("busybox")
+	client.InspectImage("busybox:latest")
+	time.Sleep(30 * time.Millisecond)
+	client.InspectImage("busybox")
+	if n := atomic.LoadInt32(&inspections); n != 2 {
+		t.Errorf("InspectImage: wrong number of requests. Want 2. Got %d.", n)
+	}
+	expected := InspectCacheStats{Hits: 1, Misses: 2, Expirations: 1, Entries: 1}
+	if stats := client.InspectCacheStats(); stats != expected {
+		t.Errorf("InspectCacheStats: wrong stats. Want %#v. Got %#v.", expected, stats)
+	}
+	if err := client.DisableInspectCache(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.InspectCacheStats(); stats != (InspectCacheStats{}) {
+		t.Errorf("InspectCacheStats: expected zero stats once disabled, got %#v.", stats)
+	}
+}
+
+func TestInspectCacheConcurrentCalls(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-done
+			return
+		}
+		w.Write([]byte(`{"Id":"sha256:2b8fd9751c4c","RepoTags":["busybox:latest"]}`))
+	}))
+	defer server.Close()
+	defer close(done)
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+	defer client.DisableInspectCache()
+	var enabled int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := client.InspectImage("busybox"); err != nil {
+				t.Error(err)
+			}
+			client.InspectCacheStats()
+		}()
+		go func() {
+			defer wg.Done()
+			switch err := client.EnableInspectCache(InspectCacheOptions{}); err {
+			case nil:
+				atomic.AddInt32(&enabled, 1)
+			case ErrInspectCacheEnabled:
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&enabled); n != 1 {
+		t.Errorf("EnableInspectCache: wrong number of successful calls. Want 1. Got %d.", n)
+	}
+}
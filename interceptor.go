@@ -0,0 +1,98 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// redactedValue is the value used by RedactHeaders in place of sensitive
+// header values.
+const redactedValue = "<redacted>"
+
+// sensitiveHeaders is the list of headers that may carry credentials and that
+// are redacted by RedactHeaders.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"X-Registry-Auth",
+	"X-Registry-Config",
+}
+
+// RoundTripFunc performs a single HTTP round trip against the Docker API.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+// Interceptor is a middleware that wraps every request sent by the client to
+// the Docker API, including streaming, hijacked and event monitoring
+// requests.
+//
+// An interceptor may modify the request before calling next, inspect the
+// response (or error) returned by next, or short-circuit the call by returning
+// an error without calling next. For streaming and hijacked calls, the body of
+// the response is the live stream, so interceptors must not consume it.
+type Interceptor func(req *http.Request, next RoundTripFunc) (*http.Response, error)
+
+// AddInterceptor appends the given interceptors to the chain of interceptors
+// of the client. Interceptors are invoked in the order they were added, so
+// the first interceptor added is the outermost one.
+//
+// Calls already started when AddInterceptor is called keep the interceptors
+// they started with.
+func (c *Client) AddInterceptor(interceptors ...Interceptor) {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+	c.interceptors = append(c.interceptors, interceptors...)
+}
+
+// roundTrip sends the request through the chain of interceptors, using the
+// given function to actually perform the round trip.
+func (c *Client) roundTrip(req *http.Request, send RoundTripFunc) (*http.Response, error) {
+	c.configMu.RLock()
+	interceptors := c.interceptors
+	c.configMu.RUnlock()
+	next := send
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, inner)
+		}
+	}
+	return next(req)
+}
+
+// RedactHeaders returns a copy of the given header with the value of the
+// headers that may carry credentials (Authorization, X-Registry-Auth and
+// X-Registry-Config) replaced by a placeholder. It's useful for logging
+// requests in interceptors.
+func RedactHeaders(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for k, v := range h {
+		redacted[k] = append([]string(nil), v...)
+	}
+	for _, name := range sensitiveHeaders {
+		if _, ok := redacted[http.CanonicalHeaderKey(name)]; ok {
+			redacted.Set(name, redactedValue)
+		}
+	}
+	return redacted
+}
+
+// LoggingInterceptor returns an interceptor that logs every request sent to
+// the Docker API, along with the status of the response and the time it took
+// to get it. Headers that may carry credentials are redacted.
+func LoggingInterceptor(logger *log.Logger) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next(req)
+		elapsed := time.Since(start)
+		if err != nil {
+			logger.Printf("docker: %s %s %v: error after %s: %s", req.Method, req.URL, RedactHeaders(req.Header), elapsed, err)
+			return resp, err
+		}
+		logger.Printf("docker: %s %s %v: %d after %s", req.Method, req.URL, RedactHeaders(req.Header), resp.StatusCode, elapsed)
+		return resp, err
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInterceptorChainOrder(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+			calls = append(calls, name+":before")
+			req.Header.Add("X-Interceptor", name)
+			resp, err := next(req)
+			if err == nil {
+				calls = append(calls, name+":after:"+http.StatusText(resp.StatusCode))
+			}
+			return resp, err
+		}
+	}
+	client.AddInterceptor(record("first"), record("second"))
+	if err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"first:before", "second:before", "second:after:OK", "first:after:OK"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Interceptors: wrong calls. Want %#v. Got %#v.", expected, calls)
+	}
+	req := fakeRT.requests[0]
+	if got := req.Header["X-Interceptor"]; !reflect.DeepEqual(got, []string{"first", "second"}) {
+		t.Errorf("Interceptors: wrong headers. Want %#v. Got %#v.", []string{"first", "second"}, got)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	errDenied := errors.New("denied by policy")
+	client.AddInterceptor(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		return nil, errDenied
+	})
+	err := client.Ping()
+	if err != errDenied {
+		t.Errorf("Ping: wrong error. Want %#v. Got %#v.", errDenied, err)
+	}
+	if len(fakeRT.requests) != 0 {
+		t.Errorf("Ping: expected no requests to be sent, got %d.", len(fakeRT.requests))
+	}
+}
+
+func TestInterceptorStreamAndHijack(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var seen []string
+	client.AddInterceptor(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		resp, err := next(req)
+		if err != nil {
+			return resp, err
+		}
+		mu.Lock()
+		seen = append(seen, req.Method+req.URL.Path)
+		mu.Unlock()
+		return resp, err
+	})
+	if _, err := client.do("GET", "/do", doOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.stream("GET", "/stream", streamOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	cw, err := client.hijack("POST", "/hijack", hijackOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw.Wait()
+	cw.Close()
+	expected := []string{"GET/do", "GET/stream", "POST/hijack"}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Interceptors: wrong requests. Want %#v. Got %#v.", expected, seen)
+	}
+}
+
+func TestInterceptorHijackShortCircuit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+	}))
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errDenied := errors.New("denied by policy")
+	client.AddInterceptor(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		return nil, errDenied
+	})
+	cw, err := client.hijack("POST", "/hijack", hijackOptions{success: make(chan struct{})})
+	if err != errDenied {
+		t.Errorf("hijack: wrong error. Want %#v. Got %#v.", errDenied, err)
+	}
+	if cw != nil {
+		t.Errorf("hijack: expected nil CloseWaiter, got %#v.", cw)
+	}
+}
+
+func TestAddInterceptorConcurrentCalls(t *testing.T) {
+	client := newTestClient(&FakeRoundTripper{message: "", status: http.StatusOK})
+	errDenied := errors.New("denied by policy")
+	var intercepted int64
+	deny := func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		atomic.AddInt64(&intercepted, 1)
+		return nil, errDenied
+	}
+	client.AddInterceptor(deny)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			client.AddInterceptor(deny)
+		}()
+		go func() {
+			defer wg.Done()
+			if err := client.Ping(); err != errDenied {
+				t.Errorf("Ping: wrong error. Want %#v. Got %#v.", errDenied, err)
+			}
+		}()
+	}
+	wg.Wait()
+	// the outermost interceptor short-circuits every call
+	if n := atomic.LoadInt64(&intercepted); n != 10 {
+		t.Errorf("Interceptors: wrong number of intercepted calls. Want 10. Got %d.", n)
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Registry-Auth", "secret")
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Content-Type", "application/json")
+	redacted := RedactHeaders(h)
+	if got := redacted.Get("X-Registry-Auth"); got != redactedValue {
+		t.Errorf("RedactHeaders: wrong X-Registry-Auth. Want %q. Got %q.", redactedValue, got)
+	}
+	if got := redacted.Get("Authorization"); got != redactedValue {
+		t.Errorf("RedactHeaders: wrong Authorization. Want %q. Got %q.", redactedValue, got)
+	}
+	if got := redacted.Get("Content-Type"); got != "application/json" {
+		t.Errorf("RedactHeaders: wrong Content-Type. Want %q. Got %q.", "application/json", got)
+	}
+	if _, ok := redacted["X-Registry-Config"]; ok {
+		t.Error("RedactHeaders: should not add missing headers")
+	}
+	if got := h.Get("X-Registry-Auth"); got != "secret" {
+		t.Errorf("RedactHeaders: original header modified. Want %q. Got %q.", "secret", got)
+	}
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	var buf bytes.Buffer
+	client.AddInterceptor(LoggingInterceptor(log.New(&buf, "", 0)))
+	err := client.PullImage(PullImageOptions{Repository: "base"}, AuthConfiguration{Password: "s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "POST") || !strings.Contains(output, "/images/create") {
+		t.Errorf("LoggingInterceptor: request not logged. Got %q.", output)
+	}
+	if !strings.Contains(output, redactedValue) {
+		t.Errorf("LoggingInterceptor: X-Registry-Auth not redacted. Got %q.", output)
+	}
+	if fakeRT.requests[0].Header.Get("X-Registry-Auth") == redactedValue {
+		t.Error("LoggingInterceptor: request header should not be modified")
+	}
+}
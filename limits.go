@@ -0,0 +1,288 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRequestLimitExceeded is returned when a call can't even wait for its
+// turn, because too many calls are already waiting for the limits of the
+// client.
+var ErrRequestLimitExceeded = errors.New("too many calls waiting for the request limits of the client")
+
+// Limits throttle the calls made by a client to the Docker daemon. Zero
+// values mean no limit.
+//
+// Calls waiting for their turn give up when their context is done.
+type Limits struct {
+	// MaxInFlight is the maximum number of short calls in flight. A call
+	// is in flight until the body of its response is closed.
+	MaxInFlight int
+
+	// MaxStreams is the maximum number of long-lived calls in flight:
+	// streams (logs, stats, pull, build...), attach or exec sessions and
+	// waits for containers. They don't count against MaxInFlight. The
+	// connection of the event monitor isn't limited.
+	MaxStreams int
+
+	// RequestsPerSecond is the rate at which calls are allowed, with
+	// bursts of up to Burst calls.
+	RequestsPerSecond float64
+
+	// Burst is the maximum number of calls allowed at once by
+	// RequestsPerSecond. Defaults to RequestsPerSecond, rounded up.
+	Burst int
+
+	// MaxQueued is the maximum number of calls waiting for their turn.
+	// Calls beyond it fail with ErrRequestLimitExceeded.
+	MaxQueued int
+}
+
+// LimiterStats describe the calls throttled by the limits of a client.
+type LimiterStats struct {
+	// Queued is the number of calls waiting for their turn.
+	Queued int64
+
+	// InFlight is the number of short calls in flight.
+	InFlight int64
+
+	// StreamsInFlight is the number of streams and attach or exec
+	// sessions in flight.
+	StreamsInFlight int64
+
+	// Rejected is the number of calls that gave up waiting for their
+	// turn, or that couldn't wait at all.
+	Rejected int64
+}
+
+// WithLimits sets the limits throttling the calls made by the client.
+func WithLimits(limits Limits) ClientOption {
+	return func(o *clientOptions) error {
+		if limits.MaxInFlight < 0 || limits.MaxStreams < 0 || limits.RequestsPerSecond < 0 || limits.Burst < 0 || limits.MaxQueued < 0 {
+			return errors.New("limits must not be negative")
+		}
+		o.limits = &limits
+		return nil
+	}
+}
+
+// SetLimits changes the limits throttling the calls made by the client.
+//
+// Calls already started when SetLimits is called keep the limits they started
+// with, and don't count against the new ones.
+func (c *Client) SetLimits(limits Limits) {
+	l := newLimiter(limits)
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+	c.limiter = l
+}
+
+// currentLimiter returns the limiter of the client, which is nil when the
+// client has no limits.
+func (c *Client) currentLimiter() *limiter {
+	c.configMu.RLock()
+	defer c.configMu.RUnlock()
+	return c.limiter
+}
+
+// LimiterStats returns the current state of the calls throttled by the limits
+// of the client.
+func (c *Client) LimiterStats() LimiterStats {
+	l := c.currentLimiter()
+	if l == nil {
+		return LimiterStats{}
+	}
+	return LimiterStats{
+		Queued:          atomic.LoadInt64(&l.queued),
+		InFlight:        atomic.LoadInt64(&l.inFlight),
+		StreamsInFlight: atomic.LoadInt64(&l.streamsInFlight),
+		Rejected:        atomic.LoadInt64(&l.rejected),
+	}
+}
+
+// limiter enforces the limits of a client. A nil limiter doesn't limit
+// anything.
+type limiter struct {
+	limits  Limits
+	calls   chan struct{}
+	streams chan struct{}
+	bucket  *tokenBucket
+
+	queued          int64
+	inFlight        int64
+	streamsInFlight int64
+	rejected        int64
+}
+
+func newLimiter(limits Limits) *limiter {
+	l := limiter{limits: limits}
+	if limits.MaxInFlight > 0 {
+		l.calls = make(chan struct{}, limits.MaxInFlight)
+	}
+	if limits.MaxStreams > 0 {
+		l.streams = make(chan struct{}, limits.MaxStreams)
+	}
+	if limits.RequestsPerSecond > 0 {
+		burst := float64(limits.Burst)
+		if burst == 0 {
+			burst = math.Ceil(limits.RequestsPerSecond)
+		}
+		l.bucket = &tokenBucket{
+			rate:   limits.RequestsPerSecond,
+			burst:  burst,
+			tokens: burst,
+			last:   time.Now(),
+		}
+	}
+	return &l
+}
+
+// acquire waits for the turn of a call, returning the function releasing it
+// once the call is over. Only the calls that have to wait count as queued.
+func (l *limiter) acquire(ctx context.Context, stream bool) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	sem, counter := l.calls, &l.inFlight
+	if stream {
+		sem, counter = l.streams, &l.streamsInFlight
+	}
+	if !l.tryAcquire(sem) {
+		queued := atomic.AddInt64(&l.queued, 1)
+		defer atomic.AddInt64(&l.queued, -1)
+		if l.limits.MaxQueued > 0 && queued > int64(l.limits.MaxQueued) {
+			atomic.AddInt64(&l.rejected, 1)
+			return nil, ErrRequestLimitExceeded
+		}
+		if err := l.wait(ctx, sem); err != nil {
+			atomic.AddInt64(&l.rejected, 1)
+			return nil, err
+		}
+	}
+	atomic.AddInt64(counter, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(counter, -1)
+			if sem != nil {
+				<-sem
+			}
+		})
+	}, nil
+}
+
+// tryAcquire takes a token and a slot of the semaphore if both are available
+// right away. Otherwise it takes none of them.
+func (l *limiter) tryAcquire(sem chan struct{}) bool {
+	if l.bucket != nil && !l.bucket.tryTake() {
+		return false
+	}
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+		default:
+			if l.bucket != nil {
+				l.bucket.putBack()
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// wait takes a token and a slot of the semaphore, waiting for them to be
+// available unless the context is done first.
+func (l *limiter) wait(ctx context.Context, sem chan struct{}) error {
+	if l.bucket != nil {
+		if err := l.bucket.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// tokenBucket allows calls at a steady rate, with bursts of up to its size.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// wait takes a token from the bucket, waiting for it to be available unless
+// the context is done first.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	b.refill()
+	b.tokens--
+	missing := -b.tokens
+	b.mu.Unlock()
+	if missing <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(missing / b.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.putBack()
+		return ctx.Err()
+	}
+}
+
+// tryTake takes a token from the bucket if one is available right away.
+func (b *tokenBucket) tryTake() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// putBack returns a token taken from the bucket.
+func (b *tokenBucket) putBack() {
+	b.mu.Lock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+	b.mu.Unlock()
+}
+
+// refill adds the tokens accumulated since the last update of the bucket. It
+// must be called with the lock held.
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// releaseOnClose calls release once the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
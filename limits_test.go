@@ -0,0 +1,308 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBlockingServer returns a server that holds the requests until unblock
+// is closed, tracking the highest number of requests handled at once.
+func newBlockingServer(unblock <-chan struct{}) (*httptest.Server, *int32) {
+	var current, highest int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			h := atomic.LoadInt32(&highest)
+			if n <= h || atomic.CompareAndSwapInt32(&highest, h, n) {
+				break
+			}
+		}
+		<-unblock
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Id":"abc","State":{}}`))
+	}))
+	return srv, &highest
+}
+
+func waitLimiterStats(t *testing.T, client *Client, cond func(LimiterStats) bool) LimiterStats {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := client.LimiterStats()
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("LimiterStats: timed out waiting for stats, last: %#v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLimitsMaxInFlight(t *testing.T) {
+	unblock := make(chan struct{})
+	srv, highest := newBlockingServer(unblock)
+	defer srv.Close()
+	client, err := NewClientWithOptions(WithHost(srv.URL), WithLimits(Limits{MaxInFlight: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.InspectContainer("abc"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	stats := waitLimiterStats(t, client, func(s LimiterStats) bool { return s.InFlight == 2 && s.Queued == 4 })
+	if stats.Rejected != 0 {
+		t.Errorf("LimiterStats: wrong number of rejected calls. Want 0. Got %d.", stats.Rejected)
+	}
+	close(unblock)
+	wg.Wait()
+	if n := atomic.LoadInt32(highest); n != 2 {
+		t.Errorf("MaxInFlight: wrong number of concurrent requests. Want 2. Got %d.", n)
+	}
+	if stats := client.LimiterStats(); stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("LimiterStats: expected no call in flight or queued, got %#v.", stats)
+	}
+}
+
+func TestLimitsMaxQueued(t *testing.T) {
+	unblock := make(chan struct{})
+	srv, _ := newBlockingServer(unblock)
+	defer srv.Close()
+	client, err := NewClientWithOptions(WithHost(srv.URL), WithLimits(Limits{MaxInFlight: 1, MaxQueued: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.InspectContainer("abc")
+		errs <- err
+	}()
+	waitLimiterStats(t, client, func(s LimiterStats) bool { return s.InFlight == 1 && s.Queued == 0 })
+	go func() {
+		_, err := client.InspectContainer("abc")
+		errs <- err
+	}()
+	waitLimiterStats(t, client, func(s LimiterStats) bool { return s.Queued == 1 })
+	if _, err := client.InspectContainer("abc"); err != ErrRequestLimitExceeded {
+		t.Errorf("InspectContainer: wrong error. Want %#v. Got %#v.", ErrRequestLimitExceeded, err)
+	}
+	close(unblock)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if stats := client.LimiterStats(); stats.Rejected != 1 {
+		t.Errorf("LimiterStats: wrong number of rejected calls. Want 1. Got %d.", stats.Rejected)
+	}
+}
+
+func TestLimitsContextWhileQueued(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/logs") {
+			<-unblock
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Id":"abc","State":{}}`))
+	}))
+	defer srv.Close()
+	defer close(unblock)
+	client, err := NewClientWithOptions(WithHost(srv.URL), WithLimits(Limits{MaxInFlight: 1, MaxStreams: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Logs(LogsOptions{Container: "abc", OutputStream: &bytes.Buffer{}, Stdout: true})
+	waitLimiterStats(t, client, func(s LimiterStats) bool { return s.StreamsInFlight == 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = client.Logs(LogsOptions{Container: "abc", OutputStream: &bytes.Buffer{}, Stdout: true, Context: ctx})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Logs: wrong error. Want %#v. Got %#v.", context.DeadlineExceeded, err)
+	}
+	// streams don't take the budget of short calls
+	if _, err := client.InspectContainer("abc"); err != nil {
+		t.Fatal(err)
+	}
+	stats := client.LimiterStats()
+	if stats.Rejected != 1 || stats.StreamsInFlight != 1 || stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("LimiterStats: wrong stats. Got %#v.", stats)
+	}
+}
+
+func TestLimitsMaxQueuedOnlyCountsWaitingCalls(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/logs") {
+			<-unblock
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Id":"abc","State":{}}`))
+	}))
+	defer srv.Close()
+	defer close(unblock)
+	client, err := NewClientWithOptions(WithHost(srv.URL), WithLimits(Limits{MaxInFlight: 1, MaxStreams: 1, MaxQueued: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Logs(LogsOptions{Container: "abc", OutputStream: &bytes.Buffer{}, Stdout: true})
+	waitLimiterStats(t, client, func(s LimiterStats) bool { return s.StreamsInFlight == 1 })
+	go client.Logs(LogsOptions{Container: "abc", OutputStream: &bytes.Buffer{}, Stdout: true})
+	waitLimiterStats(t, client, func(s LimiterStats) bool { return s.Queued == 1 })
+	// the call doesn't have to wait, so it isn't limited by MaxQueued
+	if _, err := client.InspectContainer("abc"); err != nil {
+		t.Fatal(err)
+	}
+	stats := client.LimiterStats()
+	if stats.Rejected != 0 || stats.Queued != 1 || stats.InFlight != 0 {
+		t.Errorf("LimiterStats: wrong stats. Got %#v.", stats)
+	}
+}
+
+func TestSetLimitsConcurrentCalls(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: `{"Id":"abc","State":{}}`, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.AddInterceptor(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		// the fake round tripper isn't safe for concurrent use
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(`{"Id":"abc"}`))}, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := client.InspectContainer("abc"); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			client.SetLimits(Limits{MaxInFlight: i + 1})
+			client.LimiterStats()
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLimitsWaitContainer(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/wait") {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-unblock
+			w.Write([]byte(`{"StatusCode":0}`))
+			return
+		}
+		w.Write([]byte(`{"Id":"abc","State":{}}`))
+	}))
+	defer srv.Close()
+	client, err := NewClientWithOptions(WithHost(srv.URL), WithLimits(Limits{MaxInFlight: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.WaitContainer("abc")
+		errs <- err
+	}()
+	waiter, err := client.WaitContainerWithOptions(WaitContainerOptions{ID: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitLimiterStats(t, client, func(s LimiterStats) bool { return s.StreamsInFlight == 2 })
+	// pending waits don't take the budget of short calls
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.InspectContainerWithContext(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	close(unblock)
+	if _, err := waiter.Wait(); err != nil {
+		t.Error(err)
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+	if stats := client.LimiterStats(); stats.InFlight != 0 || stats.StreamsInFlight != 0 {
+		t.Errorf("LimiterStats: expected no call in flight, got %#v.", stats)
+	}
+}
+
+func TestLimitsRequestsPerSecond(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer srv.Close()
+	client, err := NewClientWithOptions(WithHost(srv.URL), WithLimits(Limits{RequestsPerSecond: 20, Burst: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := client.Ping(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 calls from the burst, then 4 calls at 20 per second
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("RequestsPerSecond: calls weren't throttled, took %s.", elapsed)
+	}
+}
+
+func TestLimitsHijackedConnReleasesBudget(t *testing.T) {
+	srv := httptest.NewServer(upgradeEchoHandler(t))
+	defer srv.Close()
+	client, err := NewClientWithOptions(WithHost(srv.URL), WithLimits(Limits{MaxStreams: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.AttachToContainerRaw(AttachToContainerOptions{Container: "abc", Stdin: true, Stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.LimiterStats(); stats.StreamsInFlight != 1 {
+		t.Errorf("LimiterStats: wrong number of streams. Want 1. Got %d.", stats.StreamsInFlight)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.AttachToContainerRaw(AttachToContainerOptions{Container: "abc", Stdin: true, Stream: true, Context: ctx})
+	if err != context.DeadlineExceeded {
+		t.Errorf("AttachToContainerRaw: wrong error. Want %#v. Got %#v.", context.DeadlineExceeded, err)
+	}
+	conn.Close()
+	conn, err = client.AttachToContainerRaw(AttachToContainerOptions{Container: "abc", Stdin: true, Stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if stats := client.LimiterStats(); stats.StreamsInFlight != 0 {
+		t.Errorf("LimiterStats: wrong number of streams. Want 0. Got %d.", stats.StreamsInFlight)
+	}
+}
+
+func TestWithLimitsInvalid(t *testing.T) {
+	if _, err := NewClientWithOptions(WithHost("http://localhost:4243"), WithLimits(Limits{MaxInFlight: -1})); err == nil {
+		t.Error("WithLimits: expected non-nil error for negative limit, got <nil>")
+	}
+}
@@ -0,0 +1,552 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CallMetrics describe a single call made by a client to the Docker API.
+type CallMetrics struct {
+	// Operation is the name of the client method making the call, like
+	// "ListContainers" or "PullImage", or "Unknown" for calls to paths
+	// the client doesn't know about.
+	Operation string
+
+	// Method is the HTTP method of the call.
+	Method string
+
+	// StatusCode is the status code of the response, or zero when the
+	// call failed before getting a response.
+	StatusCode int
+
+	// ErrorKind classifies the error of the call, if any: "not_found",
+	// "conflict", "unauthorized", "not_modified", "unavailable",
+	// "client_error", "server_error", "timeout", "canceled",
+	// "connection" or "other". It's empty for successful calls.
+	ErrorKind string
+
+	// Duration is the time it took to get the response of the call. For
+	// streams and attach or exec sessions, it's the time until the end of
+	// the stream or session.
+	Duration time.Duration
+
+	// Stream indicates whether the call is a stream or an attach or exec
+	// session.
+	Stream bool
+
+	// BytesSent and BytesReceived are the number of bytes of the body of
+	// a stream, or of the data of an attach or exec session, sent to and
+	// received from the daemon. They're zero for other calls.
+	BytesSent     int64
+	BytesReceived int64
+}
+
+// StatusClass returns the class of the status code of the call, like "2xx"
+// or "4xx", or "none" when the call failed before getting a response.
+func (m CallMetrics) StatusClass() string {
+	if m.StatusCode <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%dxx", m.StatusCode/100)
+}
+
+// MetricsRecorder records the metrics of the calls made by a client. It's
+// called once every call is over, and may be called concurrently.
+//
+// Calls retried by a RetryPolicy are recorded once per attempt, while calls
+// rejected by the limits of the client aren't recorded (see LimiterStats).
+type MetricsRecorder interface {
+	RecordCall(CallMetrics)
+}
+
+// WithMetricsRecorder sets the recorder of the metrics of the calls made by
+// the client.
+func WithMetricsRecorder(recorder MetricsRecorder) ClientOption {
+	return func(o *clientOptions) error {
+		o.metrics = recorder
+		return nil
+	}
+}
+
+// SetMetricsRecorder changes the recorder of the metrics of the calls made by
+// the client. A nil recorder disables the metrics.
+//
+// Calls already started when SetMetricsRecorder is called are recorded by the
+// recorder they started with.
+func (c *Client) SetMetricsRecorder(recorder MetricsRecorder) {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+	c.metrics = recorder
+}
+
+// callRecorder measures a call of the client, for its metrics recorder.
+type callRecorder struct {
+	recorder  MetricsRecorder
+	operation string
+	method    string
+	stream    bool
+	start     time.Time
+	sent      int64
+	received  int64
+	once      sync.Once
+}
+
+// startCall starts measuring a call, returning nil when the client doesn't
+// record metrics.
+func (c *Client) startCall(method, path string, stream bool) *callRecorder {
+	c.configMu.RLock()
+	recorder := c.metrics
+	c.configMu.RUnlock()
+	if recorder == nil {
+		return nil
+	}
+	return &callRecorder{
+		recorder:  recorder,
+		operation: operationName(method, path),
+		method:    method,
+		stream:    stream,
+		start:     time.Now(),
+	}
+}
+
+// done records the call, with the status code of its response, if any, and
+// its error. Only the first call to done is recorded.
+func (r *callRecorder) done(statusCode int, err error) {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		if e, ok := err.(*Error); ok && statusCode == 0 {
+			statusCode = e.Status
+		}
+		r.recorder.RecordCall(CallMetrics{
+			Operation:     r.operation,
+			Method:        r.method,
+			StatusCode:    statusCode,
+			ErrorKind:     errorKind(err),
+			Duration:      time.Since(r.start),
+			Stream:        r.stream,
+			BytesSent:     atomic.LoadInt64(&r.sent),
+			BytesReceived: atomic.LoadInt64(&r.received),
+		})
+	})
+}
+
+// countSent and countReceived wrap the given body, counting the bytes read
+// from it as sent to or received from the daemon.
+func (r *callRecorder) countSent(body io.ReadCloser) io.ReadCloser {
+	if r == nil || body == nil {
+		return body
+	}
+	return &countingReadCloser{ReadCloser: body, n: &r.sent}
+}
+
+func (r *callRecorder) countReceived(body io.ReadCloser) io.ReadCloser {
+	if r == nil || body == nil {
+		return body
+	}
+	return &countingReadCloser{ReadCloser: body, n: &r.received}
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
+
+// errorKind classifies the given error for the metrics of a call.
+func errorKind(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case IsNotFound(err):
+		return "not_found"
+	case IsConflict(err):
+		return "conflict"
+	case IsUnauthorized(err):
+		return "unauthorized"
+	case IsNotModified(err):
+		return "not_modified"
+	case IsUnavailable(err):
+		return "unavailable"
+	case err == context.Canceled:
+		return "canceled"
+	case err == context.DeadlineExceeded || err == ErrInactivityTimeout:
+		return "timeout"
+	}
+	if e, ok := err.(*Error); ok {
+		if e.Status >= 500 {
+			return "server_error"
+		}
+		return "client_error"
+	}
+	if e, ok := err.(net.Error); ok {
+		if e.Timeout() {
+			return "timeout"
+		}
+		return "connection"
+	}
+	return "other"
+}
+
+// route maps the calls to a path of the API to the name of the client method
+// making them. In patterns, * stands for an identifier or a name, which may
+// hold slashes, like image names.
+type route struct {
+	method  string
+	pattern string
+	// query is a parameter that must be set in the query string, telling
+	// apart operations sharing the same path
+	query     string
+	operation string
+}
+
+// routes are matched in order, so the most specific ones come first.
+var routes = []route{
+	{method: "GET", pattern: "/_ping", operation: "Ping"},
+	{method: "GET", pattern: "/version", operation: "Version"},
+	{method: "GET", pattern: "/info", operation: "Info"},
+	{method: "GET", pattern: "/system/df", operation: "DiskUsage"},
+	{method: "POST", pattern: "/auth", operation: "AuthCheck"},
+	{method: "GET", pattern: "/events", operation: "AddEventListener"},
+
+	{method: "GET", pattern: "/containers/json", operation: "ListContainers"},
+	{method: "POST", pattern: "/containers/create", operation: "CreateContainer"},
+	{method: "POST", pattern: "/containers/prune", operation: "PruneContainers"},
+	{method: "GET", pattern: "/containers/*/json", operation: "InspectContainer"},
+	{method: "GET", pattern: "/containers/*/changes", operation: "ContainerChanges"},
+	{method: "POST", pattern: "/containers/*/update", operation: "UpdateContainer"},
+	{method: "POST", pattern: "/containers/*/rename", operation: "RenameContainer"},
+	{method: "POST", pattern: "/containers/*/start", operation: "StartContainer"},
+	{method: "POST", pattern: "/containers/*/stop", operation: "StopContainer"},
+	{method: "POST", pattern: "/containers/*/restart", operation: "RestartContainer"},
+	{method: "POST", pattern: "/containers/*/pause", operation: "PauseContainer"},
+	{method: "POST", pattern: "/containers/*/unpause", operation: "UnpauseContainer"},
+	{method: "GET", pattern: "/containers/*/top", operation: "TopContainer"},
+	{method: "GET", pattern: "/containers/*/stats", operation: "Stats"},
+	{method: "POST", pattern: "/containers/*/kill", operation: "KillContainer"},
+	{method: "PUT", pattern: "/containers/*/archive", operation: "UploadToContainer"},
+	{method: "GET", pattern: "/containers/*/archive", operation: "DownloadFromContainer"},
+	{method: "HEAD", pattern: "/containers/*/archive", operation: "ContainerStatPath"},
+	{method: "POST", pattern: "/containers/*/copy", operation: "CopyFromContainer"},
+	{method: "POST", pattern: "/containers/*/wait", operation: "WaitContainer"},
+	{method: "POST", pattern: "/containers/*/attach", operation: "AttachToContainer"},
+	{method: "GET", pattern: "/containers/*/logs", operation: "Logs"},
+	{method: "POST", pattern: "/containers/*/resize", operation: "ResizeContainerTTY"},
+	{method: "GET", pattern: "/containers/*/export", operation: "ExportContainer"},
+	{method: "POST", pattern: "/containers/*/exec", operation: "CreateExec"},
+	{method: "DELETE", pattern: "/containers/*", operation: "RemoveContainer"},
+	{method: "POST", pattern: "/commit", operation: "CommitContainer"},
+
+	{method: "POST", pattern: "/exec/*/start", operation: "StartExec"},
+	{method: "POST", pattern: "/exec/*/resize", operation: "ResizeExecTTY"},
+	{method: "GET", pattern: "/exec/*/json", operation: "InspectExec"},
+
+	{method: "GET", pattern: "/images/json", operation: "ListImages"},
+	{method: "GET", pattern: "/images/search", operation: "SearchImages"},
+	{method: "GET", pattern: "/images/get", operation: "ExportImages"},
+	{method: "POST", pattern: "/images/create", query: "fromSrc", operation: "ImportImage"},
+	{method: "POST", pattern: "/images/create", operation: "PullImage"},
+	{method: "POST", pattern: "/images/load", operation: "LoadImage"},
+	{method: "POST", pattern: "/images/prune", operation: "PruneImages"},
+	{method: "GET", pattern: "/images/*/history", operation: "ImageHistory"},
+	{method: "GET", pattern: "/images/*/json", operation: "InspectImage"},
+	{method: "POST", pattern: "/images/*/push", operation: "PushImage"},
+	{method: "GET", pattern: "/images/*/get", operation: "ExportImage"},
+	{method: "POST", pattern: "/images/*/tag", operation: "TagImage"},
+	{method: "DELETE", pattern: "/images/*", operation: "RemoveImage"},
+	{method: "POST", pattern: "/build", operation: "BuildImage"},
+
+	{method: "GET", pattern: "/networks", operation: "ListNetworks"},
+	{method: "POST", pattern: "/networks/create", operation: "CreateNetwork"},
+	{method: "POST", pattern: "/networks/prune", operation: "PruneNetworks"},
+	{method: "POST", pattern: "/networks/*/connect", operation: "ConnectNetwork"},
+	{method: "POST", pattern: "/networks/*/disconnect", operation: "DisconnectNetwork"},
+	{method: "GET", pattern: "/networks/*", operation: "NetworkInfo"},
+	{method: "DELETE", pattern: "/networks/*", operation: "RemoveNetwork"},
+
+	{method: "GET", pattern: "/volumes", operation: "ListVolumes"},
+	{method: "POST", pattern: "/volumes/create", operation: "CreateVolume"},
+	{method: "POST", pattern: "/volumes/prune", operation: "PruneVolumes"},
+	{method: "GET", pattern: "/volumes/*", operation: "InspectVolume"},
+	{method: "DELETE", pattern: "/volumes/*", operation: "RemoveVolume"},
+
+	{method: "POST", pattern: "/swarm/init", operation: "InitSwarm"},
+	{method: "POST", pattern: "/swarm/join", operation: "JoinSwarm"},
+	{method: "POST", pattern: "/swarm/leave", operation: "LeaveSwarm"},
+	{method: "POST", pattern: "/swarm/update", operation: "UpdateSwarm"},
+	{method: "GET", pattern: "/swarm", operation: "InspectSwarm"},
+
+	{method: "GET", pattern: "/nodes", operation: "ListNodes"},
+	{method: "POST", pattern: "/nodes/*/update", operation: "UpdateNode"},
+	{method: "GET", pattern: "/nodes/*", operation: "InspectNode"},
+	{method: "DELETE", pattern: "/nodes/*", operation: "RemoveNode"},
+
+	{method: "GET", pattern: "/services", operation: "ListServices"},
+	{method: "POST", pattern: "/services/create", operation: "CreateService"},
+	{method: "POST", pattern: "/services/*/update", operation: "UpdateService"},
+	{method: "GET", pattern: "/services/*", operation: "InspectService"},
+	{method: "DELETE", pattern: "/services/*", operation: "RemoveService"},
+
+	{method: "GET", pattern: "/tasks", operation: "ListTasks"},
+	{method: "GET", pattern: "/tasks/*", operation: "InspectTask"},
+}
+
+// operationName returns the name of the client method calling the given
+// path of the API, which may hold a query string.
+func operationName(method, path string) string {
+	operation, _ := matchRoute(method, path)
+	return operation
+}
+
+// matchRoute returns the name of the client method calling the given path of
+// the API, along with the identifier or name in the path, if any.
+func matchRoute(method, path string) (operation, target string) {
+	var query url.Values
+	if i := strings.Index(path, "?"); i >= 0 {
+		query, _ = url.ParseQuery(path[i+1:])
+		path = path[:i]
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, r := range routes {
+		if r.method != method {
+			continue
+		}
+		if r.query != "" && query.Get(r.query) == "" {
+			continue
+		}
+		if target, ok := matchSegments(strings.Split(strings.Trim(r.pattern, "/"), "/"), segments); ok {
+			return r.operation, target
+		}
+	}
+	return "Unknown", ""
+}
+
+// matchSegments matches the segments of a path against the ones of a
+// pattern, where * matches one or more segments, returning the segments
+// matched by *.
+func matchSegments(pattern, segments []string) (string, bool) {
+	if len(pattern) == 0 {
+		return "", len(segments) == 0
+	}
+	if pattern[0] != "*" {
+		if len(segments) == 0 || segments[0] != pattern[0] {
+			return "", false
+		}
+		return matchSegments(pattern[1:], segments[1:])
+	}
+	for i := 1; i <= len(segments); i++ {
+		if segments[i-1] == "" {
+			return "", false
+		}
+		if _, ok := matchSegments(pattern[1:], segments[i:]); ok {
+			return strings.Join(segments[:i], "/"), true
+		}
+	}
+	return "", false
+}
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the buckets of
+// the histogram of the durations of calls in PrometheusRecorder.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// DefaultStreamDurationBuckets are the upper bounds, in seconds, of the
+// buckets of the histogram of the durations of streams and attach or exec
+// sessions in PrometheusRecorder.
+var DefaultStreamDurationBuckets = []float64{.1, .5, 1, 5, 10, 30, 60, 300, 900, 3600}
+
+// PrometheusRecorder is a MetricsRecorder aggregating the metrics of the
+// calls, and serving them over HTTP in the Prometheus text format:
+//
+//	docker_client_requests_total{operation,method,status_class}
+//	docker_client_errors_total{operation,method,error_kind}
+//	docker_client_request_duration_seconds{operation,method} (histogram)
+//	docker_client_stream_duration_seconds{operation,method} (histogram)
+//	docker_client_stream_bytes_total{operation,direction}
+//
+// Streams and attach or exec sessions are measured by the stream histogram,
+// and all the other calls by the request one.
+type PrometheusRecorder struct {
+	durationBuckets       []float64
+	streamDurationBuckets []float64
+
+	mu              sync.Mutex
+	requests        map[metricLabels]int64
+	errors          map[metricLabels]int64
+	durations       map[metricLabels]*histogram
+	streamDurations map[metricLabels]*histogram
+	streamBytes     map[metricLabels]int64
+}
+
+// metricLabels are the values of the labels of a series. Unused labels are
+// left empty.
+type metricLabels struct {
+	operation string
+	method    string
+	extra     string
+}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+// NewPrometheusRecorder returns a recorder using DefaultDurationBuckets and
+// DefaultStreamDurationBuckets for its histograms.
+func NewPrometheusRecorder() *PrometheusRecorder {
+	return NewPrometheusRecorderWithBuckets(DefaultDurationBuckets, DefaultStreamDurationBuckets)
+}
+
+// NewPrometheusRecorderWithBuckets returns a recorder using the given upper
+// bounds, in seconds, for the buckets of its histograms.
+func NewPrometheusRecorderWithBuckets(durationBuckets, streamDurationBuckets []float64) *PrometheusRecorder {
+	return &PrometheusRecorder{
+		durationBuckets:       sortedBuckets(durationBuckets),
+		streamDurationBuckets: sortedBuckets(streamDurationBuckets),
+		requests:              make(map[metricLabels]int64),
+		errors:                make(map[metricLabels]int64),
+		durations:             make(map[metricLabels]*histogram),
+		streamDurations:       make(map[metricLabels]*histogram),
+		streamBytes:           make(map[metricLabels]int64),
+	}
+}
+
+func sortedBuckets(buckets []float64) []float64 {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+// RecordCall records the metrics of a call.
+func (r *PrometheusRecorder) RecordCall(m CallMetrics) {
+	call := metricLabels{operation: m.Operation, method: m.Method}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests[metricLabels{operation: m.Operation, method: m.Method, extra: m.StatusClass()}]++
+	if m.ErrorKind != "" {
+		r.errors[metricLabels{operation: m.Operation, method: m.Method, extra: m.ErrorKind}]++
+	}
+	durations, buckets := r.durations, r.durationBuckets
+	if m.Stream {
+		durations, buckets = r.streamDurations, r.streamDurationBuckets
+		r.streamBytes[metricLabels{operation: m.Operation, extra: "sent"}] += m.BytesSent
+		r.streamBytes[metricLabels{operation: m.Operation, extra: "received"}] += m.BytesReceived
+	}
+	h := durations[call]
+	if h == nil {
+		h = &histogram{counts: make([]int64, len(buckets))}
+		durations[call] = h
+	}
+	seconds := m.Duration.Seconds()
+	for i, bound := range buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *PrometheusRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (r *PrometheusRecorder) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	r.mu.Lock()
+	writeCounters(&b, "docker_client_requests_total", "Number of calls to the Docker API.", "status_class", r.requests)
+	writeCounters(&b, "docker_client_errors_total", "Number of failed calls to the Docker API.", "error_kind", r.errors)
+	writeHistograms(&b, "docker_client_request_duration_seconds", "Time to get the response of calls to the Docker API.", r.durationBuckets, r.durations)
+	writeHistograms(&b, "docker_client_stream_duration_seconds", "Duration of streams and attach or exec sessions with the Docker API.", r.streamDurationBuckets, r.streamDurations)
+	writeCounters(&b, "docker_client_stream_bytes_total", "Bytes sent and received by streams and attach or exec sessions with the Docker API.", "direction", r.streamBytes)
+	r.mu.Unlock()
+	return b.WriteTo(w)
+}
+
+type byLabels []metricLabels
+
+func (l byLabels) Len() int      { return len(l) }
+func (l byLabels) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byLabels) Less(i, j int) bool {
+	if l[i].operation != l[j].operation {
+		return l[i].operation < l[j].operation
+	}
+	if l[i].method != l[j].method {
+		return l[i].method < l[j].method
+	}
+	return l[i].extra < l[j].extra
+}
+
+// formatLabels formats the labels of a series, leaving out the method when
+// it's empty.
+func formatLabels(labels metricLabels, extraName string) string {
+	pairs := []string{formatLabel("operation", labels.operation)}
+	if labels.method != "" {
+		pairs = append(pairs, formatLabel("method", labels.method))
+	}
+	if extraName != "" {
+		pairs = append(pairs, formatLabel(extraName, labels.extra))
+	}
+	return strings.Join(pairs, ",")
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabel(name, value string) string {
+	return name + `="` + labelValueReplacer.Replace(value) + `"`
+}
+
+func writeCounters(b *bytes.Buffer, name, help, extraName string, counters map[metricLabels]int64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	labels := make([]metricLabels, 0, len(counters))
+	for l := range counters {
+		labels = append(labels, l)
+	}
+	sort.Sort(byLabels(labels))
+	for _, l := range labels {
+		fmt.Fprintf(b, "%s{%s} %d\n", name, formatLabels(l, extraName), counters[l])
+	}
+}
+
+func writeHistograms(b *bytes.Buffer, name, help string, buckets []float64, histograms map[metricLabels]*histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	labels := make([]metricLabels, 0, len(histograms))
+	for l := range histograms {
+		labels = append(labels, l)
+	}
+	sort.Sort(byLabels(labels))
+	for _, l := range labels {
+		h := histograms[l]
+		series := formatLabels(l, "")
+		for i, bound := range buckets {
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", name, series, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, series, h.count)
+		fmt.Fprintf(b, "%s_sum{%s} %s\n", name, series, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(b, "%s_count{%s} %d\n", name, series, h.count)
+	}
+}
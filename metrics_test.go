@@ -0,0 +1,307 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type callsRecorder struct {
+	mu    sync.Mutex
+	calls []CallMetrics
+}
+
+func (r *callsRecorder) RecordCall(m CallMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, m)
+}
+
+func (r *callsRecorder) recorded() []CallMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]CallMetrics(nil), r.calls...)
+}
+
+func TestOperationName(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/containers/json?all=1", "ListContainers"},
+		{"GET", "/containers/4fa6e0f0c678/json", "InspectContainer"},
+		{"DELETE", "/containers/4fa6e0f0c678?force=1", "RemoveContainer"},
+		{"POST", "/containers/4fa6e0f0c678/exec", "CreateExec"},
+		{"POST", "/exec/a1b2c3/start", "StartExec"},
+		{"POST", "/images/create?fromImage=busybox", "PullImage"},
+		{"POST", "/images/create?fromSrc=-&repo=busybox", "ImportImage"},
+		{"GET", "/images/json", "ListImages"},
+		{"GET", "/images/quay.io/org/app:1.0/json", "InspectImage"},
+		{"POST", "/images/localhost:5000/org/app/push?tag=1.0", "PushImage"},
+		{"DELETE", "/images/org/app", "RemoveImage"},
+		{"GET", "/networks?filters={}", "ListNetworks"},
+		{"GET", "/networks/net1", "NetworkInfo"},
+		{"GET", "/swarm", "InspectSwarm"},
+		{"GET", "/_ping", "Ping"},
+		{"GET", "/containers//json", "Unknown"},
+		{"PATCH", "/containers/json", "Unknown"},
+		{"GET", "/plugins", "Unknown"},
+	}
+	for _, tt := range tests {
+		if got := operationName(tt.method, tt.path); got != tt.expected {
+			t.Errorf("operationName(%q, %q): wrong name. Want %q. Got %q.", tt.method, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{nil, ""},
+		{&Error{Status: http.StatusNotFound}, "not_found"},
+		{&NoSuchContainer{ID: "abc"}, "not_found"},
+		{&Error{Status: http.StatusConflict}, "conflict"},
+		{&Error{Status: http.StatusBadRequest}, "client_error"},
+		{&Error{Status: http.StatusInternalServerError}, "server_error"},
+		{ErrConnectionRefused, "unavailable"},
+		{ErrInactivityTimeout, "timeout"},
+		{&streamTimeoutError{timeout: time.Second}, "timeout"},
+		{ErrNoSuchImage, "not_found"},
+		{errors.New("unexpected"), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorKind(tt.err); got != tt.expected {
+			t.Errorf("errorKind(%#v): wrong kind. Want %q. Got %q.", tt.err, tt.expected, got)
+		}
+	}
+}
+
+func TestMetricsRecorderCalls(t *testing.T) {
+	recorder := &callsRecorder{}
+	client := newTestClient(&FakeRoundTripper{message: "[]", status: http.StatusOK})
+	client.SetMetricsRecorder(recorder)
+	if _, err := client.ListContainers(ListContainersOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	client = newTestClient(&FakeRoundTripper{message: "no such container", status: http.StatusNotFound})
+	client.SetMetricsRecorder(recorder)
+	if _, err := client.InspectContainer("abc"); err == nil {
+		t.Fatal("InspectContainer: expected non-nil error, got <nil>")
+	}
+	calls := recorder.recorded()
+	if len(calls) != 2 {
+		t.Fatalf("RecordCall: wrong number of calls. Want 2. Got %d.", len(calls))
+	}
+	if m := calls[0]; m.Operation != "ListContainers" || m.Method != "GET" || m.StatusClass() != "2xx" || m.ErrorKind != "" || m.Stream {
+		t.Errorf("RecordCall: wrong metrics for ListContainers. Got %#v.", m)
+	}
+	if m := calls[1]; m.Operation != "InspectContainer" || m.StatusCode != http.StatusNotFound || m.ErrorKind != "not_found" {
+		t.Errorf("RecordCall: wrong metrics for InspectContainer. Got %#v.", m)
+	}
+}
+
+func TestSetMetricsRecorderConcurrentCalls(t *testing.T) {
+	recorder := &callsRecorder{}
+	client := newTestClient(&FakeRoundTripper{message: "[]", status: http.StatusOK})
+	client.AddInterceptor(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		// the fake round tripper isn't safe for concurrent use
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("[]"))}, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := client.ListContainers(ListContainersOptions{}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			client.SetMetricsRecorder(recorder)
+		}()
+	}
+	wg.Wait()
+	if _, err := client.ListContainers(ListContainersOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := recorder.recorded(); len(calls) == 0 {
+		t.Error("RecordCall: expected recorded calls, got none")
+	}
+}
+
+func TestMetricsRecorderStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if r.Method == "GET" {
+			w.Write([]byte("output of the stream"))
+		}
+	}))
+	defer server.Close()
+	recorder := &callsRecorder{}
+	client, err := NewClientWithOptions(WithHost(server.URL), WithMetricsRecorder(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = client.Logs(LogsOptions{Container: "abc", OutputStream: &out, Stdout: true, RawTerminal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.UploadToContainer("abc", UploadToContainerOptions{Path: "/tmp", InputStream: strings.NewReader("tarball")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs, upload *CallMetrics
+	for _, m := range recorder.recorded() {
+		m := m
+		switch m.Operation {
+		case "Logs":
+			logs = &m
+		case "UploadToContainer":
+			upload = &m
+		}
+	}
+	if logs == nil || !logs.Stream || logs.BytesReceived != int64(len("output of the stream")) || logs.StatusCode != http.StatusOK {
+		t.Errorf("RecordCall: wrong metrics for Logs. Got %#v.", logs)
+	}
+	if upload == nil || !upload.Stream || upload.BytesSent != int64(len("tarball")) {
+		t.Errorf("RecordCall: wrong metrics for UploadToContainer. Got %#v.", upload)
+	}
+}
+
+func TestMetricsRecorderHijack(t *testing.T) {
+	server := httptest.NewServer(upgradeEchoHandler(t))
+	defer server.Close()
+	recorder := &callsRecorder{}
+	client, err := NewClientWithOptions(WithHost(server.URL), WithMetricsRecorder(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.AttachToContainerRaw(AttachToContainerOptions{Container: "abc", Stdin: true, Stream: true, RawTerminal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("echo"))
+	conn.CloseWrite()
+	ioutil.ReadAll(conn)
+	conn.Close()
+	var attach *CallMetrics
+	for _, m := range recorder.recorded() {
+		if m.Operation == "AttachToContainer" {
+			m := m
+			attach = &m
+		}
+	}
+	if attach == nil || !attach.Stream || attach.BytesSent != 4 || attach.BytesReceived != 4 || attach.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("RecordCall: wrong metrics for AttachToContainer. Got %#v.", attach)
+	}
+}
+
+func TestMetricsRecorderHijackError(t *testing.T) {
+	server := httptest.NewServer(upgradeEchoHandler(t))
+	defer server.Close()
+	recorder := &callsRecorder{}
+	client, err := NewClientWithOptions(WithHost(server.URL), WithMetricsRecorder(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	waiter, err := client.AttachToContainerNonBlocking(AttachToContainerOptions{
+		Container:    "abc",
+		InputStream:  reader,
+		OutputStream: ioutil.Discard,
+		Stdin:        true,
+		Stdout:       true,
+		Stream:       true,
+		RawTerminal:  true,
+		Context:      ctx,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := waiter.Wait(); err != context.Canceled {
+		t.Fatalf("Wait: wrong error. Want %#v. Got %#v.", context.Canceled, err)
+	}
+	var attach *CallMetrics
+	for _, m := range recorder.recorded() {
+		if m.Operation == "AttachToContainer" {
+			m := m
+			attach = &m
+		}
+	}
+	if attach == nil || attach.ErrorKind != "canceled" || attach.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("RecordCall: wrong metrics for the canceled AttachToContainer. Got %#v.", attach)
+	}
+}
+
+func TestPrometheusRecorder(t *testing.T) {
+	recorder := NewPrometheusRecorderWithBuckets([]float64{0.5, 0.1}, []float64{10})
+	recorder.RecordCall(CallMetrics{Operation: "ListContainers", Method: "GET", StatusCode: 200, Duration: 50 * time.Millisecond})
+	recorder.RecordCall(CallMetrics{Operation: "ListContainers", Method: "GET", StatusCode: 200, Duration: 250 * time.Millisecond})
+	recorder.RecordCall(CallMetrics{Operation: "InspectContainer", Method: "GET", StatusCode: 404, ErrorKind: "not_found", Duration: time.Millisecond})
+	recorder.RecordCall(CallMetrics{Operation: "Logs", Method: "GET", StatusCode: 200, Stream: true, Duration: 2 * time.Second, BytesReceived: 1024})
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("ServeHTTP: wrong content type. Got %q.", contentType)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"# TYPE docker_client_requests_total counter",
+		`docker_client_requests_total{operation="InspectContainer",method="GET",status_class="4xx"} 1`,
+		`docker_client_requests_total{operation="ListContainers",method="GET",status_class="2xx"} 2`,
+		`docker_client_requests_total{operation="Logs",method="GET",status_class="2xx"} 1`,
+		`docker_client_errors_total{operation="InspectContainer",method="GET",error_kind="not_found"} 1`,
+		"# TYPE docker_client_request_duration_seconds histogram",
+		`docker_client_request_duration_seconds_bucket{operation="ListContainers",method="GET",le="0.1"} 1`,
+		`docker_client_request_duration_seconds_bucket{operation="ListContainers",method="GET",le="0.5"} 2`,
+		`docker_client_request_duration_seconds_bucket{operation="ListContainers",method="GET",le="+Inf"} 2`,
+		`docker_client_request_duration_seconds_sum{operation="ListContainers",method="GET"} 0.3`,
+		`docker_client_request_duration_seconds_count{operation="ListContainers",method="GET"} 2`,
+		`docker_client_stream_duration_seconds_bucket{operation="Logs",method="GET",le="10"} 1`,
+		`docker_client_stream_bytes_total{operation="Logs",direction="received"} 1024`,
+		`docker_client_stream_bytes_total{operation="Logs",direction="sent"} 0`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("ServeHTTP: missing line %q in output:\n%s", line, body)
+		}
+	}
+	if strings.Contains(string(body), `docker_client_request_duration_seconds_count{operation="Logs"`) {
+		t.Errorf("ServeHTTP: stream recorded in the request histogram:\n%s", body)
+	}
+}
+
+func TestFormatLabelEscaping(t *testing.T) {
+	expected := `operation="a\"b\\c\nd"`
+	if got := formatLabel("operation", "a\"b\\c\nd"); got != expected {
+		t.Errorf("formatLabel: wrong label. Want %s. Got %s.", expected, got)
+	}
+}
@@ -5,6 +5,7 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
 
@@ -15,7 +16,13 @@ import (
 //
 // See https://goo.gl/ND9R8L for more details.
 func (c *Client) Version() (*Env, error) {
-	resp, err := c.do("GET", "/version", doOptions{})
+	return c.VersionWithContext(context.Background())
+}
+
+// VersionWithContext returns version information about the docker server. The
+// context can be used to cancel the request.
+func (c *Client) VersionWithContext(ctx context.Context) (*Env, error) {
+	resp, err := c.do("GET", "/version", doOptions{context: ctx})
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +103,13 @@ type PluginsInfo struct {
 //
 // See https://goo.gl/ElTHi2 for more details.
 func (c *Client) Info() (*DockerInfo, error) {
-	resp, err := c.do("GET", "/info", doOptions{})
+	return c.InfoWithContext(context.Background())
+}
+
+// InfoWithContext returns system-wide information about the Docker server. The
+// context can be used to cancel the request.
+func (c *Client) InfoWithContext(ctx context.Context) (*DockerInfo, error) {
+	resp, err := c.do("GET", "/info", doOptions{context: ctx})
 	if err != nil {
 		return nil, err
 	}
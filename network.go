@@ -6,12 +6,11 @@ package docker
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-
-	"golang.org/x/net/context"
 )
 
 // ErrNetworkAlreadyExists is the error returned by CreateNetwork when the
@@ -49,7 +48,13 @@ type Endpoint struct {
 //
 // See https://goo.gl/6GugX3 for more details.
 func (c *Client) ListNetworks() ([]Network, error) {
-	resp, err := c.do("GET", "/networks", doOptions{})
+	return c.ListNetworksWithContext(context.Background())
+}
+
+// ListNetworksWithContext returns all networks. The context can be used to
+// cancel the request.
+func (c *Client) ListNetworksWithContext(ctx context.Context) ([]Network, error) {
+	resp, err := c.do("GET", "/networks", doOptions{context: ctx})
 	if err != nil {
 		return nil, err
 	}
@@ -69,12 +74,18 @@ type NetworkFilterOpts map[string]map[string]bool
 //
 // See goo.gl/zd2mx4 for more details.
 func (c *Client) FilteredListNetworks(opts NetworkFilterOpts) ([]Network, error) {
+	return c.FilteredListNetworksWithContext(context.Background(), opts)
+}
+
+// FilteredListNetworksWithContext returns all networks with the filters
+// applied. The context can be used to cancel the request.
+func (c *Client) FilteredListNetworksWithContext(ctx context.Context, opts NetworkFilterOpts) ([]Network, error) {
 	params := bytes.NewBuffer(nil)
 	if err := json.NewEncoder(params).Encode(&opts); err != nil {
 		return nil, err
 	}
 	path := "/networks?filters=" + params.String()
-	resp, err := c.do("GET", path, doOptions{})
+	resp, err := c.do("GET", path, doOptions{context: ctx})
 	if err != nil {
 		return nil, err
 	}
@@ -90,17 +101,22 @@ func (c *Client) FilteredListNetworks(opts NetworkFilterOpts) ([]Network, error)
 //
 // See https://goo.gl/6GugX3 for more details.
 func (c *Client) NetworkInfo(id string) (*Network, error) {
+	return c.NetworkInfoWithContext(context.Background(), id)
+}
+
+// NetworkInfoWithContext returns information about a network by its ID. The
+// context can be used to cancel the request.
+func (c *Client) NetworkInfoWithContext(ctx context.Context, id string) (*Network, error) {
 	path := "/networks/" + id
-	resp, err := c.do("GET", path, doOptions{})
+	body, err := c.inspect(ctx, "network", id, path)
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchNetwork{ID: id}
 		}
 		return nil, err
 	}
-	defer resp.Body.Close()
 	var network Network
-	if err := json.NewDecoder(resp.Body).Decode(&network); err != nil {
+	if err := json.Unmarshal(body, &network); err != nil {
 		return nil, err
 	}
 	return &network, nil
@@ -149,8 +165,9 @@ func (c *Client) CreateNetwork(opts CreateNetworkOptions) (*Network, error) {
 		"POST",
 		"/networks/create",
 		doOptions{
-			data:    opts,
-			context: opts.Context,
+			data:        opts,
+			context:     opts.Context,
+			callOptions: opts,
 		},
 	)
 	if err != nil {
@@ -183,7 +200,17 @@ func (c *Client) CreateNetwork(opts CreateNetworkOptions) (*Network, error) {
 //
 // See https://goo.gl/6GugX3 for more details.
 func (c *Client) RemoveNetwork(id string) error {
-	resp, err := c.do("DELETE", "/networks/"+id, doOptions{})
+	return c.RemoveNetworkWithContext(context.Background(), id)
+}
+
+// RemoveNetworkWithContext removes a network or returns an error in case of
+// failure. The context can be used to cancel the request.
+func (c *Client) RemoveNetworkWithContext(ctx context.Context, id string) error {
+	network, err := c.guard(ctx, "RemoveNetwork", "network", id)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do("DELETE", "/networks/"+network.ID, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchNetwork{ID: id}
@@ -243,8 +270,9 @@ type EndpointIPAMConfig struct {
 // See https://goo.gl/6GugX3 for more details.
 func (c *Client) ConnectNetwork(id string, opts NetworkConnectionOptions) error {
 	resp, err := c.do("POST", "/networks/"+id+"/connect", doOptions{
-		data:    opts,
-		context: opts.Context,
+		data:        opts,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
@@ -261,7 +289,7 @@ func (c *Client) ConnectNetwork(id string, opts NetworkConnectionOptions) error
 //
 // See https://goo.gl/6GugX3 for more details.
 func (c *Client) DisconnectNetwork(id string, opts NetworkConnectionOptions) error {
-	resp, err := c.do("POST", "/networks/"+id+"/disconnect", doOptions{data: opts})
+	resp, err := c.do("POST", "/networks/"+id+"/disconnect", doOptions{data: opts, callOptions: opts})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchNetworkOrContainer{NetworkID: id, ContainerID: opts.Container}
@@ -291,3 +319,39 @@ type NoSuchNetworkOrContainer struct {
 func (err *NoSuchNetworkOrContainer) Error() string {
 	return fmt.Sprintf("No such network (%s) or container (%s)", err.NetworkID, err.ContainerID)
 }
+
+// PruneNetworksOptions specify parameters to the PruneNetworks function.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/NetworkPrune for more details.
+type PruneNetworksOptions struct {
+	Filters map[string][]string
+	Context context.Context
+}
+
+// PruneNetworksResults specify results from the PruneNetworks function.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/NetworkPrune for more details.
+type PruneNetworksResults struct {
+	NetworksDeleted []string
+}
+
+// PruneNetworks deletes networks which are not used by any container. The
+// predefined networks are never deleted.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/NetworkPrune for more details.
+func (c *Client) PruneNetworks(opts PruneNetworksOptions) (*PruneNetworksResults, error) {
+	if err := c.requireFeature(FeaturePrune); err != nil {
+		return nil, err
+	}
+	path := "/networks/prune?" + queryString(opts)
+	resp, err := c.do("POST", path, doOptions{context: opts.Context, callOptions: opts})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var results PruneNetworksResults
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
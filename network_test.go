@@ -242,3 +242,26 @@ func TestNetworkDisconnectNotFound(t *testing.T) {
 		t.Errorf("DisconnectNetwork: wrong error type: %s.", serr)
 	}
 }
+
+func TestPruneNetworks(t *testing.T) {
+	body := `{"NetworksDeleted":["8dfafdbc3a40","c3c2f4b2e5f1"]}`
+	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	opts := PruneNetworksOptions{Filters: map[string][]string{"label": {"env=test"}}}
+	results, err := client.PruneNetworks(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &PruneNetworksResults{NetworksDeleted: []string{"8dfafdbc3a40", "c3c2f4b2e5f1"}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("PruneNetworks: wrong results. Want %#v. Got %#v.", expected, results)
+	}
+	req := fakeRT.requests[0]
+	expectedURL, _ := url.Parse(client.getURL("/networks/prune"))
+	if req.Method != "POST" || req.URL.Path != expectedURL.Path {
+		t.Errorf("PruneNetworks: wrong request. Want POST %s. Got %s %s.", expectedURL.Path, req.Method, req.URL.Path)
+	}
+	if filters := req.URL.Query().Get("filters"); filters != `{"label":["env=test"]}` {
+		t.Errorf("PruneNetworks: wrong filters. Want %q. Got %q.", `{"label":["env=test"]}`, filters)
+	}
+}
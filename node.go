@@ -5,13 +5,13 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
 	"strconv"
 
 	"github.com/docker/engine-api/types/swarm"
-	"golang.org/x/net/context"
 )
 
 // NoSuchNode is the error returned when a given node does not exist.
@@ -39,6 +39,9 @@ type ListNodesOptions struct {
 //
 // See http://goo.gl/3K4GwU for more details.
 func (c *Client) ListNodes(opts ListNodesOptions) ([]swarm.Node, error) {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return nil, err
+	}
 	path := "/nodes?" + queryString(opts)
 	resp, err := c.do("GET", path, doOptions{context: opts.Context})
 	if err != nil {
@@ -56,7 +59,16 @@ func (c *Client) ListNodes(opts ListNodesOptions) ([]swarm.Node, error) {
 //
 // See http://goo.gl/WjkTOk for more details.
 func (c *Client) InspectNode(id string) (*swarm.Node, error) {
-	resp, err := c.do("GET", "/nodes/"+id, doOptions{})
+	return c.InspectNodeWithContext(context.Background(), id)
+}
+
+// InspectNodeWithContext returns information about a node by its ID. The
+// context can be used to cancel the request.
+func (c *Client) InspectNodeWithContext(ctx context.Context, id string) (*swarm.Node, error) {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return nil, err
+	}
+	resp, err := c.do("GET", "/nodes/"+id, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchNode{ID: id}
@@ -84,13 +96,17 @@ type UpdateNodeOptions struct {
 //
 // See http://goo.gl/VPBFgA for more details.
 func (c *Client) UpdateNode(id string, opts UpdateNodeOptions) error {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return err
+	}
 	params := make(url.Values)
 	params.Set("version", strconv.Itoa(opts.Version))
 	path := "/nodes/" + id + "/update?" + params.Encode()
-	_, err := c.do("POST", path, doOptions{
-		context:   opts.Context,
-		forceJSON: true,
-		data:      opts.NodeSpec,
+	resp, err := c.do("POST", path, doOptions{
+		context:     opts.Context,
+		forceJSON:   true,
+		data:        opts.NodeSpec,
+		callOptions: opts,
 	})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
@@ -98,6 +114,7 @@ func (c *Client) UpdateNode(id string, opts UpdateNodeOptions) error {
 		}
 		return err
 	}
+	resp.Body.Close()
 	return nil
 }
 
@@ -114,15 +131,23 @@ type RemoveNodeOptions struct {
 //
 // See http://goo.gl/0SNvYg for more details.
 func (c *Client) RemoveNode(opts RemoveNodeOptions) error {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return err
+	}
+	node, err := c.guard(opts.Context, "RemoveNode", "node", opts.ID)
+	if err != nil {
+		return err
+	}
 	params := make(url.Values)
 	params.Set("force", strconv.FormatBool(opts.Force))
-	path := "/nodes/" + opts.ID + "?" + params.Encode()
-	_, err := c.do("DELETE", path, doOptions{context: opts.Context})
+	path := "/nodes/" + node.ID + "?" + params.Encode()
+	resp, err := c.do("DELETE", path, doOptions{context: opts.Context, callOptions: opts})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchNode{ID: opts.ID}
 		}
 		return err
 	}
+	resp.Body.Close()
 	return nil
 }
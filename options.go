@@ -0,0 +1,306 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ClientOption configures a Client created by NewClientWithOptions.
+type ClientOption func(*clientOptions) error
+
+type clientOptions struct {
+	endpoint   string
+	hostSet    bool
+	tlsConfig  *tls.Config
+	apiVersion APIVersion
+	httpClient *http.Client
+	dialer     *net.Dialer
+	timeouts   Timeouts
+	sshConfig  *SSHConfig
+	limits     *Limits
+	metrics    MetricsRecorder
+	dryRun     bool
+	guard      *GuardPolicy
+}
+
+// Timeouts groups the timeouts applied by the client to the different phases
+// of an API call. A zero value keeps the default behavior for the
+// corresponding phase.
+type Timeouts struct {
+	// Dial is the maximum amount of time for establishing a connection to
+	// the Docker daemon.
+	Dial time.Duration
+
+	// TLSHandshake is the maximum amount of time for the TLS handshake.
+	TLSHandshake time.Duration
+
+	// ResponseHeader is the maximum amount of time to wait for the headers
+	// of a response after the request has been written.
+	ResponseHeader time.Duration
+
+	// Request is the maximum amount of time for a whole call, including the
+	// reading of the response body. It has the same effect as SetTimeout,
+	// so it also limits streaming calls like Logs or Stats.
+	Request time.Duration
+}
+
+// NewClientWithOptions returns a Client instance configured by the given
+// options, applied in order.
+//
+// When no host is given, the client connects to DefaultDockerHost. When no
+// API version is given, the client uses the latest remote API version
+// available in the server, without checking it.
+func NewClientWithOptions(opts ...ClientOption) (*Client, error) {
+	client, err := newClientWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if client.requestedAPIVersion == nil {
+		client.SkipServerVersionCheck = true
+	}
+	return client, nil
+}
+
+func newClientWithOptions(opts ...ClientOption) (*Client, error) {
+	var o clientOptions
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	endpoint := o.endpoint
+	if !o.hostSet {
+		var err error
+		endpoint, err = DefaultDockerHost()
+		if err != nil {
+			return nil, err
+		}
+	}
+	u, err := parseEndpoint(endpoint, o.tlsConfig != nil)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{}
+	if o.dialer != nil {
+		d := *o.dialer
+		dialer = &d
+	}
+	if o.timeouts.Dial > 0 {
+		dialer.Timeout = o.timeouts.Dial
+	}
+	var httpClient *http.Client
+	if o.httpClient != nil {
+		// the timeout of the client is set below, and by SetTimeout
+		copied := *o.httpClient
+		httpClient = &copied
+	} else {
+		tr := defaultPooledTransport()
+		tr.TLSClientConfig = o.tlsConfig
+		if o.dialer != nil || o.timeouts.Dial > 0 {
+			tr.Dial = dialer.Dial
+		}
+		if o.timeouts.TLSHandshake > 0 {
+			tr.TLSHandshakeTimeout = o.timeouts.TLSHandshake
+		}
+		if o.timeouts.ResponseHeader > 0 {
+			tr.ResponseHeaderTimeout = o.timeouts.ResponseHeader
+		}
+		httpClient = &http.Client{Transport: tr}
+	}
+	c := &Client{
+		HTTPClient:          httpClient,
+		TLSConfig:           o.tlsConfig,
+		Dialer:              dialer,
+		endpoint:            endpoint,
+		endpointURL:         u,
+		eventMonitor:        new(eventMonitoringState),
+		requestedAPIVersion: o.apiVersion,
+	}
+	if u.Scheme == "ssh" {
+		c.sshDialer = newSSHDialer(u, o.sshConfig)
+	}
+	c.initializeUnixClient()
+	if c.unixHTTPClient != nil && o.timeouts.ResponseHeader > 0 {
+		c.unixHTTPClient.Transport.(*http.Transport).ResponseHeaderTimeout = o.timeouts.ResponseHeader
+	}
+	if o.timeouts.Request > 0 {
+		c.SetTimeout(o.timeouts.Request)
+	}
+	if o.limits != nil {
+		c.SetLimits(*o.limits)
+	}
+	c.metrics = o.metrics
+	c.SetDryRun(o.dryRun)
+	c.GuardPolicy = o.guard
+	return c, nil
+}
+
+// WithHost sets the endpoint of the Docker daemon, like
+// unix:///var/run/docker.sock or tcp://localhost:2376.
+func WithHost(endpoint string) ClientOption {
+	return func(o *clientOptions) error {
+		o.endpoint = endpoint
+		o.hostSet = true
+		return nil
+	}
+}
+
+// WithTLSFiles configures the client for TLS communications, using the
+// given paths to the certificate, key and CA certificate files.
+func WithTLSFiles(cert, key, ca string) ClientOption {
+	return func(o *clientOptions) error {
+		certPEMBlock, err := ioutil.ReadFile(cert)
+		if err != nil {
+			return err
+		}
+		keyPEMBlock, err := ioutil.ReadFile(key)
+		if err != nil {
+			return err
+		}
+		caPEMCert, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return err
+		}
+		o.tlsConfig, err = tlsConfigFromBytes(certPEMBlock, keyPEMBlock, caPEMCert)
+		return err
+	}
+}
+
+// WithTLSConfig configures the client for TLS communications, using the given
+// TLS configuration.
+//
+// When combined with WithHTTPClient, the transport of the given http.Client
+// must be configured for TLS as well.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(o *clientOptions) error {
+		if config == nil {
+			return errors.New("TLS config is required")
+		}
+		o.tlsConfig = config
+		return nil
+	}
+}
+
+// WithAPIVersion sets the version of the remote API used by the client, in
+// the form <major>.<minor>. An empty string makes the client use the latest
+// version available in the server.
+func WithAPIVersion(apiVersionString string) ClientOption {
+	return func(o *clientOptions) error {
+		o.apiVersion = nil
+		if strings.Contains(apiVersionString, ".") {
+			version, err := NewAPIVersion(apiVersionString)
+			if err != nil {
+				return err
+			}
+			o.apiVersion = version
+		}
+		return nil
+	}
+}
+
+// WithHTTPClient sets the http.Client used for communicating with TCP
+// endpoints. The client is copied, so the given one is never changed.
+//
+// The transport of the given client is used as is: the dialer of WithDialer
+// and the Dial, TLSHandshake and ResponseHeader timeouts of
+// WithDefaultTimeouts don't apply to it. They only apply to unix and ssh
+// endpoints, and the dialer to the connections of attach and exec sessions
+// when the transport has no Dial function. The Request timeout of
+// WithDefaultTimeouts overrides the Timeout of the copy.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(o *clientOptions) error {
+		if httpClient == nil {
+			return errors.New("HTTP client is required")
+		}
+		o.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithDialer sets the dialer used for connecting to the Docker daemon. The
+// dialer is copied, so changes made to it after creating the client have no
+// effect. See WithHTTPClient for its use along with a custom http.Client.
+func WithDialer(dialer *net.Dialer) ClientOption {
+	return func(o *clientOptions) error {
+		if dialer == nil {
+			return errors.New("dialer is required")
+		}
+		o.dialer = dialer
+		return nil
+	}
+}
+
+// WithDefaultTimeouts sets the timeouts applied to every API call. A call
+// can still use a shorter deadline through its Context. See WithHTTPClient
+// for the timeouts applied along with a custom http.Client.
+func WithDefaultTimeouts(timeouts Timeouts) ClientOption {
+	return func(o *clientOptions) error {
+		o.timeouts = timeouts
+		return nil
+	}
+}
+
+// FromEnv configures the client using Docker's default logic for the
+// environment variables DOCKER_HOST, DOCKER_TLS_VERIFY, DOCKER_CERT_PATH and
+// DOCKER_API_VERSION.
+//
+// Options given after FromEnv take precedence over the environment.
+func FromEnv() ClientOption {
+	return func(o *clientOptions) error {
+		dockerEnv, err := getDockerEnv()
+		if err != nil {
+			return err
+		}
+		o.endpoint = dockerEnv.dockerHost
+		o.hostSet = true
+		if dockerEnv.dockerTLSVerify {
+			parts := strings.SplitN(dockerEnv.dockerHost, "://", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("could not split %s into two parts by ://", dockerEnv.dockerHost)
+			}
+			cert := filepath.Join(dockerEnv.dockerCertPath, "cert.pem")
+			key := filepath.Join(dockerEnv.dockerCertPath, "key.pem")
+			ca := filepath.Join(dockerEnv.dockerCertPath, "ca.pem")
+			if err := WithTLSFiles(cert, key, ca)(o); err != nil {
+				return err
+			}
+		}
+		if dockerEnv.dockerAPIVersion != "" {
+			return WithAPIVersion(dockerEnv.dockerAPIVersion)(o)
+		}
+		return nil
+	}
+}
+
+func tlsConfigFromBytes(certPEMBlock, keyPEMBlock, caPEMCert []byte) (*tls.Config, error) {
+	if certPEMBlock == nil || keyPEMBlock == nil {
+		return nil, errors.New("Both cert and key are required")
+	}
+	tlsCert, err := tls.X509KeyPair(certPEMBlock, keyPEMBlock)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{tlsCert}}
+	if caPEMCert == nil {
+		tlsConfig.InsecureSkipVerify = true
+	} else {
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caPEMCert) {
+			return nil, errors.New("Could not add RootCA pem")
+		}
+		tlsConfig.RootCAs = caPool
+	}
+	return tlsConfig, nil
+}
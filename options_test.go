@@ -0,0 +1,171 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func setEnv(env map[string]string) func() {
+	old := make(map[string]string, len(env))
+	for k, v := range env {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func TestNewClientWithOptionsDefaults(t *testing.T) {
+	client, err := NewClientWithOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := DefaultDockerHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.endpoint != expected {
+		t.Errorf("NewClientWithOptions: wrong endpoint. Want %q. Got %q.", expected, client.endpoint)
+	}
+	if !client.SkipServerVersionCheck {
+		t.Error("NewClientWithOptions: expected SkipServerVersionCheck to be true, got false")
+	}
+}
+
+func TestNewClientWithOptionsAPIVersion(t *testing.T) {
+	client, err := NewClientWithOptions(WithHost("http://localhost:4243"), WithAPIVersion("1.22"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := client.requestedAPIVersion.String(); v != "1.22" {
+		t.Errorf("WithAPIVersion: wrong version. Want %q. Got %q.", "1.22", v)
+	}
+	if client.SkipServerVersionCheck {
+		t.Error("WithAPIVersion: expected SkipServerVersionCheck to be false, got true")
+	}
+	if _, err := NewClientWithOptions(WithAPIVersion("1.x")); err == nil {
+		t.Error("WithAPIVersion: expected non-nil error for invalid version, got <nil>")
+	}
+}
+
+func TestNewClientWithOptionsFromEnv(t *testing.T) {
+	defer setEnv(map[string]string{
+		"DOCKER_HOST":        "tcp://localhost:2376",
+		"DOCKER_TLS_VERIFY":  "",
+		"DOCKER_API_VERSION": "1.23",
+	})()
+	client, err := NewClientWithOptions(FromEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.endpointURL.String() != "http://localhost:2376" {
+		t.Errorf("FromEnv: wrong endpoint URL. Want %q. Got %q.", "http://localhost:2376", client.endpointURL)
+	}
+	if v := client.requestedAPIVersion.String(); v != "1.23" {
+		t.Errorf("FromEnv: wrong version. Want %q. Got %q.", "1.23", v)
+	}
+	client, err = NewClientWithOptions(FromEnv(), WithAPIVersion("1.21"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := client.requestedAPIVersion.String(); v != "1.21" {
+		t.Errorf("FromEnv + WithAPIVersion: wrong version. Want %q. Got %q.", "1.21", v)
+	}
+	client, err = NewVersionedClientFromEnv("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := client.requestedAPIVersion.String(); v != "1.23" {
+		t.Errorf("NewVersionedClientFromEnv: wrong version. Want %q. Got %q.", "1.23", v)
+	}
+}
+
+func TestNewClientWithOptionsTLS(t *testing.T) {
+	client, err := NewClientWithOptions(
+		WithTLSFiles("testing/data/cert.pem", "testing/data/key.pem", "testing/data/ca.pem"),
+		WithHost("tcp://localhost:2376"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.endpointURL.Scheme != "https" {
+		t.Errorf("WithTLSFiles: wrong scheme. Want %q. Got %q.", "https", client.endpointURL.Scheme)
+	}
+	tr := client.HTTPClient.Transport.(*http.Transport)
+	if tr.TLSClientConfig != client.TLSConfig || client.TLSConfig == nil {
+		t.Errorf("WithTLSFiles: transport not configured for TLS: %#v", tr.TLSClientConfig)
+	}
+	config := &tls.Config{InsecureSkipVerify: true}
+	client, err = NewClientWithOptions(WithHost("tcp://localhost:2376"), WithTLSConfig(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.TLSConfig != config {
+		t.Errorf("WithTLSConfig: wrong TLS config. Want %#v. Got %#v.", config, client.TLSConfig)
+	}
+}
+
+func TestNewClientWithOptionsHTTPClientAndDialer(t *testing.T) {
+	transport := &http.Transport{}
+	httpClient := &http.Client{Transport: transport, Timeout: time.Minute}
+	dialer := &net.Dialer{KeepAlive: time.Minute}
+	client, err := NewClientWithOptions(
+		WithHost("http://localhost:4243"),
+		WithHTTPClient(httpClient),
+		WithDialer(dialer),
+		WithDefaultTimeouts(Timeouts{Request: time.Second}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.HTTPClient.Transport != transport {
+		t.Errorf("WithHTTPClient: wrong transport. Want %#v. Got %#v.", transport, client.HTTPClient.Transport)
+	}
+	if client.HTTPClient.Timeout != time.Second {
+		t.Errorf("WithDefaultTimeouts: wrong request timeout. Want %s. Got %s.", time.Second, client.HTTPClient.Timeout)
+	}
+	client.SetTimeout(time.Hour)
+	if httpClient.Timeout != time.Minute {
+		t.Errorf("WithHTTPClient: the given client was changed. Want timeout %s. Got %s.", time.Minute, httpClient.Timeout)
+	}
+	if client.Dialer.KeepAlive != time.Minute {
+		t.Errorf("WithDialer: wrong dialer. Want %#v. Got %#v.", dialer, client.Dialer)
+	}
+}
+
+func TestNewClientWithOptionsTimeouts(t *testing.T) {
+	timeouts := Timeouts{
+		Dial:           time.Second,
+		TLSHandshake:   2 * time.Second,
+		ResponseHeader: 3 * time.Second,
+		Request:        4 * time.Second,
+	}
+	client, err := NewClientWithOptions(WithHost("http://localhost:4243"), WithDefaultTimeouts(timeouts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Dialer.Timeout != timeouts.Dial {
+		t.Errorf("WithDefaultTimeouts: wrong dial timeout. Want %s. Got %s.", timeouts.Dial, client.Dialer.Timeout)
+	}
+	tr := client.HTTPClient.Transport.(*http.Transport)
+	if tr.TLSHandshakeTimeout != timeouts.TLSHandshake {
+		t.Errorf("WithDefaultTimeouts: wrong TLS handshake timeout. Want %s. Got %s.", timeouts.TLSHandshake, tr.TLSHandshakeTimeout)
+	}
+	if tr.ResponseHeaderTimeout != timeouts.ResponseHeader {
+		t.Errorf("WithDefaultTimeouts: wrong response header timeout. Want %s. Got %s.", timeouts.ResponseHeader, tr.ResponseHeaderTimeout)
+	}
+	if client.HTTPClient.Timeout != timeouts.Request {
+		t.Errorf("WithDefaultTimeouts: wrong request timeout. Want %s. Got %s.", timeouts.Request, client.HTTPClient.Timeout)
+	}
+}
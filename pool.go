@@ -0,0 +1,408 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoHealthyHost is returned by ClientPool when none of its hosts can take
+// a call.
+var ErrNoHealthyHost = errors.New("no healthy Docker host available in the pool")
+
+// DefaultHealthCheckInterval is the interval between two health checks of the
+// hosts of a ClientPool, unless ClientPoolOptions sets another one.
+const DefaultHealthCheckInterval = 10 * time.Second
+
+// DefaultHealthCheckTimeout is the time the hosts of a ClientPool have to
+// answer a health check, unless ClientPoolOptions sets another one.
+const DefaultHealthCheckTimeout = 5 * time.Second
+
+// PoolHost is a Docker host of a ClientPool.
+type PoolHost struct {
+	// Name identifies the host in the pool. Defaults to the endpoint of
+	// the client.
+	Name string
+
+	// Client is the client for the host.
+	Client *Client
+
+	// Labels describe the host, for pinning calls with PinByLabels. They
+	// are merged with the labels of the daemon, which they take precedence
+	// over.
+	Labels map[string]string
+}
+
+// PoolHostState is the state of a host of a ClientPool, as of its last health
+// check or failed call.
+type PoolHostState struct {
+	Name     string
+	Endpoint string
+
+	// Healthy indicates whether the host answered its last health check,
+	// and no call failed to reach it since then.
+	Healthy bool
+
+	// LastCheck is the time of the last health check.
+	LastCheck time.Time
+
+	// LastError is the error of the last health check or failed call, if
+	// any.
+	LastError error
+
+	// ContainersRunning is the number of running containers reported by
+	// the daemon in its last health check.
+	ContainersRunning int
+
+	// Labels are the labels of the host: the ones of the daemon along
+	// with the ones set in PoolHost.
+	Labels map[string]string
+}
+
+// PoolStrategy selects the host for a call among the healthy hosts of a
+// ClientPool.
+type PoolStrategy interface {
+	// Select returns the index of the selected host in the given list,
+	// which is never empty, or -1 if none of the hosts fits.
+	Select(hosts []PoolHostState) int
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+// RoundRobin returns a strategy selecting the hosts in turn.
+func RoundRobin() PoolStrategy {
+	return &roundRobin{}
+}
+
+func (s *roundRobin) Select(hosts []PoolHostState) int {
+	n := atomic.AddUint64(&s.next, 1) - 1
+	return int(n % uint64(len(hosts)))
+}
+
+type leastRunningContainers struct{}
+
+// LeastRunningContainers returns a strategy selecting the host with the
+// fewest running containers, as reported by the daemons in their last
+// health check.
+func LeastRunningContainers() PoolStrategy {
+	return leastRunningContainers{}
+}
+
+func (leastRunningContainers) Select(hosts []PoolHostState) int {
+	selected := 0
+	for i, host := range hosts {
+		if host.ContainersRunning < hosts[selected].ContainersRunning {
+			selected = i
+		}
+	}
+	return selected
+}
+
+type labelPinning struct {
+	labels   map[string]string
+	fallback PoolStrategy
+}
+
+// PinByLabels returns a strategy selecting among the hosts with all the
+// given labels, using the fallback strategy to pick one of them, or
+// RoundRobin if fallback is nil.
+func PinByLabels(labels map[string]string, fallback PoolStrategy) PoolStrategy {
+	if fallback == nil {
+		fallback = RoundRobin()
+	}
+	return &labelPinning{labels: labels, fallback: fallback}
+}
+
+func (s *labelPinning) Select(hosts []PoolHostState) int {
+	var candidates []PoolHostState
+	var indexes []int
+	for i, host := range hosts {
+		if hasLabels(host.Labels, s.labels) {
+			candidates = append(candidates, host)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	selected := s.fallback.Select(candidates)
+	if selected < 0 {
+		return -1
+	}
+	return indexes[selected]
+}
+
+func hasLabels(labels, required map[string]string) bool {
+	for k, v := range required {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ClientPoolOptions specify the behavior of a ClientPool.
+type ClientPoolOptions struct {
+	// Strategy selects the host for the calls. Defaults to RoundRobin.
+	Strategy PoolStrategy
+
+	// HealthCheckInterval is the interval between two health checks of
+	// the hosts. Defaults to DefaultHealthCheckInterval.
+	HealthCheckInterval time.Duration
+
+	// HealthCheckTimeout is the time a host has to answer a health check
+	// before being marked unhealthy. Defaults to
+	// DefaultHealthCheckTimeout.
+	HealthCheckTimeout time.Duration
+}
+
+// ClientPool spreads calls across several Docker hosts, tracking their health
+// with periodic pings.
+//
+// A host that fails its health check, or that a call fails to reach, is left
+// out of the selection until it passes a health check again.
+type ClientPool struct {
+	strategy     PoolStrategy
+	hosts        []*poolHost
+	checkTimeout time.Duration
+	quit         chan struct{}
+	stopOnce     sync.Once
+}
+
+type poolHost struct {
+	client *Client
+	labels map[string]string
+
+	mu    sync.RWMutex
+	state PoolHostState
+}
+
+// NewClientPool returns a pool of the given hosts, after checking their
+// health. Periodic health checks run until the pool is closed.
+func NewClientPool(hosts []PoolHost, opts ClientPoolOptions) (*ClientPool, error) {
+	if len(hosts) == 0 {
+		return nil, errors.New("client pool requires at least one host")
+	}
+	pool := ClientPool{
+		strategy:     opts.Strategy,
+		checkTimeout: opts.HealthCheckTimeout,
+		quit:         make(chan struct{}),
+	}
+	if pool.strategy == nil {
+		pool.strategy = RoundRobin()
+	}
+	if pool.checkTimeout <= 0 {
+		pool.checkTimeout = DefaultHealthCheckTimeout
+	}
+	names := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if host.Client == nil {
+			return nil, errors.New("client pool requires a client for every host")
+		}
+		name := host.Name
+		if name == "" {
+			name = host.Client.Endpoint()
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate host %q in client pool", name)
+		}
+		names[name] = true
+		pool.hosts = append(pool.hosts, &poolHost{
+			client: host.Client,
+			labels: host.Labels,
+			state: PoolHostState{
+				Name:     name,
+				Endpoint: host.Client.Endpoint(),
+				Labels:   host.Labels,
+			},
+		})
+	}
+	pool.CheckHealth()
+	interval := opts.HealthCheckInterval
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	go pool.checkHealthPeriodically(interval)
+	return &pool, nil
+}
+
+func (p *ClientPool) checkHealthPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.CheckHealth()
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// CheckHealth checks the health of all the hosts, without waiting for the
+// next periodic check. Hosts that don't answer within the health check timeout
+// are marked unhealthy.
+func (p *ClientPool) CheckHealth() {
+	var wg sync.WaitGroup
+	for _, host := range p.hosts {
+		wg.Add(1)
+		go func(host *poolHost) {
+			defer wg.Done()
+			host.check(p.checkTimeout)
+		}(host)
+	}
+	wg.Wait()
+}
+
+func (h *poolHost) check(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := h.client.PingWithContext(ctx)
+	var info *DockerInfo
+	if err == nil {
+		info, err = h.client.InfoWithContext(ctx)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state.LastCheck = time.Now()
+	h.state.LastError = err
+	h.state.Healthy = info != nil
+	if info == nil {
+		return
+	}
+	h.state.ContainersRunning = info.ContainersRunning
+	labels := make(map[string]string, len(info.Labels)+len(h.labels))
+	for _, label := range info.Labels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) == 2 {
+			labels[parts[0]] = parts[1]
+		} else {
+			labels[parts[0]] = ""
+		}
+	}
+	for k, v := range h.labels {
+		labels[k] = v
+	}
+	h.state.Labels = labels
+}
+
+func (h *poolHost) markUnhealthy(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state.Healthy = false
+	h.state.LastError = err
+}
+
+func (h *poolHost) getState() PoolHostState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.state
+}
+
+// Hosts returns the state of the hosts of the pool.
+func (p *ClientPool) Hosts() []PoolHostState {
+	states := make([]PoolHostState, len(p.hosts))
+	for i, host := range p.hosts {
+		states[i] = host.getState()
+	}
+	return states
+}
+
+// Client returns the client of a healthy host, selected with the strategy
+// of the pool. It returns ErrNoHealthyHost if none of the hosts is healthy.
+func (p *ClientPool) Client() (*Client, error) {
+	return p.SelectClient(p.strategy)
+}
+
+// SelectClient returns the client of a healthy host, selected with the given
+// strategy instead of the one of the pool. It returns ErrNoHealthyHost if none
+// of the hosts is healthy or fits the strategy.
+func (p *ClientPool) SelectClient(strategy PoolStrategy) (*Client, error) {
+	host, err := p.selectHost(strategy, nil)
+	if err != nil {
+		return nil, err
+	}
+	return host.client, nil
+}
+
+func (p *ClientPool) selectHost(strategy PoolStrategy, exclude map[*poolHost]bool) (*poolHost, error) {
+	var candidates []*poolHost
+	var states []PoolHostState
+	for _, host := range p.hosts {
+		if exclude[host] {
+			continue
+		}
+		if state := host.getState(); state.Healthy {
+			candidates = append(candidates, host)
+			states = append(states, state)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoHealthyHost
+	}
+	selected := strategy.Select(states)
+	if selected < 0 || selected >= len(candidates) {
+		return nil, ErrNoHealthyHost
+	}
+	return candidates[selected], nil
+}
+
+// ReadOnly runs the given read-only call with the client of a host selected
+// with the strategy of the pool. When the call fails to reach the host, the
+// host is marked as unhealthy and the call runs again on another host, until
+// it succeeds or no healthy host is left.
+//
+// The call must not change the state of the hosts, as a failed call may have
+// reached the daemon before failing.
+func (p *ClientPool) ReadOnly(call func(*Client) error) error {
+	tried := make(map[*poolHost]bool)
+	var lastErr error
+	for {
+		host, err := p.selectHost(p.strategy, tried)
+		if err != nil {
+			if lastErr != nil {
+				return lastErr
+			}
+			return err
+		}
+		err = call(host.client)
+		if err == nil || !isHostFailure(err) {
+			return err
+		}
+		host.markUnhealthy(err)
+		tried[host] = true
+		lastErr = err
+	}
+}
+
+// isHostFailure indicates whether the given error reports that the host
+// couldn't be reached or is unable to handle calls.
+func isHostFailure(err error) bool {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	if IsUnavailable(err) {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// Close stops the periodic health checks of the pool.
+func (p *ClientPool) Close() {
+	p.stopOnce.Do(func() { close(p.quit) })
+}
@@ -0,0 +1,302 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	dtesting "github.com/fsouza/go-dockerclient/testing"
+)
+
+func newPoolServers(t *testing.T, n int) ([]*dtesting.DockerServer, []docker.PoolHost) {
+	var servers []*dtesting.DockerServer
+	var hosts []docker.PoolHost
+	for i := 0; i < n; i++ {
+		server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// keep-alives are disabled for stopped servers to look down
+		// right away
+		client, err := docker.NewClientWithOptions(
+			docker.WithHost(server.URL()),
+			docker.WithHTTPClient(&http.Client{Transport: &http.Transport{DisableKeepAlives: true}}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, server)
+		hosts = append(hosts, docker.PoolHost{Client: client})
+	}
+	return servers, hosts
+}
+
+func stopPoolServers(servers []*dtesting.DockerServer) {
+	for _, server := range servers {
+		server.Stop()
+	}
+}
+
+func TestClientPoolRoundRobin(t *testing.T) {
+	servers, hosts := newPoolServers(t, 3)
+	defer stopPoolServers(servers)
+	pool, err := docker.NewClientPool(hosts, docker.ClientPoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	for i := 0; i < 6; i++ {
+		client, err := pool.Client()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := hosts[i%3].Client; client != expected {
+			t.Errorf("Client: wrong client at call %d. Want %s. Got %s.", i, expected.Endpoint(), client.Endpoint())
+		}
+	}
+}
+
+func TestClientPoolLeastRunningContainers(t *testing.T) {
+	servers, hosts := newPoolServers(t, 2)
+	defer stopPoolServers(servers)
+	client := hosts[0].Client
+	if err := client.PullImage(docker.PullImageOptions{Repository: "busybox"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+	container, err := client.CreateContainer(docker.CreateContainerOptions{Config: &docker.Config{Image: "busybox"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.StartContainer(container.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := docker.NewClientPool(hosts, docker.ClientPoolOptions{Strategy: docker.LeastRunningContainers()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if states := pool.Hosts(); states[0].ContainersRunning != 1 || states[1].ContainersRunning != 0 {
+		t.Errorf("Hosts: wrong number of running containers. Got %d and %d.", states[0].ContainersRunning, states[1].ContainersRunning)
+	}
+	for i := 0; i < 3; i++ {
+		selected, err := pool.Client()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if selected != hosts[1].Client {
+			t.Errorf("Client: wrong client. Want %s. Got %s.", hosts[1].Client.Endpoint(), selected.Endpoint())
+		}
+	}
+}
+
+func TestClientPoolPinByLabels(t *testing.T) {
+	servers, hosts := newPoolServers(t, 3)
+	defer stopPoolServers(servers)
+	hosts[0].Labels = map[string]string{"zone": "a"}
+	hosts[1].Labels = map[string]string{"zone": "b", "gpu": "true"}
+	hosts[2].Labels = map[string]string{"zone": "b"}
+	pool, err := docker.NewClientPool(hosts, docker.ClientPoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	client, err := pool.SelectClient(docker.PinByLabels(map[string]string{"gpu": "true"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client != hosts[1].Client {
+		t.Errorf("SelectClient: wrong client. Want %s. Got %s.", hosts[1].Client.Endpoint(), client.Endpoint())
+	}
+	zoneB := docker.PinByLabels(map[string]string{"zone": "b"}, nil)
+	for i := 0; i < 4; i++ {
+		client, err := pool.SelectClient(zoneB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := hosts[1+i%2].Client; client != expected {
+			t.Errorf("SelectClient: wrong client at call %d. Want %s. Got %s.", i, expected.Endpoint(), client.Endpoint())
+		}
+	}
+	_, err = pool.SelectClient(docker.PinByLabels(map[string]string{"zone": "c"}, nil))
+	if err != docker.ErrNoHealthyHost {
+		t.Errorf("SelectClient: wrong error. Want %#v. Got %#v.", docker.ErrNoHealthyHost, err)
+	}
+}
+
+func TestClientPoolReadOnlyFailover(t *testing.T) {
+	servers, hosts := newPoolServers(t, 2)
+	defer stopPoolServers(servers)
+	pool, err := docker.NewClientPool(hosts, docker.ClientPoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	servers[0].Stop()
+	var used []*docker.Client
+	err = pool.ReadOnly(func(client *docker.Client) error {
+		used = append(used, client)
+		_, err := client.ListContainers(docker.ListContainersOptions{})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(used) != 2 || used[0] != hosts[0].Client || used[1] != hosts[1].Client {
+		t.Errorf("ReadOnly: expected a failover from the first host to the second one, got %d calls.", len(used))
+	}
+	states := pool.Hosts()
+	if states[0].Healthy || states[0].LastError == nil {
+		t.Errorf("Hosts: expected the first host to be unhealthy, got %#v.", states[0])
+	}
+	if !states[1].Healthy {
+		t.Errorf("Hosts: expected the second host to be healthy, got %#v.", states[1])
+	}
+	servers[1].Stop()
+	err = pool.ReadOnly(func(client *docker.Client) error {
+		_, err := client.ListContainers(docker.ListContainersOptions{})
+		return err
+	})
+	if err == nil {
+		t.Error("ReadOnly: expected non-nil error with all the hosts down, got <nil>")
+	}
+	if _, err := pool.Client(); err != docker.ErrNoHealthyHost {
+		t.Errorf("Client: wrong error. Want %#v. Got %#v.", docker.ErrNoHealthyHost, err)
+	}
+}
+
+func TestClientPoolReadOnlyNoFailoverOnAPIError(t *testing.T) {
+	servers, hosts := newPoolServers(t, 2)
+	defer stopPoolServers(servers)
+	pool, err := docker.NewClientPool(hosts, docker.ClientPoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	calls := 0
+	err = pool.ReadOnly(func(client *docker.Client) error {
+		calls++
+		_, err := client.InspectContainer("missing")
+		return err
+	})
+	if !docker.IsNotFound(err) {
+		t.Errorf("ReadOnly: wrong error. Want not found. Got %#v.", err)
+	}
+	if calls != 1 {
+		t.Errorf("ReadOnly: wrong number of calls. Want 1. Got %d.", calls)
+	}
+	for _, state := range pool.Hosts() {
+		if !state.Healthy {
+			t.Errorf("Hosts: expected host %s to be healthy, got %#v.", state.Name, state)
+		}
+	}
+}
+
+func TestClientPoolPeriodicHealthCheck(t *testing.T) {
+	servers, hosts := newPoolServers(t, 2)
+	defer stopPoolServers(servers)
+	hosts[0].Name = "flaky"
+	var down int32 = 1
+	servers[0].CustomHandler("/_ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) != 0 {
+			http.Error(w, "daemon is restarting", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	pool, err := docker.NewClientPool(hosts, docker.ClientPoolOptions{HealthCheckInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	states := pool.Hosts()
+	if states[0].Name != "flaky" || states[0].Healthy {
+		t.Errorf("Hosts: expected host flaky to be unhealthy, got %#v.", states[0])
+	}
+	if states[1].Name != hosts[1].Client.Endpoint() {
+		t.Errorf("Hosts: wrong default name. Want %q. Got %q.", hosts[1].Client.Endpoint(), states[1].Name)
+	}
+	atomic.StoreInt32(&down, 0)
+	deadline := time.Now().Add(5 * time.Second)
+	for !pool.Hosts()[0].Healthy {
+		if time.Now().After(deadline) {
+			t.Fatal("Hosts: host flaky didn't become healthy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientPoolHealthCheckTimeout(t *testing.T) {
+	servers, hosts := newPoolServers(t, 2)
+	defer stopPoolServers(servers)
+	release := make(chan struct{})
+	defer close(release)
+	servers[0].CustomHandler("/_ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	start := time.Now()
+	pool, err := docker.NewClientPool(hosts, docker.ClientPoolOptions{HealthCheckTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("NewClientPool: took %s with a wedged host.", elapsed)
+	}
+	states := pool.Hosts()
+	if states[0].Healthy || states[0].LastError != context.DeadlineExceeded {
+		t.Errorf("Hosts: expected the wedged host to be unhealthy, got %#v.", states[0])
+	}
+	if !states[1].Healthy {
+		t.Errorf("Hosts: expected the other host to be healthy, got %#v.", states[1])
+	}
+}
+
+func TestClientPoolHealthCheckTimeoutVersionDetection(t *testing.T) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	release := make(chan struct{})
+	defer close(release)
+	server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	client, err := docker.NewVersionedClient(server.URL(), "1.24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := docker.NewClientPool([]docker.PoolHost{{Client: client}}, docker.ClientPoolOptions{HealthCheckTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	states := pool.Hosts()
+	if states[0].Healthy || states[0].LastError != context.DeadlineExceeded {
+		t.Errorf("Hosts: expected the host to be unhealthy, got %#v.", states[0])
+	}
+}
+
+func TestNewClientPoolInvalidHosts(t *testing.T) {
+	if _, err := docker.NewClientPool(nil, docker.ClientPoolOptions{}); err == nil {
+		t.Error("NewClientPool: expected non-nil error for empty pool, got <nil>")
+	}
+	if _, err := docker.NewClientPool([]docker.PoolHost{{Name: "nil"}}, docker.ClientPoolOptions{}); err == nil {
+		t.Error("NewClientPool: expected non-nil error for host without client, got <nil>")
+	}
+	client, err := docker.NewClient("http://localhost:4243")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := []docker.PoolHost{{Client: client}, {Client: client}}
+	if _, err := docker.NewClientPool(hosts, docker.ClientPoolOptions{}); err == nil {
+		t.Error("NewClientPool: expected non-nil error for duplicate hosts, got <nil>")
+	}
+}
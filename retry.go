@@ -0,0 +1,156 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RetryPolicy describes how the client retries API calls that fail with a
+// transient error, like a refused connection while the daemon is restarting
+// or a 5xx response.
+//
+// Only safe operations are retried: GET and HEAD requests, along with POST
+// requests that are known to be idempotent (for example, StopContainer).
+// Retries never go past the deadline of the context associated with the
+// call. The policy also applies to the connection of the event monitor to the
+// event stream.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one. Values lower than 2 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the time to wait before the first retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the time to wait between two attempts. Zero means
+	// no cap.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor by which the backoff grows after each
+	// attempt. When zero, the backoff doubles after each attempt.
+	Multiplier float64
+
+	// Jitter is the fraction of the backoff, between 0 and 1, that is
+	// randomized in order to avoid synchronized retries from multiple
+	// clients.
+	Jitter float64
+
+	// RetryableStatusCodes is the list of HTTP status codes that are
+	// considered transient.
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with sensible defaults: up to 5
+// attempts, starting with a 100ms backoff capped at 5 seconds, with 20% of
+// jitter, retrying on 500, 502, 503 and 504 responses.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableStatusCodes: []int{
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// eventMonitorRetryPolicy is the policy used for connecting to the event
+// stream when the client does not have a retry policy.
+var eventMonitorRetryPolicy = &RetryPolicy{
+	MaxAttempts:    maxMonitorConnRetries + 1,
+	InitialBackoff: retryInitialWaitTime * time.Millisecond,
+	Multiplier:     2,
+}
+
+// backoff returns the time to wait after the given attempt, starting at 0.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	wait := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt))
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(wait)
+}
+
+// shouldRetry indicates whether another attempt should be made after the
+// given attempt (starting at 0) failed with the given error.
+func (p *RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if p == nil || attempt+1 >= p.MaxAttempts {
+		return false
+	}
+	return p.isRetryable(err)
+}
+
+// isRetryable indicates whether the given error is transient: a retryable
+// status, a timeout, or a connection refused, reset or closed by the daemon.
+// Other errors, like the failure of the verification of a certificate, won't
+// go away by retrying.
+func (p *RetryPolicy) isRetryable(err error) bool {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	if e, ok := err.(*Error); ok {
+		for _, code := range p.RetryableStatusCodes {
+			if e.Status == code {
+				return true
+			}
+		}
+		return false
+	}
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	if err == ErrConnectionRefused || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if e, ok := err.(net.Error); ok && (e.Timeout() || e.Temporary()) {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "connection refused") || strings.Contains(message, "connection reset")
+}
+
+// wait blocks for the backoff of the given attempt, returning false without
+// waiting if the context is done or if its deadline would be exceeded before
+// the next attempt.
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	wait := p.backoff(attempt)
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// isIdempotent indicates whether a request may be safely retried.
+func isIdempotent(method string, doOptions doOptions) bool {
+	return method == "GET" || method == "HEAD" || doOptions.idempotent
+}
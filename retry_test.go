@@ -0,0 +1,205 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          3,
+		InitialBackoff:       time.Millisecond,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+}
+
+// failFirstAttempts returns an interceptor failing the given number of
+// attempts with a 503 error, before they're sent, along with the number of
+// attempts.
+func failFirstAttempts(failures int32) (Interceptor, *int32) {
+	var attempts int32
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		if atomic.AddInt32(&attempts, 1) <= failures {
+			return nil, &Error{Status: http.StatusServiceUnavailable}
+		}
+		return next(req)
+	}, &attempts
+}
+
+func TestRetryPolicyRetriesSafeRequests(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "[]", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.RetryPolicy = newTestRetryPolicy()
+	interceptor, attempts := failFirstAttempts(2)
+	client.AddInterceptor(interceptor)
+	if _, err := client.ListContainers(ListContainersOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(attempts); n != 3 {
+		t.Errorf("ListContainers: wrong number of attempts. Want 3. Got %d.", n)
+	}
+	if len(fakeRT.requests) != 1 {
+		t.Errorf("ListContainers: wrong number of requests. Want 1. Got %d.", len(fakeRT.requests))
+	}
+}
+
+func TestRetryPolicyMaxAttempts(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusServiceUnavailable}
+	client := newTestClient(fakeRT)
+	client.RetryPolicy = newTestRetryPolicy()
+	_, err := client.ListContainers(ListContainersOptions{})
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusServiceUnavailable {
+		t.Errorf("ListContainers: wrong error. Want 503 *Error. Got %#v.", err)
+	}
+	if len(fakeRT.requests) != 3 {
+		t.Errorf("ListContainers: wrong number of attempts. Want 3. Got %d.", len(fakeRT.requests))
+	}
+}
+
+func TestRetryPolicyNonRetryableStatus(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusInternalServerError}
+	client := newTestClient(fakeRT)
+	client.RetryPolicy = newTestRetryPolicy()
+	if _, err := client.ListContainers(ListContainersOptions{}); err == nil {
+		t.Fatal("ListContainers: expected non-nil error, got <nil>")
+	}
+	if len(fakeRT.requests) != 1 {
+		t.Errorf("ListContainers: wrong number of attempts. Want 1. Got %d.", len(fakeRT.requests))
+	}
+}
+
+func TestRetryPolicyCertificateFailure(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RetryPolicy = newTestRetryPolicy()
+	interceptor, attempts := failFirstAttempts(0)
+	client.AddInterceptor(interceptor)
+	// the certificate of the server isn't trusted by the client
+	if _, err := client.ListContainers(ListContainersOptions{}); err == nil {
+		t.Fatal("ListContainers: expected non-nil error, got <nil>")
+	}
+	if n := atomic.LoadInt32(attempts); n != 1 {
+		t.Errorf("ListContainers: wrong number of attempts. Want 1. Got %d.", n)
+	}
+}
+
+func TestRetryPolicyDoesNotRetryUnsafeRequests(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusServiceUnavailable}
+	client := newTestClient(fakeRT)
+	client.RetryPolicy = newTestRetryPolicy()
+	if _, err := client.CreateVolume(CreateVolumeOptions{Name: "vol"}); err == nil {
+		t.Fatal("CreateVolume: expected non-nil error, got <nil>")
+	}
+	if len(fakeRT.requests) != 1 {
+		t.Errorf("CreateVolume: wrong number of attempts. Want 1. Got %d.", len(fakeRT.requests))
+	}
+}
+
+func TestRetryPolicyRetriesIdempotentPOST(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusNoContent}
+	client := newTestClient(fakeRT)
+	client.RetryPolicy = newTestRetryPolicy()
+	interceptor, attempts := failFirstAttempts(1)
+	client.AddInterceptor(interceptor)
+	if err := client.StopContainer("abc", 10); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(attempts); n != 2 {
+		t.Errorf("StopContainer: wrong number of attempts. Want 2. Got %d.", n)
+	}
+}
+
+func TestRetryPolicyRespectsContextDeadline(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusServiceUnavailable}
+	client := newTestClient(fakeRT)
+	client.RetryPolicy = newTestRetryPolicy()
+	client.RetryPolicy.InitialBackoff = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := client.ListContainers(ListContainersOptions{Context: ctx})
+	if err == nil {
+		t.Fatal("ListContainers: expected non-nil error, got <nil>")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("ListContainers: should not wait past the deadline, took %s", elapsed)
+	}
+	if len(fakeRT.requests) != 1 {
+		t.Errorf("ListContainers: wrong number of attempts. Want 1. Got %d.", len(fakeRT.requests))
+	}
+}
+
+func TestRetryPolicyNilClientPolicy(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusServiceUnavailable}
+	client := newTestClient(fakeRT)
+	if _, err := client.ListContainers(ListContainersOptions{}); err == nil {
+		t.Fatal("ListContainers: expected non-nil error, got <nil>")
+	}
+	if len(fakeRT.requests) != 1 {
+		t.Errorf("ListContainers: wrong number of attempts. Want 1. Got %d.", len(fakeRT.requests))
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	var tests = []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{2, 40 * time.Millisecond},
+		{3, 50 * time.Millisecond},
+		{10, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := policy.backoff(tt.attempt); got != tt.expected {
+			t.Errorf("backoff(%d): Want %s. Got %s.", tt.attempt, tt.expected, got)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := policy.backoff(1)
+		if got < 10*time.Millisecond || got > 30*time.Millisecond {
+			t.Fatalf("backoff(1) with jitter: %s out of range", got)
+		}
+	}
+}
+
+func TestEventMonitorRetryPolicy(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusServiceUnavailable}
+	client := newTestClient(fakeRT)
+	state := &eventMonitoringState{C: make(chan *APIEvents, 1), errC: make(chan error, 1)}
+	var tests = []struct {
+		policy   *RetryPolicy
+		attempts int
+	}{
+		{nil, maxMonitorConnRetries + 1},
+		{newTestRetryPolicy(), 3},
+		{&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, 1},
+	}
+	for _, tt := range tests {
+		fakeRT.Reset()
+		client.RetryPolicy = tt.policy
+		if err := state.connectWithRetry(client); err == nil {
+			t.Error("connectWithRetry: unexpected <nil> error")
+		}
+		if len(fakeRT.requests) != tt.attempts {
+			t.Errorf("connectWithRetry: wrong number of attempts. Want %d. Got %d.", tt.attempts, len(fakeRT.requests))
+		}
+	}
+}
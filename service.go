@@ -5,11 +5,11 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
 	"github.com/docker/engine-api/types/swarm"
-	"golang.org/x/net/context"
 )
 
 // NoSuchService is the error returned when a given service does not exist.
@@ -38,11 +38,15 @@ type CreateServiceOptions struct {
 //
 // See https://goo.gl/KrVjHz for more details.
 func (c *Client) CreateService(opts CreateServiceOptions) (*swarm.Service, error) {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return nil, err
+	}
 	path := "/services/create?" + queryString(opts)
 	resp, err := c.do("POST", path, doOptions{
-		data:      opts.ServiceSpec,
-		forceJSON: true,
-		context:   opts.Context,
+		data:        opts.ServiceSpec,
+		forceJSON:   true,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
 		return nil, err
@@ -67,8 +71,11 @@ type RemoveServiceOptions struct {
 //
 // See https://goo.gl/Tqrtya for more details.
 func (c *Client) RemoveService(opts RemoveServiceOptions) error {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return err
+	}
 	path := "/services/" + opts.ID
-	resp, err := c.do("DELETE", path, doOptions{context: opts.Context})
+	resp, err := c.do("DELETE", path, doOptions{context: opts.Context, callOptions: opts})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchService{ID: opts.ID}
@@ -91,10 +98,14 @@ type UpdateServiceOptions struct {
 //
 // See https://goo.gl/wu3MmS for more details.
 func (c *Client) UpdateService(id string, opts UpdateServiceOptions) error {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return err
+	}
 	resp, err := c.do("POST", "/services/"+id+"/update", doOptions{
-		data:      opts.ServiceSpec,
-		forceJSON: true,
-		context:   opts.Context,
+		data:        opts.ServiceSpec,
+		forceJSON:   true,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
@@ -110,8 +121,17 @@ func (c *Client) UpdateService(id string, opts UpdateServiceOptions) error {
 //
 // See https://goo.gl/dHmr75 for more details.
 func (c *Client) InspectService(id string) (*swarm.Service, error) {
+	return c.InspectServiceWithContext(context.Background(), id)
+}
+
+// InspectServiceWithContext returns information about a service by its ID. The
+// context can be used to cancel the request.
+func (c *Client) InspectServiceWithContext(ctx context.Context, id string) (*swarm.Service, error) {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return nil, err
+	}
 	path := "/services/" + id
-	resp, err := c.do("GET", path, doOptions{})
+	resp, err := c.do("GET", path, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchService{ID: id}
@@ -138,6 +158,9 @@ type ListServicesOptions struct {
 //
 // See https://goo.gl/DwvNMd for more details.
 func (c *Client) ListServices(opts ListServicesOptions) ([]swarm.Service, error) {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return nil, err
+	}
 	path := "/services?" + queryString(opts)
 	resp, err := c.do("GET", path, doOptions{context: opts.Context})
 	if err != nil {
@@ -0,0 +1,224 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/homedir"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultSSHPort   = "22"
+	defaultSSHSocket = "/var/run/docker.sock"
+)
+
+// SSHConfig configures how the client authenticates to ssh:// endpoints and
+// how it verifies the key of the remote host.
+//
+// Endpoints are in the form ssh://user@host[:port][/path/to/docker.sock]. The
+// client forwards its connections to the unix socket of the remote Docker
+// daemon, /var/run/docker.sock unless a path is given.
+type SSHConfig struct {
+	// User is the user to authenticate as when the endpoint doesn't
+	// include one. Defaults to the USER environment variable.
+	User string
+
+	// UseAgent enables authentication with the keys held by the SSH agent
+	// listening on SSH_AUTH_SOCK.
+	UseAgent bool
+
+	// KeyFiles are paths to unencrypted private keys.
+	KeyFiles []string
+
+	// Signers are private keys held in memory.
+	Signers []ssh.Signer
+
+	// KnownHostsFiles are the known_hosts files used for verifying the
+	// key of the remote host.
+	KnownHostsFiles []string
+
+	// HostKeyCallback, when set, is used instead of KnownHostsFiles for
+	// verifying the key of the remote host.
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+// DefaultSSHConfig returns the SSHConfig used for ssh:// endpoints when the
+// client is created without WithSSHConfig: it authenticates with the SSH
+// agent, when SSH_AUTH_SOCK is set, and with the default key files in
+// ~/.ssh, verifying the remote host against ~/.ssh/known_hosts.
+func DefaultSSHConfig() *SSHConfig {
+	config := SSHConfig{UseAgent: os.Getenv("SSH_AUTH_SOCK") != ""}
+	home := homedir.Get()
+	if home == "" {
+		return &config
+	}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			config.KeyFiles = append(config.KeyFiles, path)
+		}
+	}
+	config.KnownHostsFiles = []string{filepath.Join(home, ".ssh", "known_hosts")}
+	return &config
+}
+
+// WithSSHConfig sets the configuration used for ssh:// endpoints.
+func WithSSHConfig(config *SSHConfig) ClientOption {
+	return func(o *clientOptions) error {
+		if config == nil {
+			return errors.New("SSH config is required")
+		}
+		o.sshConfig = config
+		return nil
+	}
+}
+
+// sshDialer opens connections to the unix socket of a remote Docker daemon,
+// multiplexed on a single SSH connection that is established on first use
+// and re-established after it's lost.
+type sshDialer struct {
+	config *SSHConfig
+	user   string
+	addr   string
+	socket string
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func newSSHDialer(u *url.URL, config *SSHConfig) *sshDialer {
+	if config == nil {
+		config = DefaultSSHConfig()
+	}
+	d := sshDialer{config: config, socket: u.Path}
+	if d.socket == "" || d.socket == "/" {
+		d.socket = defaultSSHSocket
+	}
+	if u.User != nil {
+		d.user = u.User.Username()
+	}
+	if d.user == "" {
+		d.user = config.User
+	}
+	if d.user == "" {
+		d.user = os.Getenv("USER")
+	}
+	d.addr = u.Host
+	if _, _, err := net.SplitHostPort(d.addr); err != nil {
+		d.addr = net.JoinHostPort(d.addr, defaultSSHPort)
+	}
+	return &d
+}
+
+// Dial opens a new connection to the remote Docker socket.
+func (d *sshDialer) Dial(dialer *net.Dialer) (net.Conn, error) {
+	client, err := d.sshClient(dialer)
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial("unix", d.socket)
+}
+
+func (d *sshDialer) sshClient(dialer *net.Dialer) (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		return d.client, nil
+	}
+	config, cleanup, err := d.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	conn, err := dialer.Dial("tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	if dialer.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, d.addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(sshConn, chans, reqs)
+	go func() {
+		client.Wait()
+		d.mu.Lock()
+		if d.client == client {
+			d.client = nil
+		}
+		d.mu.Unlock()
+	}()
+	d.client = client
+	return client, nil
+}
+
+// clientConfig builds the configuration for a new SSH connection. The
+// returned function releases the connection to the SSH agent, and must be
+// called once the handshake is done.
+func (d *sshDialer) clientConfig() (*ssh.ClientConfig, func(), error) {
+	cleanup := func() {}
+	hostKeyCallback := d.config.HostKeyCallback
+	if hostKeyCallback == nil {
+		if len(d.config.KnownHostsFiles) == 0 {
+			return nil, nil, errors.New("ssh: no known_hosts file configured, set SSHConfig.HostKeyCallback to verify the remote host")
+		}
+		var err error
+		hostKeyCallback, err = knownhosts.New(d.config.KnownHostsFiles...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	signers := append([]ssh.Signer(nil), d.config.Signers...)
+	for _, path := range d.config.KeyFiles {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			if _, ok := err.(*ssh.PassphraseMissingError); ok {
+				continue
+			}
+			return nil, nil, err
+		}
+		signers = append(signers, signer)
+	}
+	if d.config.UseAgent {
+		if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+			conn, err := net.Dial("unix", socket)
+			if err != nil {
+				return nil, nil, err
+			}
+			cleanup = func() { conn.Close() }
+			agentSigners, err := agent.NewClient(conn).Signers()
+			if err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+			signers = append(signers, agentSigners...)
+		}
+	}
+	config := ssh.ClientConfig{
+		User:            d.user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: hostKeyCallback,
+	}
+	return &config, cleanup, nil
+}
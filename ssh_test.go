@@ -0,0 +1,339 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newSSHSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// sshTestServer is an SSH server that forwards streamlocal channels to a
+// local unix socket, regardless of the requested socket path.
+type sshTestServer struct {
+	listener  net.Listener
+	socket    string
+	hostKey   ssh.Signer
+	clientKey ssh.Signer
+
+	mu      sync.Mutex
+	users   []string
+	sockets []string
+}
+
+func newSSHTestServer(t *testing.T, socket string) *sshTestServer {
+	srv := sshTestServer{
+		socket:    socket,
+		hostKey:   newSSHSigner(t),
+		clientKey: newSSHSigner(t),
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), srv.clientKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(srv.hostKey)
+	var err error
+	srv.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := srv.listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn, config)
+		}
+	}()
+	return &srv
+}
+
+func (srv *sshTestServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+	srv.mu.Lock()
+	srv.users = append(srv.users, sshConn.User())
+	srv.mu.Unlock()
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "direct-streamlocal@openssh.com" {
+			newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		var payload struct {
+			SocketPath string
+			Reserved0  string
+			Reserved1  uint32
+		}
+		if err := ssh.Unmarshal(newChan.ExtraData(), &payload); err != nil {
+			newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		srv.mu.Lock()
+		srv.sockets = append(srv.sockets, payload.SocketPath)
+		srv.mu.Unlock()
+		ch, reqs, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go ssh.DiscardRequests(reqs)
+		go srv.forward(ch)
+	}
+}
+
+func (srv *sshTestServer) forward(ch ssh.Channel) {
+	defer ch.Close()
+	conn, err := net.Dial("unix", srv.socket)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		io.Copy(conn, ch)
+		conn.(*net.UnixConn).CloseWrite()
+	}()
+	io.Copy(ch, conn)
+	ch.CloseWrite()
+	wg.Wait()
+}
+
+func (srv *sshTestServer) requestedSockets() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.sockets
+}
+
+func (srv *sshTestServer) Close() {
+	srv.listener.Close()
+}
+
+func newSSHDockerServer(t *testing.T) (*sshTestServer, func()) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+			w.Write([]byte("OK"))
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"Id":"abc"}]`))
+		case strings.HasSuffix(r.URL.Path, "/logs"):
+			w.Write([]byte("streamed over ssh"))
+		case strings.HasSuffix(r.URL.Path, "/events"):
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"Action":"start","Type":"container","Actor":{"ID":"abc"},"time":1374067924}`)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		case strings.HasSuffix(r.URL.Path, "/start"):
+			ioutil.ReadAll(r.Body)
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+			rw.Flush()
+			io.Copy(conn, rw)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	unixSrv, cleanup, err := newUnixServer(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unixSrv.Start()
+	srv := newSSHTestServer(t, unixSrv.Listener.Addr().String())
+	return srv, func() {
+		srv.Close()
+		unixSrv.Close()
+		cleanup()
+	}
+}
+
+func newSSHTestClient(t *testing.T, srv *sshTestServer) *Client {
+	client, err := NewClientWithOptions(
+		WithHost("ssh://docker@"+srv.listener.Addr().String()+"/run/user/docker.sock"),
+		WithSSHConfig(&SSHConfig{
+			Signers:         []ssh.Signer{srv.clientKey},
+			HostKeyCallback: ssh.FixedHostKey(srv.hostKey.PublicKey()),
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestSSHEndpoint(t *testing.T) {
+	srv, cleanup := newSSHDockerServer(t)
+	defer cleanup()
+	client := newSSHTestClient(t, srv)
+	containers, err := client.ListContainers(ListContainersOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].ID != "abc" {
+		t.Errorf("ListContainers: wrong containers. Got %#v.", containers)
+	}
+	var stdout bytes.Buffer
+	err = client.Logs(LogsOptions{Container: "abc", OutputStream: &stdout, Stdout: true, RawTerminal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "streamed over ssh" {
+		t.Errorf("Logs: wrong output. Want %q. Got %q.", "streamed over ssh", stdout.String())
+	}
+	stdout.Reset()
+	err = client.StartExec("exec", StartExecOptions{
+		InputStream:  strings.NewReader("hijacked over ssh"),
+		OutputStream: &stdout,
+		RawTerminal:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "hijacked over ssh" {
+		t.Errorf("StartExec: wrong output. Want %q. Got %q.", "hijacked over ssh", stdout.String())
+	}
+	for _, socket := range srv.requestedSockets() {
+		if socket != "/run/user/docker.sock" {
+			t.Errorf("SSH: wrong socket path. Want %q. Got %q.", "/run/user/docker.sock", socket)
+		}
+	}
+	srv.mu.Lock()
+	users := srv.users
+	srv.mu.Unlock()
+	if len(users) != 1 || users[0] != "docker" {
+		t.Errorf("SSH: expected a single connection for user docker, got %#v.", users)
+	}
+}
+
+func TestSSHEndpointEvents(t *testing.T) {
+	srv, cleanup := newSSHDockerServer(t)
+	defer cleanup()
+	client := newSSHTestClient(t, srv)
+	listener := make(chan *APIEvents, 10)
+	if err := client.AddEventListener(listener); err != nil {
+		t.Fatal(err)
+	}
+	defer client.RemoveEventListener(listener)
+	select {
+	case event := <-listener:
+		if event.Action != "start" || event.Actor.ID != "abc" {
+			t.Errorf("AddEventListener: wrong event. Got %#v.", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddEventListener: timed out waiting for events")
+	}
+}
+
+func TestSSHEndpointKnownHosts(t *testing.T) {
+	srv, cleanup := newSSHDockerServer(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := srv.listener.Addr().String()
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, srv.hostKey.PublicKey())
+	if err := ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := &SSHConfig{
+		User:            "docker",
+		Signers:         []ssh.Signer{srv.clientKey},
+		KnownHostsFiles: []string{knownHosts},
+	}
+	client, err := NewClientWithOptions(WithHost("ssh://"+addr), WithSSHConfig(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if sockets := srv.requestedSockets(); sockets[0] != defaultSSHSocket {
+		t.Errorf("SSH: wrong socket path. Want %q. Got %q.", defaultSSHSocket, sockets[0])
+	}
+	otherKey := newSSHSigner(t)
+	line = knownhosts.Line([]string{knownhosts.Normalize(addr)}, otherKey.PublicKey())
+	if err := ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client, err = NewClientWithOptions(WithHost("ssh://"+addr), WithSSHConfig(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(); err == nil {
+		t.Error("Ping: expected non-nil error for mismatched host key, got <nil>")
+	}
+}
+
+func TestSSHEndpointUnauthorizedKey(t *testing.T) {
+	srv, cleanup := newSSHDockerServer(t)
+	defer cleanup()
+	client, err := NewClientWithOptions(
+		WithHost("ssh://docker@"+srv.listener.Addr().String()),
+		WithSSHConfig(&SSHConfig{
+			Signers:         []ssh.Signer{newSSHSigner(t)},
+			HostKeyCallback: ssh.FixedHostKey(srv.hostKey.PublicKey()),
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(); err == nil {
+		t.Error("Ping: expected non-nil error for unauthorized key, got <nil>")
+	}
+}
+
+func TestParseEndpointSSH(t *testing.T) {
+	if _, err := parseEndpoint("ssh://docker@host", false); err != nil {
+		t.Errorf("parseEndpoint: unexpected error for ssh endpoint: %s", err)
+	}
+	if _, err := parseEndpoint("ssh://", false); err != ErrInvalidEndpoint {
+		t.Errorf("parseEndpoint: wrong error for ssh endpoint without host. Want %#v. Got %#v.", ErrInvalidEndpoint, err)
+	}
+}
@@ -5,6 +5,7 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -12,7 +13,6 @@ import (
 	"strconv"
 
 	"github.com/docker/engine-api/types/swarm"
-	"golang.org/x/net/context"
 )
 
 var (
@@ -35,11 +35,15 @@ type InitSwarmOptions struct {
 // InitSwarm initializes a new Swarm and returns the node ID.
 // See https://goo.gl/hzkgWu for more details.
 func (c *Client) InitSwarm(opts InitSwarmOptions) (string, error) {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return "", err
+	}
 	path := "/swarm/init"
 	resp, err := c.do("POST", path, doOptions{
-		data:      opts.InitRequest,
-		forceJSON: true,
-		context:   opts.Context,
+		data:        opts.InitRequest,
+		forceJSON:   true,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotAcceptable {
@@ -65,18 +69,24 @@ type JoinSwarmOptions struct {
 // JoinSwarm joins an existing Swarm.
 // See https://goo.gl/TdhJWU for more details.
 func (c *Client) JoinSwarm(opts JoinSwarmOptions) error {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return err
+	}
 	path := "/swarm/join"
-	_, err := c.do("POST", path, doOptions{
-		data:      opts.JoinRequest,
-		forceJSON: true,
-		context:   opts.Context,
+	resp, err := c.do("POST", path, doOptions{
+		data:        opts.JoinRequest,
+		forceJSON:   true,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotAcceptable {
 			return ErrNodeAlreadyInSwarm
 		}
+		return err
 	}
-	return err
+	resp.Body.Close()
+	return nil
 }
 
 // LeaveSwarmOptions specify parameters to the LeaveSwarm function.
@@ -89,18 +99,29 @@ type LeaveSwarmOptions struct {
 // LeaveSwarm leaves a Swarm.
 // See https://goo.gl/UWDlLg for more details.
 func (c *Client) LeaveSwarm(opts LeaveSwarmOptions) error {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return err
+	}
+	if opts.Force {
+		if _, err := c.guard(opts.Context, "LeaveSwarm", "swarm", ""); err != nil {
+			return err
+		}
+	}
 	params := make(url.Values)
 	params.Set("force", strconv.FormatBool(opts.Force))
 	path := "/swarm/leave?" + params.Encode()
-	_, err := c.do("POST", path, doOptions{
-		context: opts.Context,
+	resp, err := c.do("POST", path, doOptions{
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotAcceptable {
 			return ErrNodeNotInSwarm
 		}
+		return err
 	}
-	return err
+	resp.Body.Close()
+	return nil
 }
 
 // UpdateSwarmOptions specify parameters to the UpdateSwarm function.
@@ -116,27 +137,36 @@ type UpdateSwarmOptions struct {
 // UpdateSwarm updates a Swarm.
 // See https://goo.gl/vFbq36 for more details.
 func (c *Client) UpdateSwarm(opts UpdateSwarmOptions) error {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return err
+	}
 	params := make(url.Values)
 	params.Set("version", strconv.Itoa(opts.Version))
 	params.Set("rotateWorkerToken", strconv.FormatBool(opts.RotateWorkerToken))
 	params.Set("rotateManagerToken", strconv.FormatBool(opts.RotateManagerToken))
 	path := "/swarm/update?" + params.Encode()
-	_, err := c.do("POST", path, doOptions{
-		data:      opts.Swarm,
-		forceJSON: true,
-		context:   opts.Context,
+	resp, err := c.do("POST", path, doOptions{
+		data:        opts.Swarm,
+		forceJSON:   true,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotAcceptable {
 			return ErrNodeNotInSwarm
 		}
+		return err
 	}
-	return err
+	resp.Body.Close()
+	return nil
 }
 
 // InspectSwarm inspects a Swarm.
 // See http://goo.gl/nvwytL for more details.
 func (c *Client) InspectSwarm(ctx context.Context) (swarm.Swarm, error) {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return swarm.Swarm{}, err
+	}
 	response := swarm.Swarm{}
 	resp, err := c.do("GET", "/swarm", doOptions{
 		context: ctx,
@@ -0,0 +1,128 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// DiskUsage is the space used by the images, containers and volumes of the
+// daemon.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/SystemDataUsage for more details.
+type DiskUsage struct {
+	// LayersSize is the size of all the image layers, counting the layers
+	// shared by several images once.
+	LayersSize int64
+
+	// Images report their SharedSize and the number of Containers using
+	// them, containers their SizeRw and SizeRootFs, and volumes their
+	// UsageData.
+	Images     []APIImages
+	Containers []APIContainers
+	Volumes    []Volume
+}
+
+// DiskUsageSummary summarizes the space used by a category of resources in a
+// DiskUsage.
+type DiskUsageSummary struct {
+	// Total is the number of resources, and Active the number of resources
+	// in use: images used by a container, running containers and volumes
+	// referenced by a container.
+	Total  int
+	Active int
+
+	// Size is the space used by the resources, and Reclaimable the space
+	// that removing the resources not in use would free.
+	Size        int64
+	Reclaimable int64
+}
+
+// ImagesSummary summarizes the space used by the images. Layers shared with
+// an image in use aren't reclaimable.
+func (du *DiskUsage) ImagesSummary() DiskUsageSummary {
+	summary := DiskUsageSummary{Total: len(du.Images), Size: du.LayersSize}
+	var used int64
+	for _, image := range du.Images {
+		if image.Containers <= 0 {
+			continue
+		}
+		summary.Active++
+		if image.SharedSize >= 0 {
+			used += image.Size - image.SharedSize
+		}
+	}
+	summary.Reclaimable = summary.Size - used
+	if summary.Reclaimable < 0 {
+		summary.Reclaimable = 0
+	}
+	return summary
+}
+
+// ContainersSummary summarizes the space used by the writable layers of the
+// containers. The layers of the containers that are not running are
+// reclaimable.
+func (du *DiskUsage) ContainersSummary() DiskUsageSummary {
+	summary := DiskUsageSummary{Total: len(du.Containers)}
+	for _, container := range du.Containers {
+		summary.Size += container.SizeRw
+		if container.State == "running" || container.State == "paused" || container.State == "restarting" {
+			summary.Active++
+		} else {
+			summary.Reclaimable += container.SizeRw
+		}
+	}
+	return summary
+}
+
+// VolumesSummary summarizes the space used by the volumes. The volumes not
+// referenced by any container are reclaimable.
+func (du *DiskUsage) VolumesSummary() DiskUsageSummary {
+	summary := DiskUsageSummary{Total: len(du.Volumes)}
+	for _, volume := range du.Volumes {
+		if volume.UsageData == nil {
+			continue
+		}
+		var size int64
+		if volume.UsageData.Size > 0 {
+			size = volume.UsageData.Size
+		}
+		summary.Size += size
+		if volume.UsageData.RefCount > 0 {
+			summary.Active++
+		} else {
+			summary.Reclaimable += size
+		}
+	}
+	return summary
+}
+
+// DiskUsage returns the space used by the images, containers and volumes of
+// the daemon.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/SystemDataUsage for more details.
+func (c *Client) DiskUsage() (*DiskUsage, error) {
+	return c.DiskUsageWithContext(context.Background())
+}
+
+// DiskUsageWithContext returns the space used by the images, containers and
+// volumes of the daemon. The context can be used to cancel the request, which
+// may take a while on hosts with many resources.
+func (c *Client) DiskUsageWithContext(ctx context.Context) (*DiskUsage, error) {
+	if err := c.requireFeature(FeatureDiskUsage); err != nil {
+		return nil, err
+	}
+	resp, err := c.do("GET", "/system/df", doOptions{context: ctx})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var usage DiskUsage
+	if err := json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
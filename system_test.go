@@ -0,0 +1,69 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestDiskUsage(t *testing.T) {
+	body := `{
+	"LayersSize": 1092588,
+	"Images": [
+		{"Id": "sha256:2b8fd9751c4c", "RepoTags": ["busybox:latest"], "Size": 1092588, "SharedSize": 0, "VirtualSize": 1092588, "Containers": 1},
+		{"Id": "sha256:1c2e9a4f3d5e", "RepoTags": ["busybox:debug"], "Size": 1192588, "SharedSize": 1092588, "VirtualSize": 1192588, "Containers": 0}
+	],
+	"Containers": [
+		{"Id": "e575172ed11d", "Names": ["/top"], "Image": "busybox", "ImageID": "sha256:2b8fd9751c4c", "State": "running", "SizeRw": 100, "SizeRootFs": 1092688},
+		{"Id": "a0b1c2d3e4f5", "Names": ["/old"], "Image": "busybox", "ImageID": "sha256:2b8fd9751c4c", "State": "exited", "SizeRw": 30, "SizeRootFs": 1092618}
+	],
+	"Volumes": [
+		{"Name": "data", "Driver": "local", "UsageData": {"Size": 4096, "RefCount": 1}},
+		{"Name": "cache", "Driver": "local", "UsageData": {"Size": 512, "RefCount": 0}},
+		{"Name": "remote", "Driver": "nfs", "UsageData": {"Size": -1, "RefCount": -1}}
+	]
+}`
+	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	usage, err := client.DiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := fakeRT.requests[0]
+	expectedURL, _ := url.Parse(client.getURL("/system/df"))
+	if req.Method != "GET" || req.URL.Path != expectedURL.Path {
+		t.Errorf("DiskUsage: wrong request. Want GET %s. Got %s %s.", expectedURL.Path, req.Method, req.URL.Path)
+	}
+	if len(usage.Images) != 2 || len(usage.Containers) != 2 || len(usage.Volumes) != 3 {
+		t.Fatalf("DiskUsage: wrong usage. Got %#v.", usage)
+	}
+	if size := usage.Images[1].UniqueSize(); size != 100000 {
+		t.Errorf("UniqueSize: wrong size. Want 100000. Got %d.", size)
+	}
+	if usage.Containers[0].SizeRw != 100 || usage.Containers[0].SizeRootFs != 1092688 {
+		t.Errorf("DiskUsage: wrong container sizes. Got %#v.", usage.Containers[0])
+	}
+	expectedData := &VolumeUsageData{Size: 4096, RefCount: 1}
+	if !reflect.DeepEqual(usage.Volumes[0].UsageData, expectedData) {
+		t.Errorf("DiskUsage: wrong volume usage. Want %#v. Got %#v.", expectedData, usage.Volumes[0].UsageData)
+	}
+	var tests = []struct {
+		name     string
+		summary  DiskUsageSummary
+		expected DiskUsageSummary
+	}{
+		{"ImagesSummary", usage.ImagesSummary(), DiskUsageSummary{Total: 2, Active: 1, Size: 1092588, Reclaimable: 0}},
+		{"ContainersSummary", usage.ContainersSummary(), DiskUsageSummary{Total: 2, Active: 1, Size: 130, Reclaimable: 30}},
+		{"VolumesSummary", usage.VolumesSummary(), DiskUsageSummary{Total: 3, Active: 1, Size: 4608, Reclaimable: 512}},
+	}
+	for _, tt := range tests {
+		if tt.summary != tt.expected {
+			t.Errorf("%s: wrong summary. Want %#v. Got %#v.", tt.name, tt.expected, tt.summary)
+		}
+	}
+}
@@ -5,11 +5,11 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
 	"github.com/docker/engine-api/types/swarm"
-	"golang.org/x/net/context"
 )
 
 // NoSuchTask is the error returned when a given task does not exist.
@@ -37,6 +37,9 @@ type ListTasksOptions struct {
 //
 // See http://goo.gl/rByLzw for more details.
 func (c *Client) ListTasks(opts ListTasksOptions) ([]swarm.Task, error) {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return nil, err
+	}
 	path := "/tasks?" + queryString(opts)
 	resp, err := c.do("GET", path, doOptions{context: opts.Context})
 	if err != nil {
@@ -54,7 +57,16 @@ func (c *Client) ListTasks(opts ListTasksOptions) ([]swarm.Task, error) {
 //
 // See http://goo.gl/kyziuq for more details.
 func (c *Client) InspectTask(id string) (*swarm.Task, error) {
-	resp, err := c.do("GET", "/tasks/"+id, doOptions{})
+	return c.InspectTaskWithContext(context.Background(), id)
+}
+
+// InspectTaskWithContext returns information about a task by its ID. The
+// context can be used to cancel the request.
+func (c *Client) InspectTaskWithContext(ctx context.Context, id string) (*swarm.Task, error) {
+	if err := c.requireFeature(FeatureSwarm); err != nil {
+		return nil, err
+	}
+	resp, err := c.do("GET", "/tasks/"+id, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchTask{ID: id}
@@ -20,6 +20,7 @@ import (
 	"net"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -154,6 +155,7 @@ func (s *DockerServer) buildMuxer() {
 	s.mux.Path("/commit").Methods("POST").HandlerFunc(s.handlerWrapper(s.commitContainer))
 	s.mux.Path("/containers/json").Methods("GET").HandlerFunc(s.handlerWrapper(s.listContainers))
 	s.mux.Path("/containers/create").Methods("POST").HandlerFunc(s.handlerWrapper(s.createContainer))
+	s.mux.Path("/containers/prune").Methods("POST").HandlerFunc(s.handlerWrapper(s.pruneContainers))
 	s.mux.Path("/containers/{id:.*}/json").Methods("GET").HandlerFunc(s.handlerWrapper(s.inspectContainer))
 	s.mux.Path("/containers/{id:.*}/rename").Methods("POST").HandlerFunc(s.handlerWrapper(s.renameContainer))
 	s.mux.Path("/containers/{id:.*}/top").Methods("GET").HandlerFunc(s.handlerWrapper(s.topContainer))
@@ -174,6 +176,7 @@ func (s *DockerServer) buildMuxer() {
 	s.mux.Path("/images/create").Methods("POST").HandlerFunc(s.handlerWrapper(s.pullImage))
 	s.mux.Path("/build").Methods("POST").HandlerFunc(s.handlerWrapper(s.buildImage))
 	s.mux.Path("/images/json").Methods("GET").HandlerFunc(s.handlerWrapper(s.listImages))
+	s.mux.Path("/images/prune").Methods("POST").HandlerFunc(s.handlerWrapper(s.pruneImages))
 	s.mux.Path("/images/{id:.*}").Methods("DELETE").HandlerFunc(s.handlerWrapper(s.removeImage))
 	s.mux.Path("/images/{name:.*}/json").Methods("GET").HandlerFunc(s.handlerWrapper(s.inspectImage))
 	s.mux.Path("/images/{name:.*}/push").Methods("POST").HandlerFunc(s.handlerWrapper(s.pushImage))
@@ -185,12 +188,15 @@ func (s *DockerServer) buildMuxer() {
 	s.mux.Path("/networks").Methods("GET").HandlerFunc(s.handlerWrapper(s.listNetworks))
 	s.mux.Path("/networks/{id:.*}").Methods("GET").HandlerFunc(s.handlerWrapper(s.networkInfo))
 	s.mux.Path("/networks").Methods("POST").HandlerFunc(s.handlerWrapper(s.createNetwork))
+	s.mux.Path("/networks/prune").Methods("POST").HandlerFunc(s.handlerWrapper(s.pruneNetworks))
 	s.mux.Path("/volumes").Methods("GET").HandlerFunc(s.handlerWrapper(s.listVolumes))
 	s.mux.Path("/volumes/create").Methods("POST").HandlerFunc(s.handlerWrapper(s.createVolume))
+	s.mux.Path("/volumes/prune").Methods("POST").HandlerFunc(s.handlerWrapper(s.pruneVolumes))
 	s.mux.Path("/volumes/{name:.*}").Methods("GET").HandlerFunc(s.handlerWrapper(s.inspectVolume))
 	s.mux.Path("/volumes/{name:.*}").Methods("DELETE").HandlerFunc(s.handlerWrapper(s.removeVolume))
 	s.mux.Path("/info").Methods("GET").HandlerFunc(s.handlerWrapper(s.infoDocker))
 	s.mux.Path("/version").Methods("GET").HandlerFunc(s.handlerWrapper(s.versionDocker))
+	s.mux.Path("/system/df").Methods("GET").HandlerFunc(s.handlerWrapper(s.diskUsage))
 	s.mux.Path("/swarm/init").Methods("POST").HandlerFunc(s.handlerWrapper(s.swarmInit))
 	s.mux.Path("/swarm").Methods("GET").HandlerFunc(s.handlerWrapper(s.swarmInspect))
 	s.mux.Path("/swarm/join").Methods("POST").HandlerFunc(s.handlerWrapper(s.swarmJoin))
@@ -356,11 +362,13 @@ func (s *DockerServer) handlerWrapper(f func(http.ResponseWriter, *http.Request)
 
 func (s *DockerServer) listContainers(w http.ResponseWriter, r *http.Request) {
 	all := r.URL.Query().Get("all")
+	size := r.URL.Query().Get("size")
 	s.cMut.RLock()
+	s.iMut.RLock()
 	result := make([]docker.APIContainers, 0, len(s.containers))
 	for _, container := range s.containers {
 		if all == "1" || container.State.Running {
-			result = append(result, docker.APIContainers{
+			apiContainer := docker.APIContainers{
 				ID:      container.ID,
 				Image:   container.Image,
 				Command: fmt.Sprintf("%s %s", container.Path, strings.Join(container.Args, " ")),
@@ -368,9 +376,14 @@ func (s *DockerServer) listContainers(w http.ResponseWriter, r *http.Request) {
 				Status:  container.State.String(),
 				Ports:   container.NetworkSettings.PortMappingAPI(),
 				Names:   []string{fmt.Sprintf("/%s", container.Name)},
-			})
+			}
+			if size == "1" {
+				apiContainer.SizeRw, apiContainer.SizeRootFs = s.containerSize(container)
+			}
+			result = append(result, apiContainer)
 		}
 	}
+	s.iMut.RUnlock()
 	s.cMut.RUnlock()
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -571,7 +584,15 @@ func (s *DockerServer) uploadToContainer(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	path := r.URL.Query().Get("path")
+	// the extracted files count as changes of the container
+	var size int64
+	if r.Body != nil {
+		size, _ = io.Copy(ioutil.Discard, r.Body)
+	}
+	s.cMut.Lock()
+	container.SizeRw += size
 	s.uploadedFiles[id] = path
+	s.cMut.Unlock()
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -1201,6 +1222,7 @@ func (s *DockerServer) createNetwork(w http.ResponseWriter, r *http.Request) {
 		Name:   config.Name,
 		ID:     generatedID,
 		Driver: config.Driver,
+		Labels: config.Labels,
 	}
 	s.netMut.Lock()
 	s.networks = append(s.networks, &network)
@@ -1235,6 +1257,7 @@ func (s *DockerServer) createVolume(w http.ResponseWriter, r *http.Request) {
 	volume := &docker.Volume{
 		Name:   data.CreateVolumeOptions.Name,
 		Driver: data.CreateVolumeOptions.Driver,
+		Labels: data.CreateVolumeOptions.Labels,
 	}
 	// If the name is not specified, generate one.  Just using generateID for now
 	if len(volume.Name) == 0 {
@@ -1306,6 +1329,366 @@ func (s *DockerServer) removeVolume(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// pruneFilters are the filters of a prune request, selecting the resources to
+// remove among the unused ones.
+type pruneFilters struct {
+	until     time.Time
+	labels    []string
+	notLabels []string
+	dangling  bool
+}
+
+// parsePruneFilters parses the filters of the given prune request, accepting
+// only the given kinds of filter.
+func parsePruneFilters(r *http.Request, accepted ...string) (*pruneFilters, error) {
+	var values map[string][]string
+	if param := r.URL.Query().Get("filters"); param != "" {
+		if err := json.Unmarshal([]byte(param), &values); err != nil {
+			return nil, err
+		}
+	}
+	filters := pruneFilters{dangling: true}
+	for key, list := range values {
+		if !containsString(accepted, key) {
+			return nil, fmt.Errorf("Invalid filter %q", key)
+		}
+		for _, value := range list {
+			switch key {
+			case "until":
+				until, err := parseUntil(value)
+				if err != nil {
+					return nil, err
+				}
+				filters.until = until
+			case "label":
+				filters.labels = append(filters.labels, value)
+			case "label!":
+				filters.notLabels = append(filters.notLabels, value)
+			case "dangling":
+				dangling, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid filter 'dangling=%s'", value)
+				}
+				filters.dangling = dangling
+			}
+		}
+	}
+	return &filters, nil
+}
+
+// parseUntil parses the value of an until filter: a duration relative to
+// now, a unix timestamp or an RFC 3339 date.
+func parseUntil(value string) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	until, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid filter 'until=%s'", value)
+	}
+	return until, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// match indicates whether a resource created at the given time and with the
+// given labels is selected by the filters.
+func (f *pruneFilters) match(created time.Time, labels map[string]string) bool {
+	if !f.until.IsZero() && !created.Before(f.until) {
+		return false
+	}
+	for _, label := range f.labels {
+		if !hasLabel(labels, label) {
+			return false
+		}
+	}
+	for _, label := range f.notLabels {
+		if hasLabel(labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasLabel indicates whether the labels include the given one, either "key"
+// or "key=value".
+func hasLabel(labels map[string]string, label string) bool {
+	parts := strings.SplitN(label, "=", 2)
+	value, ok := labels[parts[0]]
+	if len(parts) == 1 {
+		return ok
+	}
+	return ok && value == parts[1]
+}
+
+func (s *DockerServer) pruneContainers(w http.ResponseWriter, r *http.Request) {
+	filters, err := parsePruneFilters(r, "until", "label", "label!")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var results docker.PruneContainersResults
+	s.cMut.Lock()
+	remaining := make([]*docker.Container, 0, len(s.containers))
+	for _, container := range s.containers {
+		var labels map[string]string
+		if container.Config != nil {
+			labels = container.Config.Labels
+		}
+		if container.State.Running || !filters.match(container.Created, labels) {
+			remaining = append(remaining, container)
+			continue
+		}
+		results.ContainersDeleted = append(results.ContainersDeleted, container.ID)
+	}
+	s.containers = remaining
+	s.cMut.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+func (s *DockerServer) pruneImages(w http.ResponseWriter, r *http.Request) {
+	filters, err := parsePruneFilters(r, "dangling", "until", "label", "label!")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var results docker.PruneImagesResults
+	s.cMut.RLock()
+	defer s.cMut.RUnlock()
+	s.iMut.Lock()
+	defer s.iMut.Unlock()
+	used := make(map[string]bool)
+	for _, container := range s.containers {
+		if id, ok := s.imgIDs[container.Image]; ok {
+			used[id] = true
+		} else {
+			used[container.Image] = true
+		}
+	}
+	tags := make(map[string][]string)
+	for tag, id := range s.imgIDs {
+		tags[id] = append(tags[id], tag)
+	}
+	remaining := make([]docker.Image, 0, len(s.images))
+	for _, image := range s.images {
+		var labels map[string]string
+		if image.Config != nil {
+			labels = image.Config.Labels
+		}
+		imageTags := tags[image.ID]
+		if used[image.ID] || (filters.dangling && len(imageTags) > 0) || !filters.match(image.Created, labels) {
+			remaining = append(remaining, image)
+			continue
+		}
+		sort.Strings(imageTags)
+		for _, tag := range imageTags {
+			delete(s.imgIDs, tag)
+			results.ImagesDeleted = append(results.ImagesDeleted, docker.PrunedImage{Untagged: tag})
+		}
+		results.ImagesDeleted = append(results.ImagesDeleted, docker.PrunedImage{Deleted: image.ID})
+		results.SpaceReclaimed += image.Size
+	}
+	s.images = remaining
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+func (s *DockerServer) pruneVolumes(w http.ResponseWriter, r *http.Request) {
+	filters, err := parsePruneFilters(r, "label", "label!")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var results docker.PruneVolumesResults
+	s.cMut.RLock()
+	defer s.cMut.RUnlock()
+	s.volMut.Lock()
+	defer s.volMut.Unlock()
+	used := make(map[string]bool)
+	for _, container := range s.containers {
+		for _, mount := range container.Mounts {
+			used[mount.Name] = true
+		}
+	}
+	for name, vol := range s.volStore {
+		// removed volumes are kept as nil entries
+		if vol == nil || vol.count != 0 || used[name] || !filters.match(time.Time{}, vol.volume.Labels) {
+			continue
+		}
+		delete(s.volStore, name)
+		results.VolumesDeleted = append(results.VolumesDeleted, name)
+	}
+	sort.Strings(results.VolumesDeleted)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+func (s *DockerServer) pruneNetworks(w http.ResponseWriter, r *http.Request) {
+	filters, err := parsePruneFilters(r, "label", "label!")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var results docker.PruneNetworksResults
+	s.cMut.RLock()
+	defer s.cMut.RUnlock()
+	s.netMut.Lock()
+	defer s.netMut.Unlock()
+	used := make(map[string]bool)
+	for _, container := range s.containers {
+		if container.HostConfig != nil {
+			used[container.HostConfig.NetworkMode] = true
+		}
+	}
+	remaining := make([]*docker.Network, 0, len(s.networks))
+	for _, network := range s.networks {
+		switch {
+		case network.Name == "bridge" || network.Name == "host" || network.Name == "none",
+			len(network.Containers) > 0, used[network.Name], used[network.ID],
+			!filters.match(time.Time{}, network.Labels):
+			remaining = append(remaining, network)
+		default:
+			results.NetworksDeleted = append(results.NetworksDeleted, network.ID)
+		}
+	}
+	s.networks = remaining
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+// resolveImageID returns the ID of the image with the given name or ID, or the
+// name itself if there's no such image. It must be called with iMut held.
+func (s *DockerServer) resolveImageID(name string) string {
+	if id, ok := s.imgIDs[name]; ok {
+		return id
+	}
+	return name
+}
+
+// imageSize returns the size of the image with the given ID, including the
+// layers of its parents, along with the size of these layers, which the image
+// shares with its parents. It must be called with iMut held.
+func (s *DockerServer) imageSize(id string) (size, shared int64) {
+	seen := make(map[string]bool)
+	for id != "" && !seen[id] {
+		seen[id] = true
+		var parent string
+		for _, image := range s.images {
+			if image.ID == id {
+				if len(seen) > 1 {
+					shared += image.Size
+				}
+				size += image.Size
+				parent = image.Parent
+				break
+			}
+		}
+		id = parent
+	}
+	return size, shared
+}
+
+// containerSize returns the size of the files changed by the container and
+// the total size of its files, including its image. It must be called with
+// cMut and iMut held.
+func (s *DockerServer) containerSize(container *docker.Container) (sizeRw, sizeRootFs int64) {
+	imageSize, _ := s.imageSize(s.resolveImageID(container.Image))
+	return container.SizeRw, container.SizeRw + imageSize
+}
+
+func (s *DockerServer) diskUsage(w http.ResponseWriter, r *http.Request) {
+	s.cMut.RLock()
+	defer s.cMut.RUnlock()
+	s.iMut.RLock()
+	defer s.iMut.RUnlock()
+	s.volMut.RLock()
+	defer s.volMut.RUnlock()
+	usage := docker.DiskUsage{
+		Images:     make([]docker.APIImages, 0, len(s.images)),
+		Containers: make([]docker.APIContainers, 0, len(s.containers)),
+		Volumes:    make([]docker.Volume, 0, len(s.volStore)),
+	}
+	imageContainers := make(map[string]int64)
+	volumeRefs := make(map[string]int64)
+	for _, container := range s.containers {
+		apiContainer := docker.APIContainers{
+			ID:      container.ID,
+			Image:   container.Image,
+			ImageID: s.resolveImageID(container.Image),
+			Command: fmt.Sprintf("%s %s", container.Path, strings.Join(container.Args, " ")),
+			Created: container.Created.Unix(),
+			State:   container.State.StateString(),
+			Status:  container.State.String(),
+			Names:   []string{fmt.Sprintf("/%s", container.Name)},
+		}
+		if container.Config != nil {
+			apiContainer.Labels = container.Config.Labels
+		}
+		apiContainer.SizeRw, apiContainer.SizeRootFs = s.containerSize(container)
+		usage.Containers = append(usage.Containers, apiContainer)
+		imageContainers[s.resolveImageID(container.Image)]++
+		for _, mount := range container.Mounts {
+			volumeRefs[mount.Name]++
+		}
+	}
+	for _, image := range s.images {
+		size, shared := s.imageSize(image.ID)
+		usage.LayersSize += image.Size
+		apiImage := docker.APIImages{
+			ID:          image.ID,
+			Created:     image.Created.Unix(),
+			Size:        size,
+			VirtualSize: size,
+			ParentID:    image.Parent,
+			SharedSize:  shared,
+			Containers:  imageContainers[image.ID],
+		}
+		if image.Config != nil {
+			apiImage.Labels = image.Config.Labels
+		}
+		for tag, id := range s.imgIDs {
+			if id == image.ID {
+				apiImage.RepoTags = append(apiImage.RepoTags, tag)
+			}
+		}
+		sort.Strings(apiImage.RepoTags)
+		usage.Images = append(usage.Images, apiImage)
+	}
+	names := make([]string, 0, len(s.volStore))
+	for name, vol := range s.volStore {
+		// removed volumes are kept as nil entries
+		if vol != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vol := s.volStore[name]
+		volume := vol.volume
+		// the fake volumes hold no data
+		volume.UsageData = &docker.VolumeUsageData{RefCount: int64(vol.count) + volumeRefs[name]}
+		usage.Volumes = append(usage.Volumes, volume)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(usage)
+}
+
 func (s *DockerServer) infoDocker(w http.ResponseWriter, r *http.Request) {
 	s.cMut.RLock()
 	defer s.cMut.RUnlock()
@@ -15,6 +15,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
 	"strings"
@@ -2460,3 +2461,191 @@ func TestNetworkCreate(t *testing.T) {
 		t.Fatal("NetworkCreate: network id can't be empty.")
 	}
 }
+
+func TestPruneContainers(t *testing.T) {
+	server := DockerServer{}
+	server.buildMuxer()
+	server.containers = []*docker.Container{
+		{ID: "running", Created: time.Now().Add(-2 * time.Hour), Config: &docker.Config{}, State: docker.State{Running: true}},
+		{ID: "old", Created: time.Now().Add(-2 * time.Hour), Config: &docker.Config{}},
+		{ID: "recent", Created: time.Now(), Config: &docker.Config{}},
+		{ID: "protected", Created: time.Now().Add(-2 * time.Hour), Config: &docker.Config{Labels: map[string]string{"keep": "yes"}}},
+	}
+	recorder := httptest.NewRecorder()
+	filters := url.QueryEscape(`{"until":["1h"],"label!":["keep"]}`)
+	request, _ := http.NewRequest("POST", "/containers/prune?filters="+filters, nil)
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("PruneContainers: wrong status. Want %d. Got %d.", http.StatusOK, recorder.Code)
+	}
+	var results docker.PruneContainersResults
+	json.NewDecoder(recorder.Body).Decode(&results)
+	expected := []string{"old"}
+	if !reflect.DeepEqual(results.ContainersDeleted, expected) {
+		t.Errorf("PruneContainers: wrong deleted containers. Want %#v. Got %#v.", expected, results.ContainersDeleted)
+	}
+	if len(server.containers) != 3 {
+		t.Errorf("PruneContainers: wrong number of remaining containers. Want 3. Got %d.", len(server.containers))
+	}
+}
+
+func TestPruneContainersInvalidFilter(t *testing.T) {
+	server := DockerServer{}
+	server.buildMuxer()
+	recorder := httptest.NewRecorder()
+	filters := url.QueryEscape(`{"dangling":["true"]}`)
+	request, _ := http.NewRequest("POST", "/containers/prune?filters="+filters, nil)
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("PruneContainers: wrong status. Want %d. Got %d.", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestPruneImages(t *testing.T) {
+	server := DockerServer{imgIDs: map[string]string{"busybox:latest": "busybox-id", "python:latest": "python-id", "used:latest": "used-id"}}
+	server.buildMuxer()
+	server.images = []docker.Image{
+		{ID: "dangling-id", Size: 10},
+		{ID: "busybox-id", Size: 100},
+		{ID: "python-id", Size: 1000, Config: &docker.Config{Labels: map[string]string{"keep": "yes"}}},
+		{ID: "used-id", Size: 10000},
+	}
+	server.containers = []*docker.Container{{ID: "c", Image: "used:latest"}}
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/images/prune", nil)
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("PruneImages: wrong status. Want %d. Got %d.", http.StatusOK, recorder.Code)
+	}
+	var results docker.PruneImagesResults
+	json.NewDecoder(recorder.Body).Decode(&results)
+	expected := docker.PruneImagesResults{
+		ImagesDeleted:  []docker.PrunedImage{{Deleted: "dangling-id"}},
+		SpaceReclaimed: 10,
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("PruneImages: wrong results. Want %#v. Got %#v.", expected, results)
+	}
+	recorder = httptest.NewRecorder()
+	filters := url.QueryEscape(`{"dangling":["false"],"label!":["keep=yes"]}`)
+	request, _ = http.NewRequest("POST", "/images/prune?filters="+filters, nil)
+	server.ServeHTTP(recorder, request)
+	results = docker.PruneImagesResults{}
+	json.NewDecoder(recorder.Body).Decode(&results)
+	expected = docker.PruneImagesResults{
+		ImagesDeleted:  []docker.PrunedImage{{Untagged: "busybox:latest"}, {Deleted: "busybox-id"}},
+		SpaceReclaimed: 100,
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("PruneImages: wrong results. Want %#v. Got %#v.", expected, results)
+	}
+	if _, ok := server.imgIDs["busybox:latest"]; ok {
+		t.Error("PruneImages: did not remove the tag of the image.")
+	}
+	if len(server.images) != 2 {
+		t.Errorf("PruneImages: wrong number of remaining images. Want 2. Got %d.", len(server.images))
+	}
+}
+
+func TestPruneVolumes(t *testing.T) {
+	server := DockerServer{}
+	server.buildMuxer()
+	server.volStore = map[string]*volumeCounter{
+		"unused":  {volume: docker.Volume{Name: "unused"}},
+		"mounted": {volume: docker.Volume{Name: "mounted"}},
+		"removed": nil,
+	}
+	server.containers = []*docker.Container{{ID: "c", Mounts: []docker.Mount{{Name: "mounted"}}}}
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/volumes/prune", nil)
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("PruneVolumes: wrong status. Want %d. Got %d.", http.StatusOK, recorder.Code)
+	}
+	var results docker.PruneVolumesResults
+	json.NewDecoder(recorder.Body).Decode(&results)
+	expected := []string{"unused"}
+	if !reflect.DeepEqual(results.VolumesDeleted, expected) {
+		t.Errorf("PruneVolumes: wrong deleted volumes. Want %#v. Got %#v.", expected, results.VolumesDeleted)
+	}
+	if _, ok := server.volStore["unused"]; ok {
+		t.Error("PruneVolumes: did not remove the volume.")
+	}
+}
+
+func TestPruneNetworks(t *testing.T) {
+	server := DockerServer{}
+	server.buildMuxer()
+	server.networks = []*docker.Network{
+		{ID: "bridge-id", Name: "bridge"},
+		{ID: "unused-id", Name: "unused"},
+		{ID: "connected-id", Name: "connected", Containers: map[string]docker.Endpoint{"c": {}}},
+		{ID: "labeled-id", Name: "labeled", Labels: map[string]string{"env": "prod"}},
+	}
+	recorder := httptest.NewRecorder()
+	filters := url.QueryEscape(`{"label!":["env=prod"]}`)
+	request, _ := http.NewRequest("POST", "/networks/prune?filters="+filters, nil)
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("PruneNetworks: wrong status. Want %d. Got %d.", http.StatusOK, recorder.Code)
+	}
+	var results docker.PruneNetworksResults
+	json.NewDecoder(recorder.Body).Decode(&results)
+	expected := []string{"unused-id"}
+	if !reflect.DeepEqual(results.NetworksDeleted, expected) {
+		t.Errorf("PruneNetworks: wrong deleted networks. Want %#v. Got %#v.", expected, results.NetworksDeleted)
+	}
+	if len(server.networks) != 3 {
+		t.Errorf("PruneNetworks: wrong number of remaining networks. Want 3. Got %d.", len(server.networks))
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	server := DockerServer{imgIDs: map[string]string{"app:latest": "app-id"}, uploadedFiles: make(map[string]string)}
+	server.buildMuxer()
+	server.images = []docker.Image{
+		{ID: "base-id", Size: 100},
+		{ID: "app-id", Parent: "base-id", Size: 20},
+	}
+	server.containers = []*docker.Container{
+		{ID: "web", Image: "app:latest", State: docker.State{Running: true}, Mounts: []docker.Mount{{Name: "data"}}},
+		{ID: "old", Image: "base-id"},
+	}
+	server.volStore = map[string]*volumeCounter{
+		"data":  {volume: docker.Volume{Name: "data"}},
+		"cache": {volume: docker.Volume{Name: "cache"}},
+	}
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("PUT", "/containers/web/archive?path=/srv", strings.NewReader("0123456789"))
+	server.ServeHTTP(recorder, request)
+	recorder = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/system/df", nil)
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("DiskUsage: wrong status. Want %d. Got %d.", http.StatusOK, recorder.Code)
+	}
+	var usage docker.DiskUsage
+	json.NewDecoder(recorder.Body).Decode(&usage)
+	if usage.LayersSize != 120 {
+		t.Errorf("DiskUsage: wrong layers size. Want 120. Got %d.", usage.LayersSize)
+	}
+	app := usage.Images[1]
+	if app.Size != 120 || app.SharedSize != 100 || app.Containers != 1 || !reflect.DeepEqual(app.RepoTags, []string{"app:latest"}) {
+		t.Errorf("DiskUsage: wrong image usage. Got %#v.", app)
+	}
+	web := usage.Containers[0]
+	if web.ImageID != "app-id" || web.State != "running" || web.SizeRw != 10 || web.SizeRootFs != 130 {
+		t.Errorf("DiskUsage: wrong container usage. Got %#v.", web)
+	}
+	expectedVolumes := []docker.Volume{
+		{Name: "cache", UsageData: &docker.VolumeUsageData{}},
+		{Name: "data", UsageData: &docker.VolumeUsageData{RefCount: 1}},
+	}
+	if !reflect.DeepEqual(usage.Volumes, expectedVolumes) {
+		t.Errorf("DiskUsage: wrong volumes. Want %#v. Got %#v.", expectedVolumes, usage.Volumes)
+	}
+	expected := docker.DiskUsageSummary{Total: 2, Active: 2, Size: 120, Reclaimable: 0}
+	if summary := usage.ImagesSummary(); summary != expected {
+		t.Errorf("ImagesSummary: wrong summary. Want %#v. Got %#v.", expected, summary)
+	}
+}
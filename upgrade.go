@@ -0,0 +1,227 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// tlsConn holds both the TLS connection and the raw connection beneath it,
+// as the standard tls.Conn can't shut down the writing side of the raw
+// connection.
+type tlsConn struct {
+	*tls.Conn
+	raw net.Conn
+}
+
+func (c *tlsConn) CloseWrite() error {
+	if cw, ok := c.raw.(interface {
+		CloseWrite() error
+	}); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// upgrade sends the given request on a new connection, asking the daemon to
+// upgrade it to a raw stream. It returns the connection once the daemon
+// accepts it with either 101 Switching Protocols or 200 OK (older daemons),
+// and an *Error for any other status.
+//
+// The connection is established with the settings of the HTTP transport of
+// the client: its dialer, proxy and TLS configuration.
+func (c *Client) upgrade(ctx context.Context, req *http.Request) (*HijackedConn, error) {
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	var conn net.Conn
+	var br *bufio.Reader
+	resp, err := c.roundTrip(req, func(req *http.Request) (*http.Response, error) {
+		var err error
+		conn, err = c.dialUpgrade(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		stop := closeOnDone(ctx, conn)
+		defer stop()
+		if err := req.Write(conn); err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(conn)
+		return http.ReadResponse(br, req)
+	})
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		if strings.Contains(err.Error(), "connection refused") {
+			return nil, ErrConnectionRefused
+		}
+		return nil, chooseError(ctx, err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		if conn != nil {
+			defer conn.Close()
+		}
+		return nil, newError(resp)
+	}
+	if conn == nil {
+		return nil, fmt.Errorf("cannot take over the connection of a %d response that wasn't read from the daemon", resp.StatusCode)
+	}
+	return &HijackedConn{Conn: conn, Reader: br}, nil
+}
+
+// closeOnDone closes the connection if the context is done before the
+// returned function is called.
+func closeOnDone(ctx context.Context, conn net.Conn) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// dialUpgrade opens the connection for an upgrade request, using the dialer,
+// proxy and TLS settings of the client's transport.
+func (c *Client) dialUpgrade(ctx context.Context, req *http.Request) (net.Conn, error) {
+	if c.socketEndpoint() {
+		return c.dial()
+	}
+	tr, _ := c.HTTPClient.Transport.(*http.Transport)
+	if tr == nil && c.HTTPClient.Transport == nil {
+		tr, _ = http.DefaultTransport.(*http.Transport)
+	}
+	dial := c.Dialer.DialContext
+	tlsConfig := c.TLSConfig
+	var handshakeTimeout time.Duration
+	var proxyURL *url.URL
+	if tr != nil {
+		if tr.DialContext != nil {
+			dial = tr.DialContext
+		} else if tr.Dial != nil {
+			dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return tr.Dial(network, addr)
+			}
+		}
+		if tr.TLSClientConfig != nil {
+			tlsConfig = tr.TLSClientConfig
+		}
+		handshakeTimeout = tr.TLSHandshakeTimeout
+		if tr.Proxy != nil {
+			var err error
+			proxyURL, err = tr.Proxy(req)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	addr := canonicalAddr(req.URL)
+	var conn net.Conn
+	var err error
+	if proxyURL != nil {
+		conn, err = dialProxy(ctx, dial, proxyURL, addr)
+	} else {
+		conn, err = dial(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "https" {
+		return conn, nil
+	}
+	config := &tls.Config{}
+	if tlsConfig != nil {
+		config = copyTLSConfig(tlsConfig)
+	}
+	if config.ServerName == "" {
+		config.ServerName, _ = splitURLHost(req.URL)
+	}
+	tlsClient := tls.Client(conn, config)
+	if handshakeTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	}
+	stop := closeOnDone(ctx, conn)
+	err = tlsClient.Handshake()
+	stop()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return &tlsConn{Conn: tlsClient, raw: conn}, nil
+}
+
+// dialProxy opens a tunnel to the given address through an HTTP proxy.
+func dialProxy(ctx context.Context, dial func(context.Context, string, string) (net.Conn, error), proxyURL *url.URL, addr string) (net.Conn, error) {
+	if proxyURL.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported proxy scheme %q for upgraded connections", proxyURL.Scheme)
+	}
+	conn, err := dial(ctx, "tcp", canonicalAddr(proxyURL))
+	if err != nil {
+		return nil, err
+	}
+	connectReq := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+	if err := connectReq.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused connection to %s: %s", addr, resp.Status)
+	}
+	return conn, nil
+}
+
+// canonicalAddr returns the host:port address of the given URL, using the
+// default port of its scheme when it has none.
+func canonicalAddr(u *url.URL) string {
+	host, port := splitURLHost(u)
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// splitURLHost returns the host of the given URL without the brackets of IPv6
+// addresses, and its port, if any.
+func splitURLHost(u *url.URL) (string, string) {
+	if host, port, err := net.SplitHostPort(u.Host); err == nil {
+		return host, port
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(u.Host, "["), "]"), ""
+}
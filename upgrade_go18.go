@@ -0,0 +1,15 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.8
+// +build go1.8
+
+package docker
+
+import "crypto/tls"
+
+// copyTLSConfig returns a copy of the given TLS configuration.
+func copyTLSConfig(cfg *tls.Config) *tls.Config {
+	return cfg.Clone()
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.8
+// +build go1.8
+
+package docker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAttachToContainerUpgradeVerifyPeerCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("AttachToContainer: unexpected request to the server")
+	}))
+	defer server.Close()
+	errRejected := errors.New("peer certificate rejected")
+	var verifications int32
+	client, err := NewClientWithOptions(
+		WithHost(server.URL),
+		WithTLSConfig(&tls.Config{
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func([][]byte, [][]*x509.Certificate) error {
+				atomic.AddInt32(&verifications, 1)
+				return errRejected
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.AttachToContainer(AttachToContainerOptions{
+		Container:   "a123456",
+		InputStream: strings.NewReader("echo"),
+		Stdin:       true,
+		Stream:      true,
+		RawTerminal: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), errRejected.Error()) {
+		t.Errorf("AttachToContainer: wrong error. Want %q. Got %#v.", errRejected, err)
+	}
+	if n := atomic.LoadInt32(&verifications); n != 1 {
+		t.Errorf("AttachToContainer: wrong number of verifications. Want 1. Got %d.", n)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2016 go-dockerclient authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// upgradeEchoHandler upgrades the connection and echoes the input back
+// until the client closes its writing side.
+func upgradeEchoHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "tcp" || r.Header.Get("Connection") != "Upgrade" {
+			t.Errorf("upgrade: missing upgrade headers: %#v", r.Header)
+		}
+		ioutil.ReadAll(r.Body)
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		rw.Flush()
+		io.Copy(conn, rw)
+	}
+}
+
+func TestAttachToContainerUpgrade(t *testing.T) {
+	server := httptest.NewServer(upgradeEchoHandler(t))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	err = client.AttachToContainer(AttachToContainerOptions{
+		Container:    "a123456",
+		InputStream:  strings.NewReader("echo"),
+		OutputStream: &stdout,
+		Stdin:        true,
+		Stdout:       true,
+		Stream:       true,
+		RawTerminal:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "echo" {
+		t.Errorf("AttachToContainer: wrong output. Want %q. Got %q.", "echo", stdout.String())
+	}
+}
+
+func TestAttachToContainerUpgradeTLS(t *testing.T) {
+	server := httptest.NewTLSServer(upgradeEchoHandler(t))
+	defer server.Close()
+	client, err := NewClientWithOptions(
+		WithHost(server.URL),
+		WithTLSConfig(&tls.Config{InsecureSkipVerify: true}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	err = client.AttachToContainer(AttachToContainerOptions{
+		Container:    "a123456",
+		InputStream:  strings.NewReader("echo over tls"),
+		OutputStream: &stdout,
+		Stdin:        true,
+		Stdout:       true,
+		Stream:       true,
+		RawTerminal:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "echo over tls" {
+		t.Errorf("AttachToContainer: wrong output. Want %q. Got %q.", "echo over tls", stdout.String())
+	}
+}
+
+func TestAttachToContainerUpgradeProxy(t *testing.T) {
+	server := httptest.NewServer(upgradeEchoHandler(t))
+	defer server.Close()
+	var tunnels int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		atomic.AddInt32(&tunnels, 1)
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+		rw.Flush()
+		go func() {
+			io.Copy(upstream, rw)
+			upstream.(*net.TCPConn).CloseWrite()
+		}()
+		io.Copy(conn, upstream)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	client, err := NewClientWithOptions(
+		WithHost(server.URL),
+		WithHTTPClient(&http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	err = client.AttachToContainer(AttachToContainerOptions{
+		Container:    "a123456",
+		InputStream:  strings.NewReader("echo through proxy"),
+		OutputStream: &stdout,
+		Stdin:        true,
+		Stdout:       true,
+		Stream:       true,
+		RawTerminal:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "echo through proxy" {
+		t.Errorf("AttachToContainer: wrong output. Want %q. Got %q.", "echo through proxy", stdout.String())
+	}
+	if n := atomic.LoadInt32(&tunnels); n != 1 {
+		t.Errorf("AttachToContainer: wrong number of tunnels. Want 1. Got %d.", n)
+	}
+}
+
+func TestAttachToContainerUpgradeNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"No such container: a123456"}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.AttachToContainer(AttachToContainerOptions{Container: "a123456", Stdout: true, OutputStream: ioutil.Discard})
+	expected := &NoSuchContainer{ID: "a123456"}
+	if e, ok := err.(*NoSuchContainer); !ok || e.ID != expected.ID {
+		t.Errorf("AttachToContainer: wrong error. Want %#v. Got %#v.", expected, err)
+	}
+	err = client.StartExec("e123456", StartExecOptions{OutputStream: ioutil.Discard})
+	if e, ok := err.(*NoSuchExec); !ok || e.ID != "e123456" {
+		t.Errorf("StartExec: wrong error. Want %#v. Got %#v.", &NoSuchExec{ID: "e123456"}, err)
+	}
+}
+
+func TestAttachToContainerUpgradeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"message":"container a123456 is paused"}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.AttachToContainer(AttachToContainerOptions{Container: "a123456", Stdout: true, OutputStream: ioutil.Discard})
+	e, ok := err.(*Error)
+	if !ok || e.Status != http.StatusConflict || e.Message != "container a123456 is paused" {
+		t.Errorf("AttachToContainer: wrong error. Want 409 *Error. Got %#v.", err)
+	}
+}
+
+func TestUpgradedConnKeepsBufferedData(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		bufio.NewReader(server).ReadString('\n')
+		server.Write([]byte("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\nraw data"))
+		server.Close()
+	}()
+	client.Write([]byte("request\n"))
+	br := bufio.NewReader(client)
+	req, _ := http.NewRequest("POST", "http://localhost/attach", nil)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("wrong status. Want 101. Got %d.", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(&HijackedConn{Conn: client, Reader: br})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "raw data" {
+		t.Errorf("HijackedConn: wrong data. Want %q. Got %q.", "raw data", string(data))
+	}
+}
+
+func TestCanonicalAddr(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected string
+	}{
+		{"http://localhost:2375", "localhost:2375"},
+		{"http://localhost", "localhost:80"},
+		{"https://localhost", "localhost:443"},
+		{"https://[::1]", "[::1]:443"},
+		{"http://[::1]:2375", "[::1]:2375"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr := canonicalAddr(u); addr != tt.expected {
+			t.Errorf("canonicalAddr(%q): Want %q. Got %q.", tt.input, tt.expected, addr)
+		}
+	}
+}
@@ -5,11 +5,10 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
-
-	"golang.org/x/net/context"
 )
 
 var (
@@ -28,6 +27,17 @@ type Volume struct {
 	Driver     string            `json:"Driver,omitempty" yaml:"Driver,omitempty"`
 	Mountpoint string            `json:"Mountpoint,omitempty" yaml:"Mountpoint,omitempty"`
 	Labels     map[string]string `json:"Labels,omitempty" yaml:"Labels,omitempty"`
+	UsageData  *VolumeUsageData  `json:"UsageData,omitempty" yaml:"UsageData,omitempty"`
+}
+
+// VolumeUsageData is the usage of a volume, reported only by DiskUsage. The
+// fields are -1 when the daemon didn't compute them.
+type VolumeUsageData struct {
+	// Size is the space used by the volume on disk.
+	Size int64 `json:"Size" yaml:"Size"`
+
+	// RefCount is the number of containers referencing the volume.
+	RefCount int64 `json:"RefCount" yaml:"RefCount"`
 }
 
 // ListVolumesOptions specify parameters to the ListVolumes function.
@@ -42,6 +52,11 @@ type ListVolumesOptions struct {
 //
 // See https://goo.gl/FZA4BK for more details.
 func (c *Client) ListVolumes(opts ListVolumesOptions) ([]Volume, error) {
+	if len(opts.Filters) > 0 {
+		if err := c.requireFeature(FeatureVolumeFilters); err != nil {
+			return nil, err
+		}
+	}
 	resp, err := c.do("GET", "/volumes?"+queryString(opts), doOptions{
 		context: opts.Context,
 	})
@@ -75,6 +90,7 @@ type CreateVolumeOptions struct {
 	Name       string
 	Driver     string
 	DriverOpts map[string]string
+	Labels     map[string]string
 	Context    context.Context `json:"-"`
 }
 
@@ -83,8 +99,9 @@ type CreateVolumeOptions struct {
 // See https://goo.gl/pBUbZ9 for more details.
 func (c *Client) CreateVolume(opts CreateVolumeOptions) (*Volume, error) {
 	resp, err := c.do("POST", "/volumes/create", doOptions{
-		data:    opts,
-		context: opts.Context,
+		data:        opts,
+		context:     opts.Context,
+		callOptions: opts,
 	})
 	if err != nil {
 		return nil, err
@@ -101,7 +118,13 @@ func (c *Client) CreateVolume(opts CreateVolumeOptions) (*Volume, error) {
 //
 // See https://goo.gl/0g9A6i for more details.
 func (c *Client) InspectVolume(name string) (*Volume, error) {
-	resp, err := c.do("GET", "/volumes/"+name, doOptions{})
+	return c.InspectVolumeWithContext(context.Background(), name)
+}
+
+// InspectVolumeWithContext returns a volume by its name. The context can be
+// used to cancel the request.
+func (c *Client) InspectVolumeWithContext(ctx context.Context, name string) (*Volume, error) {
+	resp, err := c.do("GET", "/volumes/"+name, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, ErrNoSuchVolume
@@ -120,7 +143,16 @@ func (c *Client) InspectVolume(name string) (*Volume, error) {
 //
 // See https://goo.gl/79GNQz for more details.
 func (c *Client) RemoveVolume(name string) error {
-	resp, err := c.do("DELETE", "/volumes/"+name, doOptions{})
+	return c.RemoveVolumeWithContext(context.Background(), name)
+}
+
+// RemoveVolumeWithContext removes a volume by its name. The context can be used
+// to cancel the request.
+func (c *Client) RemoveVolumeWithContext(ctx context.Context, name string) error {
+	if _, err := c.guard(ctx, "RemoveVolume", "volume", name); err != nil {
+		return err
+	}
+	resp, err := c.do("DELETE", "/volumes/"+name, doOptions{context: ctx})
 	if err != nil {
 		if e, ok := err.(*Error); ok {
 			if e.Status == http.StatusNotFound {
@@ -130,8 +162,44 @@ func (c *Client) RemoveVolume(name string) error {
 				return ErrVolumeInUse
 			}
 		}
-		return nil
+		return err
 	}
 	defer resp.Body.Close()
 	return nil
 }
+
+// PruneVolumesOptions specify parameters to the PruneVolumes function.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/VolumePrune for more details.
+type PruneVolumesOptions struct {
+	Filters map[string][]string
+	Context context.Context
+}
+
+// PruneVolumesResults specify results from the PruneVolumes function.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/VolumePrune for more details.
+type PruneVolumesResults struct {
+	VolumesDeleted []string
+	SpaceReclaimed int64
+}
+
+// PruneVolumes deletes volumes which are not used by any container.
+//
+// See https://docs.docker.com/engine/api/v1.25/#operation/VolumePrune for more details.
+func (c *Client) PruneVolumes(opts PruneVolumesOptions) (*PruneVolumesResults, error) {
+	if err := c.requireFeature(FeaturePrune); err != nil {
+		return nil, err
+	}
+	path := "/volumes/prune?" + queryString(opts)
+	resp, err := c.do("POST", path, doOptions{context: opts.Context, callOptions: opts})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var results PruneVolumesResults
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
@@ -140,3 +140,22 @@ func TestRemoveVolumeInUse(t *testing.T) {
 		t.Errorf("RemoveVolume: wrong error. Want %#v. Got %#v.", ErrVolumeInUse, err)
 	}
 }
+
+func TestPruneVolumes(t *testing.T) {
+	body := `{"VolumesDeleted":["tardis","foo"],"SpaceReclaimed":4096}`
+	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	results, err := client.PruneVolumes(PruneVolumesOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &PruneVolumesResults{VolumesDeleted: []string{"tardis", "foo"}, SpaceReclaimed: 4096}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("PruneVolumes: wrong results. Want %#v. Got %#v.", expected, results)
+	}
+	req := fakeRT.requests[0]
+	expectedURL, _ := url.Parse(client.getURL("/volumes/prune"))
+	if req.Method != "POST" || req.URL.Path != expectedURL.Path {
+		t.Errorf("PruneVolumes: wrong request. Want POST %s. Got %s %s.", expectedURL.Path, req.Method, req.URL.Path)
+	}
+}